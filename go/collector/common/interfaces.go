@@ -82,6 +82,28 @@ type ProtocolCollector interface {
 	Online() bool
 }
 
+// StreamCollector is implemented by protocol collectors that receive data
+// pushed by the device, such as GraphQL subscriptions. Streamed results do
+// not come from Exec; the collector hands them to the registered handler,
+// which forwards them to the parser like the results of polled jobs.
+type StreamCollector interface {
+	// SetStreamHandler registers the function invoked with every job result
+	// produced by a stream. The job carries its target, host, pollaris and
+	// job names, and either a Result or an Error.
+	SetStreamHandler(handler func(*l8tpollaris.CJob))
+}
+
+// DeleteCollector is implemented by protocol collectors that observe
+// deletions of objects on the device, such as the Kubernetes API collector.
+// Deletions are not job results; the collector reports each one to the
+// registered handler, which forwards it to the parser as a DELETE.
+type DeleteCollector interface {
+	// SetDeleteHandler registers the function invoked with the resource
+	// type ("group/version/resource"), namespace and name of every deleted
+	// object.
+	SetDeleteHandler(handler func(gvrText, namespace, name string))
+}
+
 // SmoothFirstCollection when set to true, enables randomized initial collection
 // timing to prevent thundering herd scenarios when many devices start collecting
 // simultaneously. When enabled, the first collection for each job will be
@@ -33,8 +33,9 @@ import (
 //	result = "get pods -n kube-system"
 //
 // If the job has no arguments or a referenced variable is not found,
-// the original string is returned unchanged. This function is primarily
-// used by the Kubernetes collector for dynamic command templating.
+// the original string is returned unchanged. The result is a single string,
+// so it must not be passed to a shell; the Kubernetes collector substitutes
+// per command argument instead.
 //
 // Parameters:
 //   - what: The command string containing $variable placeholders
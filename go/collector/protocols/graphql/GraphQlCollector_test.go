@@ -0,0 +1,234 @@
+package graphql
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestBindVariables(t *testing.T) {
+	query := `query Devices($site: String!, $limit: Int = 10, $ids: [ID!], $up: Boolean, $targetId: ID!, $after: String) {
+		devices(site: $site, first: $limit, after: $after) { id }
+	}`
+	job := &l8tpollaris.CJob{
+		TargetId:  "dev-1",
+		Arguments: map[string]string{"site": "nyc", "limit": "25", "ids": "a,b", "up": "true"},
+	}
+	vars, err := bindVariables(query, job, CursorVariable)
+	if err != nil {
+		t.Fatalf("bind error: %v", err)
+	}
+	if vars["site"] != "nyc" || vars["limit"] != 25 || vars["up"] != true || vars["targetId"] != "dev-1" {
+		t.Fatalf("unexpected variables: %v", vars)
+	}
+	if ids := vars["ids"].([]interface{}); len(ids) != 2 || ids[1] != "b" {
+		t.Fatalf("unexpected list variable: %v", vars["ids"])
+	}
+	if _, ok := vars["after"]; ok {
+		t.Fatal("cursor variable must not be bound")
+	}
+
+	delete(job.Arguments, "site")
+	if _, err = bindVariables(query, job, CursorVariable); err == nil {
+		t.Fatal("expected error for missing required variable")
+	}
+}
+
+func TestResolveFragments(t *testing.T) {
+	fragments := map[string]string{
+		"DeviceFields": "fragment DeviceFields on Device { id ...StatusFields }",
+		"StatusFields": "fragment StatusFields on Device { status }",
+	}
+	query, err := resolveFragments("query { devices { ...DeviceFields ... on Router { asn } } }", func(name string) (string, error) {
+		if f, ok := fragments[name]; ok {
+			return f, nil
+		}
+		return "", errors.New("not found")
+	})
+	if err != nil {
+		t.Fatalf("resolve error: %v", err)
+	}
+	if !strings.Contains(query, "fragment DeviceFields") || !strings.Contains(query, "fragment StatusFields") {
+		t.Fatalf("fragments not appended: %s", query)
+	}
+}
+
+// pageMessage builds a dynamic "Page { pageInfo { hasNextPage endCursor } nodes }" message.
+func pageMessage(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("page_test.proto"),
+		Package: proto.String("test"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("PageInfo"), Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("has_next_page"), JsonName: proto.String("hasNextPage"), Number: proto.Int32(1), Label: optional, Type: descriptorpb.FieldDescriptorProto_TYPE_BOOL.Enum()},
+				{Name: proto.String("end_cursor"), JsonName: proto.String("endCursor"), Number: proto.Int32(2), Label: optional, Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+			}},
+			{Name: proto.String("Page"), Field: []*descriptorpb.FieldDescriptorProto{
+				{Name: proto.String("page_info"), JsonName: proto.String("pageInfo"), Number: proto.Int32(1), Label: optional, Type: descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(), TypeName: proto.String(".test.PageInfo")},
+				{Name: proto.String("nodes"), JsonName: proto.String("nodes"), Number: proto.Int32(2), Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum(), Type: descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum()},
+			}},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("build descriptor: %v", err)
+	}
+	return fd.Messages().ByName("Page")
+}
+
+func TestQueryPagesFollowsCursor(t *testing.T) {
+	desc := pageMessage(t)
+	pages := map[string][]string{"": {"a", "b"}, "c1": {"c"}, "c2": {"d"}}
+	next := map[string]string{"": "c1", "c1": "c2"}
+	calls := 0
+	query := func(text string, vars map[string]interface{}, respType, respAttr string) (proto.Message, error) {
+		calls++
+		cursor, _ := vars[CursorVariable].(string)
+		msg := dynamicpb.NewMessage(desc)
+		nodes := msg.Mutable(desc.Fields().ByName("nodes")).List()
+		for _, node := range pages[cursor] {
+			nodes.Append(protoreflect.ValueOfString(node))
+		}
+		info := msg.Mutable(desc.Fields().ByName("page_info")).Message()
+		infoFields := info.Descriptor().Fields()
+		info.Set(infoFields.ByName("has_next_page"), protoreflect.ValueOfBool(next[cursor] != ""))
+		info.Set(infoFields.ByName("end_cursor"), protoreflect.ValueOfString(next[cursor]))
+		return msg, nil
+	}
+
+	resp, err := queryPages(query, `query Nodes($after: String) { nodes(after: $after) { pageInfo { hasNextPage endCursor } } }`, nil, "Page")
+	if err != nil {
+		t.Fatalf("query error: %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 pages, got %d", calls)
+	}
+	msg := resp.ProtoReflect()
+	if n := msg.Get(desc.Fields().ByName("nodes")).List().Len(); n != 4 {
+		t.Fatalf("expected 4 merged nodes, got %d", n)
+	}
+	hasNext, _ := pageState(msg.Get(desc.Fields().ByName("page_info")).Message())
+	if hasNext {
+		t.Fatal("merged pageInfo should come from the last page")
+	}
+
+	calls = 0
+	MaxPages = 2
+	defer func() { MaxPages = 50 }()
+	if _, err = queryPages(query, `query Nodes($after: String) { x }`, nil, "Page"); err != nil || calls != 2 {
+		t.Fatalf("expected page cap of 2, got %d calls (%v)", calls, err)
+	}
+}
+
+// newSubscriptionServer serves graphql-transport-ws, sending one event per
+// connection and closing the first connection to force a reconnect.
+func newSubscriptionServer(t *testing.T, connections *int32) *httptest.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{Subprotocols: []string{GraphQLTransportWS}}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		n := atomic.AddInt32(connections, 1)
+		msg := &wsMessage{}
+		if conn.ReadJSON(msg) != nil || msg.Type != "connection_init" {
+			return
+		}
+		conn.WriteJSON(&wsMessage{Type: "connection_ack"})
+		if conn.ReadJSON(msg) != nil || msg.Type != "subscribe" {
+			return
+		}
+		conn.WriteJSON(&wsMessage{Id: msg.Id, Type: "next", Payload: []byte(`{"data":{"alarm":{"id":"` + strconv.Itoa(int(n)) + `"}}}`)})
+		if n == 1 {
+			return
+		}
+		conn.ReadJSON(msg)
+	}))
+}
+
+func TestSubscriptionStreamsAndReconnects(t *testing.T) {
+	var connections int32
+	server := newSubscriptionServer(t, &connections)
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(u.Port())
+
+	SubscriptionBackoff.Min = 10 * time.Millisecond
+	defer func() { SubscriptionBackoff.Min = time.Second }()
+
+	collector := &GraphQlCollector{hostProtocol: &l8tpollaris.L8PHostProtocol{Addr: u.Hostname(), Port: int32(port)}}
+	results := make(chan *l8tpollaris.CJob, 4)
+	collector.SetStreamHandler(func(job *l8tpollaris.CJob) { results <- job })
+
+	job := &l8tpollaris.CJob{TargetId: "ctl-1", PollarisName: "alarms", JobName: "alarmStream"}
+	collector.execSubscription(job, "subscription { alarm { id } }", nil, "")
+	for _, expected := range []string{`{"alarm":{"id":"1"}}`, `{"alarm":{"id":"2"}}`} {
+		select {
+		case result := <-results:
+			if string(result.Result) != expected || result.TargetId != "ctl-1" {
+				t.Fatalf("unexpected stream result %s for %s", result.Result, result.TargetId)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for subscription event")
+		}
+	}
+	if !collector.streamsOnline() {
+		t.Fatal("expected the reconnected stream to be online")
+	}
+	collector.Disconnect()
+	if len(collector.streams) != 0 {
+		t.Fatal("expected streams to be stopped on disconnect")
+	}
+}
+
+func TestTokenExpiryAndReauth(t *testing.T) {
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"collector","exp":` + strconv.FormatInt(exp, 10) + `}`))
+	if got := tokenExpiry("header."+claims+".signature", now); got.Unix() != exp {
+		t.Fatalf("expected JWT expiry %d, got %d", exp, got.Unix())
+	}
+	if got := tokenExpiry("opaque-token", now); !got.IsZero() {
+		t.Fatalf("expected unknown expiry for opaque token, got %v", got)
+	}
+
+	collector := &GraphQlCollector{}
+	if !collector.needsAuth(now) {
+		t.Fatal("expected auth before the first request")
+	}
+	collector.connected = true
+	if collector.needsAuth(now) {
+		t.Fatal("expected no re-auth without a known expiry")
+	}
+	collector.tokenExpiry = now.Add(TokenRefreshMargin / 2)
+	if !collector.needsAuth(now) {
+		t.Fatal("expected re-auth for a token about to expire")
+	}
+
+	if !isAuthError(errors.New("GraphQL request failed with status 401 Unauthorized:")) ||
+		!isAuthError(errors.New("GraphQL errors: UNAUTHENTICATED")) ||
+		isAuthError(errors.New("GraphQL errors: field not found")) ||
+		isAuthError(errors.New("dial tcp: connection refused")) {
+		t.Fatal("unexpected auth error classification")
+	}
+}
@@ -19,6 +19,10 @@ limitations under the License.
 package graphql
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/saichler/l8pollaris/go/pollaris"
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 	"github.com/saichler/l8types/go/ifs"
@@ -36,13 +40,22 @@ import (
 //   - Token-based authentication via login endpoints
 //   - Flexible query structure with typed responses
 //   - Automatic connection management
+//   - Subscriptions over WebSocket (graphql-transport-ws and graphql-ws)
 //
 // The collector uses the l8web/gclient package for GraphQL client operations.
 type GraphQlCollector struct {
-	client       *gclient.GraphQLClient        // GraphQL client for query execution
-	hostProtocol *l8tpollaris.L8PHostProtocol  // Host configuration with connection details
-	resources    ifs.IResources                // Layer8 resources for logging and registry
-	connected    bool                          // Connection state flag
+	client       *gclient.GraphQLClient       // GraphQL client for query execution
+	hostProtocol *l8tpollaris.L8PHostProtocol // Host configuration with connection details
+	resources    ifs.IResources               // Layer8 resources for logging and registry
+	connected    bool                         // Authenticated session established
+	online       bool                         // Last request reached the endpoint
+	tokenExpiry  time.Time                    // When the bearer token expires, zero if unknown
+
+	streamsMtx    sync.Mutex               // Guards streams, streamHandler and streamCfg
+	streams       map[string]*subscription // Running subscription streams by job
+	streamHandler func(*l8tpollaris.CJob)  // Receives subscription results
+	streamCfg     *streamConfig            // What subscription streams dial with
+	streamsWg     sync.WaitGroup           // Running subscription goroutines
 }
 
 // Init initializes the GraphQL collector with the provided host configuration.
@@ -101,17 +114,27 @@ func (this *GraphQlCollector) Protocol() l8tpollaris.L8PProtocol {
 // PollarisName and JobName. The response is serialized using protobuf
 // and stored in the job's Result field.
 //
-// The method automatically establishes a connection if not already connected.
-// Errors are recorded in the job's Error field and ErrorCount is incremented.
+// The method authenticates when there is no session yet or the token is
+// about to expire, and re-authenticates once if a request is rejected with
+// an authentication error. Errors are recorded in the job's Error field and
+// ErrorCount is incremented.
 //
 // The poll configuration should contain:
 //   - What: The GraphQL query string
 //   - RespName: The expected response type name for protobuf unmarshaling
 //
+// Variables declared by the query are bound from the job's arguments (see
+// bindVariables), fragments spread but not defined by the query are taken
+// from sibling polls, and queries declaring the CursorVariable follow Relay
+// pagination up to MaxPages, merging all pages into one result.
+//
+// Subscription queries start a long-lived stream for the job instead (see
+// execSubscription); each event is delivered through the stream handler.
+//
 // Parameters:
 //   - job: The collection job containing pollaris reference and result storage
 func (this *GraphQlCollector) Exec(job *l8tpollaris.CJob) {
-	if !this.connected {
+	if this.needsAuth(time.Now()) {
 		err := this.Connect()
 		if err != nil {
 			job.ErrorCount++
@@ -126,52 +149,101 @@ func (this *GraphQlCollector) Exec(job *l8tpollaris.CJob) {
 		return
 	}
 
-	resp, err := this.client.Query(poll.What, nil, poll.RespName, "")
+	query, err := resolveFragments(poll.What, func(name string) (string, error) {
+		fragment, err := pollaris.Poll(job.PollarisName, name, this.resources)
+		if err != nil {
+			return "", err
+		}
+		return fragment.What, nil
+	})
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+
+	variables, err := bindVariables(query, job, CursorVariable)
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+
+	if isSubscription(query) {
+		this.execSubscription(job, query, variables, poll.RespName)
+		this.online = true
+		return
+	}
+
+	resp, err := queryPages(this.query, query, variables, poll.RespName)
 	if err != nil {
+		this.online = isReachable(err)
 		job.ErrorCount++
 		job.Error = err.Error()
 		return
 	}
 
+	this.online = true
 	job.ErrorCount = 0
 	job.Result, _ = proto.Marshal(resp)
 }
 
 // Connect establishes the authenticated connection to the GraphQL endpoint.
-// It retrieves credentials from the security service using the configured
-// credential ID and performs authentication using the GraphQL client.
+// For token-based authentication, it retrieves credentials from the security
+// service using the configured credential ID, performs a login request to
+// obtain a bearer token and records the token's expiry.
 //
-// For API key authentication, the credentials are sent as headers.
-// For token-based authentication, a login request is made to obtain a bearer token.
+// For API key authentication, the credentials are sent as headers with every
+// request and no login is needed.
 //
 // Returns:
-//   - error if authentication fails, nil on success
+//   - error if the credentials cannot be retrieved or authentication fails, nil on success
 func (this *GraphQlCollector) Connect() error {
+	this.connected = false
+	if this.hostProtocol.Ainfo == nil || !this.hostProtocol.Ainfo.NeedAuth {
+		this.connected = true
+		this.refreshStreamConfig()
+		return nil
+	}
 	_, username, password, _, err := this.resources.Security().Credential(this.hostProtocol.CredId, "graph", this.resources)
 	if err != nil {
-		panic(err)
+		return errors.New("GraphQL credentials " + this.hostProtocol.CredId + ": " + err.Error())
 	}
-	return this.client.Auth(username, password)
+	if err = this.client.Auth(username, password); err != nil {
+		this.online = isReachable(err)
+		return err
+	}
+	// The client only sends the bearer token when it is marked as required
+	this.client.TokenRequired = this.client.Token != ""
+	this.tokenExpiry = tokenExpiry(this.client.Token, time.Now())
+	this.connected = true
+	this.refreshStreamConfig()
+	return nil
 }
 
 // Disconnect closes the GraphQL client connection and releases all resources.
-// After calling Disconnect, the collector must be re-initialized before use.
+// Subscription streams are stopped, and waited for, before the connection
+// fields they were started with are cleared. After calling Disconnect, the
+// collector must be re-initialized before use.
 //
 // Returns:
 //   - Always returns nil (connection cleanup is best-effort)
 func (this *GraphQlCollector) Disconnect() error {
+	this.stopStreams()
 	if this.client != nil {
 		this.client = nil
 	}
 	this.hostProtocol = nil
 	this.resources = nil
 	this.connected = false
+	this.online = false
+	this.tokenExpiry = time.Time{}
 	return nil
 }
 
-// Online returns the connection status of the GraphQL collector.
-// For GraphQL, this always returns true as connections are stateless HTTP requests.
-// The actual connectivity is verified during each query execution.
+// Online returns the connection status of the GraphQL collector. It is
+// true once the collector is authenticated and its last request reached the
+// endpoint, and while every subscription stream is connected.
 func (this *GraphQlCollector) Online() bool {
-	return true
+	return this.connected && this.online && this.streamsOnline()
 }
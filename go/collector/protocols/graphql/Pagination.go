@@ -0,0 +1,129 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphql
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// CursorVariable is the operation variable that carries the Relay cursor.
+// Queries declaring it are paginated automatically.
+var CursorVariable = "after"
+
+// MaxPages caps the number of pages fetched for one paginated job. When the
+// cap is reached the merged result keeps hasNextPage set.
+var MaxPages = 50
+
+// queryFunc executes one GraphQL request, normally GraphQLClient.Query.
+type queryFunc func(query string, variables map[string]interface{}, respType, respAttr string) (proto.Message, error)
+
+// queryPages executes query and, when it declares the cursor variable and
+// the response carries a Relay pageInfo, follows endCursor while
+// hasNextPage is set. Pages are merged into the first response with
+// proto.Merge, so repeated fields (edges, nodes) are concatenated; the
+// merged pageInfo is the one of the last page fetched.
+func queryPages(query queryFunc, text string, variables map[string]interface{}, respType string) (proto.Message, error) {
+	paginated := false
+	for _, def := range variableDefinitions(text) {
+		if def.name == CursorVariable {
+			paginated = true
+			break
+		}
+	}
+	var merged proto.Message
+	for page := 0; ; page++ {
+		resp, err := query(text, variables, respType, "")
+		if err != nil {
+			return nil, err
+		}
+		if merged == nil {
+			merged = resp
+		} else if resp != nil {
+			proto.Merge(merged, resp)
+		}
+		if !paginated || resp == nil {
+			return merged, nil
+		}
+		path := pageInfoPath(resp.ProtoReflect())
+		if path == nil {
+			return merged, nil
+		}
+		info := messageAt(resp.ProtoReflect(), path)
+		if page > 0 {
+			setMessageAt(merged.ProtoReflect(), path, info)
+		}
+		hasNext, cursor := pageState(info)
+		if !hasNext || cursor == "" || page+1 >= MaxPages {
+			return merged, nil
+		}
+		if variables == nil {
+			variables = make(map[string]interface{})
+		}
+		variables[CursorVariable] = cursor
+	}
+}
+
+// pageInfoPath returns the field path to the first pageInfo message found
+// in msg, searching singular message fields depth first.
+func pageInfoPath(msg protoreflect.Message) []protoreflect.FieldDescriptor {
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() || !msg.Has(fd) {
+			continue
+		}
+		if fd.JSONName() == "pageInfo" {
+			return []protoreflect.FieldDescriptor{fd}
+		}
+		if sub := pageInfoPath(msg.Get(fd).Message()); sub != nil {
+			return append([]protoreflect.FieldDescriptor{fd}, sub...)
+		}
+	}
+	return nil
+}
+
+func messageAt(msg protoreflect.Message, path []protoreflect.FieldDescriptor) protoreflect.Message {
+	for _, fd := range path {
+		msg = msg.Get(fd).Message()
+	}
+	return msg
+}
+
+func setMessageAt(msg protoreflect.Message, path []protoreflect.FieldDescriptor, value protoreflect.Message) {
+	for _, fd := range path[:len(path)-1] {
+		msg = msg.Mutable(fd).Message()
+	}
+	clone := proto.Clone(value.Interface())
+	msg.Set(path[len(path)-1], protoreflect.ValueOfMessage(clone.ProtoReflect()))
+}
+
+// pageState reads hasNextPage and endCursor from a pageInfo message.
+func pageState(info protoreflect.Message) (bool, string) {
+	hasNext := false
+	cursor := ""
+	fields := info.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		switch {
+		case fd.JSONName() == "hasNextPage" && fd.Kind() == protoreflect.BoolKind:
+			hasNext = info.Get(fd).Bool()
+		case fd.JSONName() == "endCursor" && fd.Kind() == protoreflect.StringKind:
+			cursor = info.Get(fd).String()
+		}
+	}
+	return hasNext, cursor
+}
@@ -0,0 +1,106 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphql
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// TokenTTL is the lifetime assumed for bearer tokens that carry no JWT
+// "exp" claim. Zero means such tokens are used until the server rejects them.
+var TokenTTL time.Duration
+
+// TokenRefreshMargin renews a token this long before it expires, so that
+// it does not expire in the middle of a paginated query.
+var TokenRefreshMargin = 30 * time.Second
+
+// tokenExpiry returns when token expires: the JWT "exp" claim if the token
+// is a JWT, otherwise now plus TokenTTL. The zero time means unknown.
+func tokenExpiry(token string, now time.Time) time.Time {
+	if token == "" {
+		return time.Time{}
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err == nil {
+			claims := &struct {
+				Exp int64 `json:"exp"`
+			}{}
+			if json.Unmarshal(payload, claims) == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0)
+			}
+		}
+	}
+	if TokenTTL > 0 {
+		return now.Add(TokenTTL)
+	}
+	return time.Time{}
+}
+
+// isAuthError reports whether a query error means the credentials or token
+// were rejected, either by HTTP status or by a GraphQL error message.
+func isAuthError(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	if strings.HasPrefix(msg, "GraphQL request failed with status 401") ||
+		strings.HasPrefix(msg, "GraphQL request failed with status 403") {
+		return true
+	}
+	if strings.HasPrefix(msg, "GraphQL errors: ") {
+		lower := strings.ToLower(msg)
+		return strings.Contains(lower, "unauthenticated") || strings.Contains(lower, "unauthorized") ||
+			strings.Contains(lower, "token expired") || strings.Contains(lower, "invalid token")
+	}
+	return false
+}
+
+// isReachable reports whether a query error still proves the endpoint
+// answered, as GraphQL errors and non-2xx responses do.
+func isReachable(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "GraphQL errors: ") || strings.HasPrefix(msg, "GraphQL request failed with status ")
+}
+
+// needsAuth reports whether the collector has to authenticate before the
+// next request: it never did, or its token is about to expire.
+func (this *GraphQlCollector) needsAuth(now time.Time) bool {
+	if !this.connected {
+		return true
+	}
+	return !this.tokenExpiry.IsZero() && now.Add(TokenRefreshMargin).After(this.tokenExpiry)
+}
+
+// query executes one GraphQL request. If the server rejects the token, the
+// collector re-authenticates once and repeats the request.
+func (this *GraphQlCollector) query(text string, variables map[string]interface{}, respType, respAttr string) (proto.Message, error) {
+	resp, err := this.client.Query(text, variables, respType, respAttr)
+	if err != nil && isAuthError(err) && this.hostProtocol.Ainfo.NeedAuth {
+		this.connected = false
+		if authErr := this.Connect(); authErr != nil {
+			return nil, authErr
+		}
+		resp, err = this.client.Query(text, variables, respType, respAttr)
+	}
+	return resp, err
+}
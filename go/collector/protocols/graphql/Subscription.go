@@ -0,0 +1,470 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphql
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// WebSocket sub-protocols for GraphQL subscriptions. The collector offers
+// both and speaks whichever the server selects.
+const (
+	// GraphQLTransportWS is the graphql-ws library protocol.
+	GraphQLTransportWS = "graphql-transport-ws"
+	// GraphQLWS is the legacy subscriptions-transport-ws protocol.
+	GraphQLWS = "graphql-ws"
+)
+
+// SubscriptionBackoff bounds the delay between reconnect attempts of a
+// subscription stream. The delay doubles after every failed attempt and is
+// reset once the server acknowledges a connection.
+var SubscriptionBackoff = struct {
+	Min time.Duration
+	Max time.Duration
+}{Min: time.Second, Max: time.Minute}
+
+var subscriptionRegex = regexp.MustCompile(`^\s*subscription\b`)
+
+// isSubscription reports whether a poll's query is a subscription operation.
+func isSubscription(query string) bool {
+	return subscriptionRegex.MatchString(query)
+}
+
+// wsMessage is a GraphQL over WebSocket protocol message, common to both
+// supported sub-protocols.
+type wsMessage struct {
+	Id      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// subscription is a long-lived subscription stream of one job. Every
+// received event is decoded into the poll's response type and delivered as
+// a copy of the job through the collector's stream handler.
+type subscription struct {
+	collector *GraphQlCollector
+	template  *l8tpollaris.CJob
+	query     string
+	variables map[string]interface{}
+	respName  string
+
+	mtx       sync.Mutex
+	conn      *websocket.Conn
+	online    bool
+	lastError string
+	stop      chan struct{}
+}
+
+// SetStreamHandler registers the function that receives the job results
+// produced by subscription streams. It implements common.StreamCollector.
+func (this *GraphQlCollector) SetStreamHandler(handler func(*l8tpollaris.CJob)) {
+	this.streamsMtx.Lock()
+	defer this.streamsMtx.Unlock()
+	this.streamHandler = handler
+}
+
+// execSubscription makes sure the subscription stream of job is running.
+// Events are delivered asynchronously, so the job itself carries no result;
+// it reports an error while the stream is down.
+func (this *GraphQlCollector) execSubscription(job *l8tpollaris.CJob, query string, variables map[string]interface{}, respName string) {
+	key := job.PollarisName + "::" + job.JobName
+	this.streamsMtx.Lock()
+	if this.streamHandler == nil {
+		this.streamsMtx.Unlock()
+		job.ErrorCount++
+		job.Error = "GraphQL subscription requires a stream handler"
+		return
+	}
+	if this.streams == nil {
+		this.streams = make(map[string]*subscription)
+	}
+	if this.streamCfg == nil {
+		this.streamCfg = this.newStreamConfig()
+	}
+	sub, ok := this.streams[key]
+	if !ok {
+		sub = &subscription{
+			collector: this,
+			template:  streamTemplate(job),
+			query:     query,
+			variables: variables,
+			respName:  respName,
+			stop:      make(chan struct{}),
+		}
+		this.streams[key] = sub
+		this.streamsWg.Add(1)
+		go sub.run()
+	}
+	this.streamsMtx.Unlock()
+
+	sub.mtx.Lock()
+	defer sub.mtx.Unlock()
+	if !sub.online && sub.lastError != "" {
+		job.ErrorCount++
+		job.Error = "GraphQL subscription down: " + sub.lastError
+	}
+}
+
+// streamTemplate copies the identifying fields of job for stream results.
+func streamTemplate(job *l8tpollaris.CJob) *l8tpollaris.CJob {
+	template := &l8tpollaris.CJob{
+		TargetId:     job.TargetId,
+		HostId:       job.HostId,
+		PollarisName: job.PollarisName,
+		JobName:      job.JobName,
+		LinksId:      job.LinksId,
+		Always:       true,
+	}
+	if job.Arguments != nil {
+		template.Arguments = make(map[string]string, len(job.Arguments))
+		for k, v := range job.Arguments {
+			template.Arguments[k] = v
+		}
+	}
+	return template
+}
+
+// streamsOnline reports whether every subscription stream is connected.
+func (this *GraphQlCollector) streamsOnline() bool {
+	this.streamsMtx.Lock()
+	defer this.streamsMtx.Unlock()
+	for _, sub := range this.streams {
+		sub.mtx.Lock()
+		online := sub.online
+		sub.mtx.Unlock()
+		if !online {
+			return false
+		}
+	}
+	return true
+}
+
+// stopStreams terminates every subscription stream and waits for their
+// goroutines to return.
+func (this *GraphQlCollector) stopStreams() {
+	this.streamsMtx.Lock()
+	for key, sub := range this.streams {
+		sub.close()
+		delete(this.streams, key)
+	}
+	this.streamHandler = nil
+	this.streamCfg = nil
+	this.streamsMtx.Unlock()
+	this.streamsWg.Wait()
+}
+
+func (this *subscription) close() {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	select {
+	case <-this.stop:
+	default:
+		close(this.stop)
+	}
+	if this.conn != nil {
+		this.conn.Close()
+	}
+}
+
+func (this *subscription) stopped() bool {
+	select {
+	case <-this.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run keeps the stream connected until it is stopped, reconnecting with
+// exponential backoff.
+func (this *subscription) run() {
+	defer this.collector.streamsWg.Done()
+	delay := SubscriptionBackoff.Min
+	for !this.stopped() {
+		acked, err := this.stream()
+		this.mtx.Lock()
+		this.online = false
+		this.conn = nil
+		if err != nil {
+			this.lastError = err.Error()
+		}
+		this.mtx.Unlock()
+		if this.stopped() {
+			return
+		}
+		if acked {
+			delay = SubscriptionBackoff.Min
+		}
+		if err != nil && this.collector.resources != nil {
+			this.collector.resources.Logger().Warning("GraphQL subscription ", this.template.JobName,
+				" to ", this.template.TargetId, " failed: ", err.Error(), ", reconnecting in ", delay.String())
+		}
+		select {
+		case <-this.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > SubscriptionBackoff.Max {
+			delay = SubscriptionBackoff.Max
+		}
+	}
+}
+
+// stream runs one connection of the subscription and returns when it ends.
+// acked reports whether the server accepted the connection.
+func (this *subscription) stream() (acked bool, err error) {
+	cfg := this.collector.currentStreamConfig()
+	if cfg == nil {
+		return false, errors.New("GraphQL collector is disconnected")
+	}
+	conn, err := this.dial(cfg)
+	if err != nil {
+		return false, err
+	}
+	this.mtx.Lock()
+	if this.stopped() {
+		this.mtx.Unlock()
+		conn.Close()
+		return false, nil
+	}
+	this.conn = conn
+	this.mtx.Unlock()
+	defer conn.Close()
+
+	legacy := conn.Subprotocol() == GraphQLWS
+	initPayload, _ := json.Marshal(connectionParams(cfg.header))
+	if err = conn.WriteJSON(&wsMessage{Type: "connection_init", Payload: initPayload}); err != nil {
+		return false, err
+	}
+
+	start := "subscribe"
+	if legacy {
+		start = "start"
+	}
+	for {
+		msg := &wsMessage{}
+		if err = conn.ReadJSON(msg); err != nil {
+			if this.stopped() {
+				return acked, nil
+			}
+			return acked, err
+		}
+		switch msg.Type {
+		case "connection_ack":
+			acked = true
+			payload, _ := json.Marshal(map[string]interface{}{"query": this.query, "variables": this.variables})
+			if err = conn.WriteJSON(&wsMessage{Id: "1", Type: start, Payload: payload}); err != nil {
+				return acked, err
+			}
+			this.mtx.Lock()
+			this.online = true
+			this.lastError = ""
+			this.mtx.Unlock()
+		case "ping":
+			if err = conn.WriteJSON(&wsMessage{Type: "pong"}); err != nil {
+				return acked, err
+			}
+		case "next", "data":
+			this.deliver(msg.Payload)
+		case "error", "connection_error":
+			return acked, errors.New("GraphQL subscription error: " + string(msg.Payload))
+		case "complete":
+			return acked, errors.New("GraphQL subscription completed by server")
+		}
+	}
+}
+
+// deliver decodes an event payload ({"data": ..., "errors": ...}) into the
+// poll's response type and hands it to the stream handler.
+func (this *subscription) deliver(payload json.RawMessage) {
+	event := &struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}{}
+	job := proto.Clone(this.template).(*l8tpollaris.CJob)
+	job.Started = time.Now().Unix()
+	err := json.Unmarshal(payload, event)
+	if err == nil && len(event.Errors) > 0 {
+		err = errors.New("GraphQL subscription event error: " + event.Errors[0].Message)
+	}
+	if err == nil {
+		job.Result, err = this.collector.decodeEvent(event.Data, this.respName)
+	}
+	if err != nil {
+		job.ErrorCount = 1
+		job.Error = err.Error()
+	}
+	job.Ended = time.Now().Unix()
+
+	this.collector.streamsMtx.Lock()
+	handler := this.collector.streamHandler
+	this.collector.streamsMtx.Unlock()
+	if handler != nil {
+		handler(job)
+	}
+}
+
+// decodeEvent converts event data into the registered response type and
+// marshals it, matching the result format of query polls. Without a
+// response type the raw JSON data is kept.
+func (this *GraphQlCollector) decodeEvent(data json.RawMessage, respName string) ([]byte, error) {
+	if respName == "" || this.resources == nil {
+		return data, nil
+	}
+	info, err := this.resources.Registry().Info(respName)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := info.NewInstance()
+	if err != nil {
+		return nil, err
+	}
+	msg, ok := instance.(proto.Message)
+	if !ok {
+		return nil, errors.New(respName + " is not a protobuf message")
+	}
+	if err = protojson.Unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(msg)
+}
+
+// streamConfig is what subscription streams dial with. It is copied from
+// the collector when the first stream starts and whenever the collector
+// authenticates, so that streams never read the collector's connection
+// fields, which Connect and Disconnect change while streams run.
+type streamConfig struct {
+	url    string
+	header http.Header
+	tls    *tls.Config
+	err    error // Reading the CA certificate failed
+}
+
+// newStreamConfig copies the collector's connection settings for streams.
+func (this *GraphQlCollector) newStreamConfig() *streamConfig {
+	if this.hostProtocol == nil {
+		return nil
+	}
+	cfg := &streamConfig{
+		url:    this.subscriptionURL(),
+		header: this.authHeader(),
+		tls:    &tls.Config{InsecureSkipVerify: true},
+	}
+	if this.hostProtocol.Cert != "" {
+		caCert, err := os.ReadFile(this.hostProtocol.Cert)
+		if err != nil {
+			cfg.err = err
+			return cfg
+		}
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(caCert)
+		cfg.tls = &tls.Config{RootCAs: pool, ServerName: this.hostProtocol.Addr}
+	}
+	return cfg
+}
+
+// refreshStreamConfig publishes the collector's current connection
+// settings, e.g. a new token, to the streams' next connections.
+func (this *GraphQlCollector) refreshStreamConfig() {
+	cfg := this.newStreamConfig()
+	this.streamsMtx.Lock()
+	defer this.streamsMtx.Unlock()
+	this.streamCfg = cfg
+}
+
+func (this *GraphQlCollector) currentStreamConfig() *streamConfig {
+	this.streamsMtx.Lock()
+	defer this.streamsMtx.Unlock()
+	return this.streamCfg
+}
+
+// subscriptionURL returns the WebSocket URL of the GraphQL endpoint.
+func (this *GraphQlCollector) subscriptionURL() string {
+	endpoint := "/graphql"
+	if this.client != nil && this.client.Endpoint != "" {
+		endpoint = this.client.Endpoint
+	}
+	return "wss://" + this.hostProtocol.Addr + ":" + strconv.Itoa(int(this.hostProtocol.Port)) +
+		this.hostProtocol.HttpPrefix + endpoint
+}
+
+// connectionParams returns the connection_init payload carrying the same
+// credentials as HTTP queries.
+func connectionParams(header http.Header) map[string]string {
+	params := make(map[string]string)
+	for name := range header {
+		params[name] = header.Get(name)
+	}
+	return params
+}
+
+// authHeader returns the bearer token or API key headers of the client.
+func (this *GraphQlCollector) authHeader() http.Header {
+	header := http.Header{}
+	if this.client == nil {
+		return header
+	}
+	if this.client.Token != "" {
+		header.Set("Authorization", "Bearer "+this.client.Token)
+	}
+	if this.client.AuthInfo != nil && this.client.AuthInfo.IsAPIKey {
+		header.Set("X-USER-ID", this.client.AuthInfo.ApiUser)
+		header.Set("X-API-KEY", this.client.AuthInfo.ApiKey)
+	}
+	return header
+}
+
+// dial opens the stream's WebSocket connection. Stopping the stream aborts
+// the handshake.
+func (this *subscription) dial(cfg *streamConfig) (*websocket.Conn, error) {
+	if cfg.err != nil {
+		return nil, cfg.err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-this.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	dialer := &websocket.Dialer{
+		TLSClientConfig:  cfg.tls,
+		HandshakeTimeout: 10 * time.Second,
+		Subprotocols:     []string{GraphQLTransportWS, GraphQLWS},
+	}
+	conn, _, err := dialer.DialContext(ctx, cfg.url, cfg.header)
+	return conn, err
+}
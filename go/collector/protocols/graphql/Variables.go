@@ -0,0 +1,203 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+)
+
+// variableDef is a variable declared in a GraphQL operation, e.g.
+// "$limit: Int! = 10".
+type variableDef struct {
+	name       string
+	typ        string // Type without the non-null marker, e.g. "Int" or "[ID]"
+	required   bool   // Declared non-null
+	hasDefault bool
+}
+
+var (
+	operationRegex = regexp.MustCompile(`^\s*(query|mutation|subscription)\b[^({]*\(`)
+	variableRegex  = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_]*)\s*:\s*(\[[^\]]*\]!?|[A-Za-z_][A-Za-z0-9_]*!?)\s*(=)?`)
+)
+
+// variableDefinitions returns the variables declared by the operation of
+// query. Anonymous operations ("{ ... }") declare no variables.
+func variableDefinitions(query string) []variableDef {
+	loc := operationRegex.FindStringIndex(query)
+	if loc == nil {
+		return nil
+	}
+	start := loc[1]
+	depth := 1
+	end := start
+	for end < len(query) && depth > 0 {
+		switch query[end] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		end++
+	}
+	defs := make([]variableDef, 0)
+	for _, match := range variableRegex.FindAllStringSubmatch(query[start:end], -1) {
+		typ := match[2]
+		required := strings.HasSuffix(typ, "!")
+		defs = append(defs, variableDef{
+			name:       match[1],
+			typ:        strings.TrimSuffix(typ, "!"),
+			required:   required,
+			hasDefault: match[3] == "=",
+		})
+	}
+	return defs
+}
+
+// bindVariables resolves the values of the variables declared by query.
+// Values come from job.Arguments by variable name; "targetId" and "hostId"
+// fall back to the job's target and host. Values are coerced to the
+// declared type. Variables named in skip (such as the pagination cursor)
+// are left unbound, and a required variable without a value or a default
+// is an error.
+func bindVariables(query string, job *l8tpollaris.CJob, skip ...string) (map[string]interface{}, error) {
+	defs := variableDefinitions(query)
+	if len(defs) == 0 {
+		return nil, nil
+	}
+	variables := make(map[string]interface{})
+	for _, def := range defs {
+		if containsString(skip, def.name) {
+			continue
+		}
+		value, ok := job.Arguments[def.name]
+		if !ok {
+			switch def.name {
+			case "targetId":
+				value, ok = job.TargetId, job.TargetId != ""
+			case "hostId":
+				value, ok = job.HostId, job.HostId != ""
+			}
+		}
+		if !ok {
+			if def.required && !def.hasDefault {
+				return nil, errors.New("no value for required GraphQL variable $" + def.name)
+			}
+			continue
+		}
+		coerced, err := coerceVariable(value, def.typ)
+		if err != nil {
+			return nil, errors.New("GraphQL variable $" + def.name + ": " + err.Error())
+		}
+		variables[def.name] = coerced
+	}
+	return variables, nil
+}
+
+// coerceVariable converts a string argument into a value of the given
+// GraphQL type. List types take a comma separated value, and input object
+// types take a JSON object.
+func coerceVariable(value, typ string) (interface{}, error) {
+	if strings.HasPrefix(typ, "[") {
+		trimmed := strings.TrimSpace(value)
+		if strings.HasPrefix(trimmed, "[") {
+			var list []interface{}
+			err := json.Unmarshal([]byte(trimmed), &list)
+			return list, err
+		}
+		elemType := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(typ, "["), "]"), "!")
+		list := make([]interface{}, 0)
+		if trimmed == "" {
+			return list, nil
+		}
+		for _, item := range strings.Split(trimmed, ",") {
+			coerced, err := coerceVariable(strings.TrimSpace(item), elemType)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, coerced)
+		}
+		return list, nil
+	}
+	switch typ {
+	case "Int":
+		return strconv.Atoi(value)
+	case "Float":
+		return strconv.ParseFloat(value, 64)
+	case "Boolean":
+		return strconv.ParseBool(value)
+	case "String", "ID":
+		return value, nil
+	}
+	// Enums are sent as strings, input objects as JSON
+	if trimmed := strings.TrimSpace(value); strings.HasPrefix(trimmed, "{") {
+		var obj map[string]interface{}
+		err := json.Unmarshal([]byte(trimmed), &obj)
+		return obj, err
+	}
+	return value, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	fragmentSpreadRegex = regexp.MustCompile(`\.\.\.\s*([A-Za-z_][A-Za-z0-9_]*)`)
+	fragmentDefRegex    = regexp.MustCompile(`\bfragment\s+([A-Za-z_][A-Za-z0-9_]*)\s+on\b`)
+)
+
+// resolveFragments appends the definitions of the fragments that query
+// spreads but does not define. Each missing fragment is obtained from
+// lookup by name, normally a sibling poll of the same pollaris whose What
+// holds "fragment <name> on <Type> { ... }". Fragments spread by the
+// appended definitions are resolved as well.
+func resolveFragments(query string, lookup func(name string) (string, error)) (string, error) {
+	for {
+		defined := make(map[string]bool)
+		for _, match := range fragmentDefRegex.FindAllStringSubmatch(query, -1) {
+			defined[match[1]] = true
+		}
+		missing := ""
+		for _, match := range fragmentSpreadRegex.FindAllStringSubmatch(query, -1) {
+			if match[1] != "on" && !defined[match[1]] {
+				missing = match[1]
+				break
+			}
+		}
+		if missing == "" {
+			return query, nil
+		}
+		fragment, err := lookup(missing)
+		if err != nil {
+			return "", errors.New("GraphQL fragment " + missing + ": " + err.Error())
+		}
+		if !regexp.MustCompile(`\bfragment\s+` + missing + `\s+on\b`).MatchString(fragment) {
+			return "", errors.New("GraphQL fragment " + missing + " is not defined by its poll")
+		}
+		query += "\n" + fragment
+	}
+}
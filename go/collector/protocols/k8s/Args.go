@@ -0,0 +1,114 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+)
+
+// kubectlArgs splits a kubectl command template into arguments and
+// substitutes $variables from the job's arguments inside each one. Words
+// are separated by whitespace and may be quoted with single or double
+// quotes. A substituted value always stays within its argument, so values
+// with spaces or shell characters cannot inject extra arguments. A variable
+// is a '$' followed by letters, digits or '_'. As when commands ran through
+// bash, an unknown variable expands to nothing and a word left empty by its
+// variables is dropped, so "get pods -n $namespace $podname" lists every pod
+// of the namespace when the job has no podname argument.
+func kubectlArgs(what string, job *l8tpollaris.CJob) ([]string, error) {
+	words, err := splitWords(what)
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, 0, len(words))
+	for _, word := range words {
+		if arg := substitute(word, job.Arguments); arg != "" || !strings.Contains(word, "$") {
+			args = append(args, arg)
+		}
+	}
+	if len(args) > 0 && args[0] == "kubectl" {
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// splitWords splits s on whitespace, honoring single and double quotes.
+func splitWords(s string) ([]string, error) {
+	words := make([]string, 0)
+	word := &strings.Builder{}
+	inWord := false
+	var quote rune
+	for _, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote in kubectl command: " + s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func substitute(word string, arguments map[string]string) string {
+	if !strings.Contains(word, "$") {
+		return word
+	}
+	result := &strings.Builder{}
+	for i := 0; i < len(word); i++ {
+		if word[i] != '$' {
+			result.WriteByte(word[i])
+			continue
+		}
+		end := i + 1
+		for end < len(word) && isVariableChar(word[end]) {
+			end++
+		}
+		if end == i+1 {
+			result.WriteByte('$')
+			continue
+		}
+		result.WriteString(arguments[word[i+1:end]])
+		i = end - 1
+	}
+	return result.String()
+}
+
+func isVariableChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -19,12 +19,14 @@ limitations under the License.
 package k8s
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"os"
 	"os/exec"
+	"time"
 
-	"github.com/google/uuid"
-	"github.com/saichler/l8collector/go/collector/common"
 	"github.com/saichler/l8pollaris/go/pollaris"
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 	"github.com/saichler/l8srlz/go/serialize/object"
@@ -32,6 +34,9 @@ import (
 	"github.com/saichler/l8utils/go/utils/strings"
 )
 
+// KubectlPath is the kubectl binary executed by the collector.
+var KubectlPath = "kubectl"
+
 // Kubernetes implements the ProtocolCollector interface for Kubernetes clusters.
 // It executes kubectl commands against configured clusters and collects the
 // output as serialized string data.
@@ -40,22 +45,21 @@ import (
 //   - Base64-encoded kubeconfig support for secure credential storage
 //   - Context-aware cluster configuration
 //   - Dynamic parameter substitution using $variable syntax
-//   - Automatic temporary file cleanup for script execution
 //   - Support for any kubectl command through pollaris configuration
 //
-// The kubeconfig is decoded from base64 and written to a temporary file
-// during initialization. The file is automatically cleaned up on Disconnect.
+// The kubeconfig is decoded from base64 and kept in memory. It is handed to
+// kubectl through a pipe for every command and never written to disk.
 type Kubernetes struct {
-	resources  ifs.IResources                // Layer8 resources for logging and security
-	config     *l8tpollaris.L8PHostProtocol  // Host configuration with credential reference
-	kubeConfig string                        // Path to the temporary kubeconfig file
-	context    string                        // Kubernetes context name to use
-	connected  bool                          // Connection state flag
+	resources  ifs.IResources               // Layer8 resources for logging and security
+	config     *l8tpollaris.L8PHostProtocol // Host configuration with credential reference
+	kubeConfig []byte                       // Decoded kubeconfig contents
+	context    string                       // Kubernetes context name to use
+	connected  bool                         // Last command reached the cluster
 }
 
 // Init initializes the Kubernetes collector with the provided host configuration.
 // It retrieves the kubeconfig from the security service (stored as base64-encoded
-// data), decodes it, and writes it to a temporary file for kubectl to use.
+// data) and decodes it into memory.
 //
 // The credential is expected to contain:
 //   - context: The Kubernetes context name (returned as username)
@@ -66,22 +70,21 @@ type Kubernetes struct {
 //   - resources: Layer8 resources for accessing security credentials and logging
 //
 // Returns:
-//   - error if credential retrieval, decoding, or file writing fails
+//   - error if credential retrieval or decoding fails
 func (this *Kubernetes) Init(config *l8tpollaris.L8PHostProtocol, resources ifs.IResources) error {
 	this.resources = resources
 	this.config = config
 	_, context, kubeconfig, _, err := this.resources.Security().Credential(this.config.CredId, "kubeconfig", this.resources)
 	if err != nil {
-		panic(err)
+		return errors.New("kubeconfig credentials " + this.config.CredId + ": " + err.Error())
 	}
 	this.context = context
-	this.kubeConfig = ".kubeadm-" + context
 	data, err := base64.StdEncoding.DecodeString(kubeconfig)
 	if err != nil {
 		return err
 	}
-	err = os.WriteFile(this.kubeConfig, data, 0644)
-	return err
+	this.kubeConfig = data
+	return nil
 }
 
 // Protocol returns the protocol type identifier for Kubernetes.
@@ -98,11 +101,11 @@ func (this *Kubernetes) Protocol() l8tpollaris.L8PProtocol {
 //
 // The execution process:
 //  1. Retrieves the poll configuration for the command template
-//  2. Performs variable substitution on the command
-//  3. Generates a temporary shell script with the kubectl command
-//  4. Executes the script using bash
-//  5. Captures the output and stores it in the job's Result field
-//  6. Cleans up the temporary script file
+//  2. Splits the command into arguments and substitutes variables in each
+//  3. Runs kubectl directly, without a shell, reading the kubeconfig from a pipe
+//  4. Stops kubectl if it runs past the job's timeout
+//  5. Stores stdout in the job's Result field, or stderr in the job's Error;
+//     polls with an OutputSpec store a CTable or CMap instead (see OutputSpec)
 //
 // Parameters:
 //   - job: The collection job containing pollaris reference, arguments, and result storage
@@ -113,34 +116,123 @@ func (this *Kubernetes) Exec(job *l8tpollaris.CJob) {
 	poll, err := pollaris.Poll(job.PollarisName, job.JobName, this.resources)
 	if err != nil {
 		this.resources.Logger().Error(strings.New("K8s:", err.Error()).String())
+		job.ErrorCount++
+		job.Error = err.Error()
 		return
 	}
+	this.execPoll(job, poll)
+}
 
-	script := strings.New("kubectl --kubeconfig=")
-	script.Add(this.kubeConfig)
-	script.Add(" --context=")
-	script.Add(this.context)
-	script.Add(" ")
-	script.Add(common.ReplaceArguments(poll.What, job))
-	script.Add("\n")
-
-	id := uuid.New().String()
-	in := strings.New("./", id, ".sh").String()
-	defer os.Remove(in)
-	os.WriteFile(in, script.Bytes(), 0777)
-	c := exec.Command("bash", "-c", in, "2>&1")
-	o, e := c.Output()
-	if e != nil {
-		job.Error = e.Error()
+// execPoll runs the kubectl command of poll for job. Polls carrying an
+// OutputSpec are run with "-o json" and return a CTable or CMap; other polls
+// return the raw stdout string.
+func (this *Kubernetes) execPoll(job *l8tpollaris.CJob, poll *l8tpollaris.L8Poll) {
+	command, spec, err := splitOutputSpec(poll.What, poll)
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	args, err := kubectlArgs(command, job)
+	if err != nil {
 		job.ErrorCount++
-	} else {
-		job.ErrorCount = 0
+		job.Error = err.Error()
+		return
+	}
+	if spec != nil {
+		args = withJsonOutput(args)
+	}
+
+	stdout, err := this.kubectl(args, job.Timeout)
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	this.connected = true
+	var result interface{} = string(stdout)
+	if spec != nil {
+		result, err = structuredResult(stdout, spec)
+		if err != nil {
+			job.ErrorCount++
+			job.Error = err.Error()
+			return
+		}
 	}
 	obj := object.NewEncode()
-	obj.Add(string(o))
+	if err = obj.Add(result); err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	job.ErrorCount = 0
 	job.Result = obj.Data()
 }
 
+// kubectl runs kubectl with args and returns its stdout. The kubeconfig is
+// written to a pipe that kubectl reads as /dev/fd/3, and the process is
+// killed once timeout seconds have passed (zero means no timeout).
+func (this *Kubernetes) kubectl(args []string, timeout int64) ([]byte, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		defer cancel()
+	}
+
+	argv := make([]string, 0, len(args)+2)
+	if this.kubeConfig != nil {
+		argv = append(argv, "--kubeconfig=/dev/fd/3")
+	}
+	if this.context != "" {
+		argv = append(argv, "--context="+this.context)
+	}
+	argv = append(argv, args...)
+
+	cmd := exec.CommandContext(ctx, KubectlPath, argv...)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if this.kubeConfig != nil {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return nil, err
+		}
+		cmd.ExtraFiles = []*os.File{reader}
+		if err = cmd.Start(); err != nil {
+			reader.Close()
+			writer.Close()
+			return nil, err
+		}
+		reader.Close()
+		go func() {
+			writer.Write(this.kubeConfig)
+			writer.Close()
+		}()
+	} else if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	err := cmd.Wait()
+	if ctx.Err() == context.DeadlineExceeded {
+		this.connected = false
+		return nil, errors.New(strings.New("kubectl timed out after ", int(timeout), " seconds").String())
+	}
+	if err != nil {
+		msg := bytes.TrimSpace(stderr.Bytes())
+		if bytes.Contains(msg, []byte("Unable to connect to the server")) {
+			this.connected = false
+		}
+		if len(msg) == 0 {
+			return nil, err
+		}
+		return nil, errors.New(strings.New("kubectl ", err.Error(), ": ", string(msg)).String())
+	}
+	return stdout.Bytes(), nil
+}
+
 // Connect is a no-op for the Kubernetes collector.
 // Kubernetes connections are established on-demand during Exec via kubectl.
 //
@@ -150,19 +242,14 @@ func (this *Kubernetes) Connect() error {
 	return nil
 }
 
-// Disconnect cleans up the Kubernetes collector resources.
-// It removes the temporary kubeconfig file created during Init and
-// resets all internal state. After calling Disconnect, the collector
-// must be re-initialized before use.
+// Disconnect releases the Kubernetes collector resources, including the
+// in-memory kubeconfig. After calling Disconnect, the collector must be
+// re-initialized before use.
 //
 // Returns:
 //   - Always returns nil (cleanup is best-effort)
 func (this *Kubernetes) Disconnect() error {
-	// Delete the kubeconfig file created in Init()
-	if this.kubeConfig != "" {
-		os.Remove(this.kubeConfig)
-		this.kubeConfig = ""
-	}
+	this.kubeConfig = nil
 	this.resources = nil
 	this.config = nil
 	this.context = ""
@@ -171,7 +258,8 @@ func (this *Kubernetes) Disconnect() error {
 }
 
 // Online returns the connection status of the Kubernetes collector.
-// Returns true if the collector has been initialized and is ready to execute commands.
+// Returns true once a kubectl command has succeeded, until the cluster
+// becomes unreachable.
 func (this *Kubernetes) Online() bool {
 	return this.connected
 }
@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+)
+
+func TestKubectlArgsSubstitutesPerArgument(t *testing.T) {
+	job := &l8tpollaris.CJob{Arguments: map[string]string{"namespace": "prod; rm -rf /", "podname": "web-0"}}
+	args, err := kubectlArgs(`get pods -o json -n $namespace $podname -l 'app=web tier'`, job)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{"get", "pods", "-o", "json", "-n", "prod; rm -rf /", "web-0", "-l", "app=web tier"}
+	if strings.Join(args, "|") != strings.Join(expected, "|") {
+		t.Fatalf("unexpected args %q", args)
+	}
+	if args, _ = kubectlArgs("get pods -o json -n $namespace $missing $podname-$ x$missing ''", job); strings.Join(args, "|") != "get|pods|-o|json|-n|prod; rm -rf /|web-0-$|x|" {
+		t.Fatalf("expected unknown arguments to expand to nothing, got %q", args)
+	}
+}
+
+// fakeKubectl installs a script that prints its arguments and the
+// kubeconfig read from fd 3, or fails with a message on stderr.
+func fakeKubectl(t *testing.T) {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "kubectl")
+	body := "#!/bin/sh\n" +
+		"for last; do :; done\n" +
+		"if [ \"$last\" = fail ]; then echo 'Error from server (NotFound)' >&2; exit 1; fi\n" +
+		"echo \"$@\"\n" +
+		"cat <&3\n"
+	if err := os.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := KubectlPath
+	KubectlPath = script
+	t.Cleanup(func() { KubectlPath = old })
+}
+
+func TestExecRunsKubectlWithInMemoryKubeconfig(t *testing.T) {
+	fakeKubectl(t)
+	collector := &Kubernetes{kubeConfig: []byte("apiVersion: v1\n"), context: "lab"}
+	job := &l8tpollaris.CJob{Timeout: 10, Arguments: map[string]string{"namespace": "default"}}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "get pods -n $namespace"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	out, _ := object.NewDecode(job.Result, 0, nil).Get()
+	if out != "--kubeconfig=/dev/fd/3 --context=lab get pods -n default\napiVersion: v1\n" {
+		t.Fatalf("unexpected output %q", out)
+	}
+	if !collector.Online() {
+		t.Fatal("expected collector to be online after a successful command")
+	}
+
+	job = &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "get pod fail"})
+	if job.ErrorCount != 1 || !strings.Contains(job.Error, "NotFound") {
+		t.Fatalf("expected stderr in the job error, got %q", job.Error)
+	}
+}
+
+const podList = `{"apiVersion":"v1","kind":"List","items":[` +
+	`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"api-0","namespace":"prod","uid":"u1"},` +
+	`"status":{"phase":"Running","containerStatuses":[{"ready":true,"restartCount":2}]}}]}`
+
+func TestExecStructuredOutputMatchesClientGoColumns(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "kubectl")
+	body := "#!/bin/sh\n" +
+		"case \"$*\" in *\"get pods -A -o json\") ;; *) echo \"unexpected args: $*\" >&2; exit 1;; esac\n" +
+		"echo '" + podList + "'\n"
+	if err := os.WriteFile(script, []byte(body), 0700); err != nil {
+		t.Fatal(err)
+	}
+	old := KubectlPath
+	KubectlPath = script
+	defer func() { KubectlPath = old }()
+
+	what := `get pods -A -o wide :: {"fields":["metadata.name","status.phase","_k.restarts"],"columnNames":["NAME","STATUS","RESTARTS"]}`
+	collector := &Kubernetes{kubeConfig: []byte("apiVersion: v1\n")}
+	job := &l8tpollaris.CJob{Timeout: 10}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: what})
+	if job.Error != "" || len(job.Result) == 0 {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+
+	_, spec, err := splitOutputSpec(what, nil)
+	if err != nil || spec.Result != ResultTable {
+		t.Fatalf("unexpected spec %v (%v)", spec, err)
+	}
+	result, err := structuredResult([]byte(podList), spec)
+	if err != nil {
+		t.Fatalf("structured result error: %v", err)
+	}
+	table := result.(*l8tpollaris.CTable)
+	if len(table.Rows) != 1 || table.Columns[0] != "NAME" || table.Columns[2] != "RESTARTS" {
+		t.Fatalf("unexpected table %v", table)
+	}
+	for col, expected := range []string{"api-0", "Running", "2"} {
+		value, _ := object.NewDecode(table.Rows[0].Data[int32(col)], 0, nil).Get()
+		if value != expected {
+			t.Fatalf("column %d: expected %q, got %v", col, expected, value)
+		}
+	}
+
+	if _, err = structuredResult([]byte(podList), &OutputSpec{Result: ResultMap}); err != nil {
+		t.Fatalf("single item list should build a map: %v", err)
+	}
+	if _, _, err = splitOutputSpec(`get pods :: {"result":"tree"}`, nil); err == nil {
+		t.Fatal("expected error for unknown result")
+	}
+}
+
+func TestObjectGVRMatchesClientGo(t *testing.T) {
+	list := `{"kind":"List","items":[` +
+		`{"apiVersion":"v1","kind":"Endpoints","metadata":{"name":"api"}},` +
+		`{"apiVersion":"networking.k8s.io/v1","kind":"NetworkPolicy","metadata":{"name":"deny"}},` +
+		`{"apiVersion":"gateway.networking.k8s.io/v1","kind":"Gateway","metadata":{"name":"edge"}}]}`
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(list), &doc); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"v1/endpoints", "networking.k8s.io/v1/networkpolicies", "gateway.networking.k8s.io/v1/gateways"}
+	for i, item := range doc["items"].([]interface{}) {
+		if gvr := objectGVR(item.(map[string]interface{})); gvr != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], gvr)
+		}
+	}
+	if _, err := structuredResult([]byte(list), &OutputSpec{Result: ResultTable, Fields: []string{"metadata.name"}}); err != nil {
+		t.Fatalf("structured result error: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/saichler/l8collector/go/collector/protocols/k8sclient"
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+)
+
+// Structured output results.
+const (
+	ResultTable = "table"
+	ResultMap   = "map"
+)
+
+// OutputSpec requests structured output for a kubectl poll. It is appended
+// to the command after "::", for example:
+//
+//	get pods -A :: {"fields":["metadata.name","metadata.namespace","_k.status"],"columnNames":["name","namespace","status"]}
+//
+// The command is run with "-o json" and the objects are converted with
+// k8sclient.BuildCTable or k8sclient.BuildCMap, so fields and column names
+// follow the same model as k8sclient cache specs and the results of both
+// collectors are interchangeable.
+type OutputSpec struct {
+	Result      string   `json:"result"`      // "table" (default) or "map"
+	Fields      []string `json:"fields"`      // Field paths, e.g. "metadata.name" or "_k.age"
+	ColumnNames []string `json:"columnNames"` // Column names, defaults to the field paths
+}
+
+// splitOutputSpec separates the kubectl command from its optional output
+// spec. A nil spec means the raw stdout is returned.
+func splitOutputSpec(what string, poll *l8tpollaris.L8Poll) (string, *OutputSpec, error) {
+	i := strings.Index(what, "::")
+	if i < 0 {
+		return what, nil, nil
+	}
+	spec := &OutputSpec{}
+	raw := strings.TrimSpace(what[i+2:])
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), spec); err != nil {
+			return "", nil, errors.New("invalid kubectl output spec: " + err.Error())
+		}
+	}
+	spec.Result = strings.ToLower(strings.TrimSpace(spec.Result))
+	if spec.Result == "" {
+		spec.Result = ResultTable
+		if poll != nil && poll.Operation == l8tpollaris.L8C_Operation_L8C_Map {
+			spec.Result = ResultMap
+		}
+	}
+	if spec.Result != ResultTable && spec.Result != ResultMap {
+		return "", nil, errors.New("invalid kubectl output result: " + spec.Result)
+	}
+	return strings.TrimSpace(what[:i]), spec, nil
+}
+
+// withJsonOutput replaces any output format flag in args with "-o json".
+func withJsonOutput(args []string) []string {
+	result := make([]string, 0, len(args)+2)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-o" || arg == "--output":
+			i++
+			continue
+		case strings.HasPrefix(arg, "--output="), strings.HasPrefix(arg, "-o") && len(arg) > 2:
+			continue
+		}
+		result = append(result, arg)
+	}
+	return append(result, "-o", "json")
+}
+
+// structuredResult converts "kubectl -o json" output, either a single
+// object or a List, into a CTable or CMap as requested by spec.
+func structuredResult(stdout []byte, spec *OutputSpec) (interface{}, error) {
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(stdout, &doc); err != nil {
+		return nil, errors.New("kubectl output is not json: " + err.Error())
+	}
+	raw := []interface{}{doc}
+	if items, ok := doc["items"].([]interface{}); ok && strings.HasSuffix(stringValue(doc["kind"]), "List") {
+		raw = items
+	}
+	objects := make([]*k8sclient.CachedObject, 0, len(raw))
+	for _, item := range raw {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		objects = append(objects, k8sclient.NormalizeObject(objectGVR(obj), obj, ""))
+	}
+	if spec.Result == ResultMap {
+		if len(objects) != 1 {
+			return nil, errors.New("kubectl map output requires exactly one object")
+		}
+		return k8sclient.BuildCMap(objects[0], spec.Fields)
+	}
+	return k8sclient.BuildCTable(objects, spec.Fields, spec.ColumnNames)
+}
+
+// objectGVR derives "group/version/resource" from an object's apiVersion
+// and kind, naming the resource as the client-go collector does.
+func objectGVR(obj map[string]interface{}) string {
+	return stringValue(obj["apiVersion"]) + "/" + k8sclient.ResourceForKind(stringValue(obj["kind"]))
+}
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
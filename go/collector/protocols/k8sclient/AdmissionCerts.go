@@ -0,0 +1,265 @@
+package k8sclient
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CertValidity is the lifetime of generated CA and serving certificates,
+// CertRenewBefore how long before expiry they are rotated.
+var (
+	CertValidity    = 365 * 24 * time.Hour
+	CertRenewBefore = 30 * 24 * time.Hour
+)
+
+const (
+	caCertFile  = "ca.crt"
+	caKeyFile   = "ca.key"
+	tlsCertFile = "tls.crt"
+	tlsKeyFile  = "tls.key"
+)
+
+// certBundle is a serving certificate with the CA that signed it. The CA
+// key is only known for self-generated bundles.
+type certBundle struct {
+	caPEM    []byte
+	caKeyPEM []byte
+	certPEM  []byte
+	keyPEM   []byte
+	cert     tls.Certificate
+	notAfter time.Time
+}
+
+// dueForRenewal reports whether the serving certificate expires within
+// CertRenewBefore of now.
+func (b *certBundle) dueForRenewal(now time.Time) bool {
+	return b == nil || !now.Add(CertRenewBefore).Before(b.notAfter)
+}
+
+// webhookDNSNames returns the names the API server may use to reach the
+// webhook service.
+func webhookDNSNames(serviceName, namespace string) []string {
+	return []string{
+		serviceName,
+		serviceName + "." + namespace,
+		serviceName + "." + namespace + ".svc",
+		serviceName + "." + namespace + ".svc.cluster.local",
+	}
+}
+
+// generateCertBundle creates a self-signed CA and a serving certificate,
+// signed by it, for the webhook service.
+func generateCertBundle(serviceName, namespace string, now time.Time) (*certBundle, error) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: serviceName + "-webhook-ca"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(CertValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	dnsNames := webhookDNSNames(serviceName, namespace)
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: dnsNames[2]},
+		DNSNames:     dnsNames,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(CertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, err
+	}
+
+	caKeyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return newCertBundle(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: caKeyDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func newCertBundle(caPEM, caKeyPEM, certPEM, keyPEM []byte) (*certBundle, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf = leaf
+	return &certBundle{
+		caPEM:    caPEM,
+		caKeyPEM: caKeyPEM,
+		certPEM:  certPEM,
+		keyPEM:   keyPEM,
+		cert:     cert,
+		notAfter: leaf.NotAfter,
+	}, nil
+}
+
+// loadCertBundle reads tls.crt, tls.key and, when present, ca.crt and
+// ca.key from dir.
+func loadCertBundle(dir string) (*certBundle, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, tlsCertFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, tlsKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TLS private key: %w", err)
+	}
+	caPEM, _ := os.ReadFile(filepath.Join(dir, caCertFile))
+	caKeyPEM, _ := os.ReadFile(filepath.Join(dir, caKeyFile))
+	return newCertBundle(caPEM, caKeyPEM, certPEM, keyPEM)
+}
+
+// writeCertBundle stores the bundle in dir so that a restarted collector
+// keeps serving with the CA already registered in the webhook.
+func writeCertBundle(dir string, bundle *certBundle) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{caCertFile, bundle.caPEM},
+		{caKeyFile, bundle.caKeyPEM},
+		{tlsKeyFile, bundle.keyPEM},
+		{tlsCertFile, bundle.certPEM},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file.name), file.data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// servesNames reports whether the bundle's certificate is valid for every
+// name and is signed by its CA.
+func (b *certBundle) servesNames(names []string) bool {
+	if len(b.caPEM) == 0 {
+		return false
+	}
+	for _, name := range names {
+		if b.cert.Leaf.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(b.caPEM) {
+		return false
+	}
+	_, err := b.cert.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: names[0]})
+	return err == nil
+}
+
+// certStore holds the certificate served by the admission server. It is
+// read on every TLS handshake, so replacing it takes effect without
+// restarting the server.
+type certStore struct {
+	mu      sync.RWMutex
+	bundle  *certBundle
+	modTime time.Time
+}
+
+func (s *certStore) set(bundle *certBundle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bundle = bundle
+}
+
+func (s *certStore) current() *certBundle {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.bundle
+}
+
+// getCertificate implements tls.Config.GetCertificate.
+func (s *certStore) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	bundle := s.current()
+	if bundle == nil {
+		return nil, errors.New("admission server has no certificate")
+	}
+	return &bundle.cert, nil
+}
+
+// reloadIfChanged loads the certificate files of dir again when they
+// were modified, e.g. by cert-manager or a mounted secret update. It
+// reports whether a new certificate is served.
+func (s *certStore) reloadIfChanged(dir string) (bool, error) {
+	info, err := os.Stat(filepath.Join(dir, tlsCertFile))
+	if err != nil {
+		return false, err
+	}
+	s.mu.RLock()
+	unchanged := s.bundle != nil && info.ModTime().Equal(s.modTime)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	bundle, err := loadCertBundle(dir)
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bundle != nil && bytes.Equal(s.bundle.certPEM, bundle.certPEM) {
+		s.modTime = info.ModTime()
+		return false, nil
+	}
+	s.bundle = bundle
+	s.modTime = info.ModTime()
+	return true, nil
+}
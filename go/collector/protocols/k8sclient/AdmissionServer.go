@@ -1,54 +1,155 @@
 package k8sclient
 
 import (
-	"fmt"
+	"crypto/tls"
+	"errors"
+	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/saichler/l8types/go/ifs"
-	"github.com/saichler/l8web/go/web/server"
 )
 
+const serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// admissionServer is the running admission HTTPS endpoint. Its certificate
+// is read from a certStore on every handshake, so rotated certificates are
+// served without restarting it.
+type admissionServer struct {
+	server  *http.Server
+	store   *certStore
+	manager *webhookManager
+	runtime *clusterRuntime
+	certDir string
+	stopCh  chan struct{}
+	stopped bool
+}
+
+// StartAdmissionServer starts the admission webhook endpoint.
+//
+// By default it serves the tls.crt/tls.key of ADMISSION_CERT_DIR, reloading
+// them whenever they change on disk. With ADMISSION_MANAGE_WEBHOOK=true the
+// collector manages the webhook itself: it generates and rotates a
+// self-signed CA and serving certificate, applies the
+// ValidatingWebhookConfiguration with that CA as caBundle, and removes the
+// configuration when the server stops.
 func (c *ClientGoCollector) StartAdmissionServer(resources ifs.IResources) error {
 	port, err := envInt("ADMISSION_PORT", 8443)
 	if err != nil {
 		return err
 	}
-
+	path := envString("ADMISSION_PATH", DefaultAdmissionPath)
 	certDir := envString("ADMISSION_CERT_DIR", "/data/admission")
-	certData, err := os.ReadFile(certDir + "/tls.crt")
-	if err != nil {
-		return fmt.Errorf("failed to read TLS certificate: %w", err)
-	}
-	keyData, err := os.ReadFile(certDir + "/tls.key")
-	if err != nil {
-		return fmt.Errorf("failed to read TLS private key: %w", err)
-	}
+	logger := c.logger()
 
-	serverConfig := &server.RestServerConfig{
-		Host:           envString("ADMISSION_HOST", "0.0.0.0"),
-		Port:           port,
-		Authentication: false,
-		Prefix:         "",
-		CertDomain:     string(certData),
-		CertPrivate:    string(keyData),
+	admission := &admissionServer{
+		store:   &certStore{},
+		runtime: c.runtime,
+		certDir: certDir,
+		stopCh:  make(chan struct{}),
 	}
-	svr, err := server.NewRestServer(serverConfig)
-	if err != nil {
+	if envBool("ADMISSION_MANAGE_WEBHOOK") {
+		if c.runtime == nil || c.runtime.client() == nil {
+			return errNotConnected
+		}
+		rules, err := WebhookRulesFromBootModels()
+		if err != nil {
+			return err
+		}
+		admission.manager = newWebhookManager(WebhookConfigOptions{
+			Name:        envString("ADMISSION_WEBHOOK_NAME", "l8collector-k8s"),
+			ServiceName: envString("ADMISSION_SERVICE", "l8collector"),
+			Namespace:   envString("ADMISSION_NAMESPACE", podNamespace()),
+			Path:        path,
+		}, rules, certDir, c.runtime.client(), admission.store)
+		if err = admission.manager.start(logger, time.Now()); err != nil {
+			return err
+		}
+	} else if _, err = admission.store.reloadIfChanged(certDir); err != nil {
 		return err
 	}
-	err = c.RegisterAdmissionHandler(svr.(*server.RestServer), envString("ADMISSION_PATH", DefaultAdmissionPath))
+
+	handler, err := c.AdmissionHandler()
 	if err != nil {
 		return err
 	}
+	mux := http.NewServeMux()
+	mux.Handle(path, handler)
+	admission.server = &http.Server{
+		Addr:      envString("ADMISSION_HOST", "0.0.0.0") + ":" + strconv.Itoa(port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{GetCertificate: admission.store.getCertificate},
+	}
 	go func() {
-		if startErr := svr.Start(); startErr != nil {
+		startErr := admission.server.ListenAndServeTLS("", "")
+		if startErr != nil && !errors.Is(startErr, http.ErrServerClosed) && resources != nil {
 			resources.Logger().Error("Admission web server stopped: ", startErr.Error())
 		}
 	}()
+	go admission.watchCertificates(logger)
+	shared.setAdmissionServer(admission)
 	return nil
 }
 
+// watchCertificates rotates the managed certificate before it expires, or
+// reloads the certificate files when they change, until the server stops.
+func (a *admissionServer) watchCertificates(logger ifs.ILogger) {
+	ticker := time.NewTicker(CertCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stopCh:
+			return
+		case <-ticker.C:
+		}
+		var err error
+		if a.manager != nil {
+			_, err = a.manager.rotateIfDue(logger, time.Now())
+		} else {
+			var reloaded bool
+			reloaded, err = a.store.reloadIfChanged(a.certDir)
+			if reloaded && logger != nil {
+				logger.Info("admission server: reloaded certificate from ", a.certDir)
+			}
+		}
+		if err != nil && logger != nil {
+			logger.Error("admission server certificates: ", err.Error())
+		}
+	}
+}
+
+// stop removes a managed webhook configuration and closes the server.
+func (a *admissionServer) stop(logger ifs.ILogger) {
+	if a.stopped {
+		return
+	}
+	a.stopped = true
+	close(a.stopCh)
+	if a.manager != nil {
+		if err := a.manager.remove(); err != nil && logger != nil {
+			logger.Error("admission webhook ", a.manager.options.Name, ": failed to remove configuration: ", err.Error())
+		}
+	}
+	if a.server != nil {
+		a.server.Close()
+	}
+	if logger != nil {
+		logger.Info("admission server: stopped")
+	}
+}
+
+// podNamespace returns the namespace the collector runs in, falling back
+// to the default namespace of the webhook config tool.
+func podNamespace() string {
+	data, err := os.ReadFile(serviceAccountNamespaceFile)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		return strings.TrimSpace(string(data))
+	}
+	return "probler-k8s-admin"
+}
+
 func envString(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -64,3 +165,8 @@ func envInt(key string, fallback int) (int, error) {
 	}
 	return strconv.Atoi(value)
 }
+
+func envBool(key string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(key))
+	return value
+}
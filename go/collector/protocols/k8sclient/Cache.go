@@ -1,9 +1,15 @@
 package k8sclient
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
 )
 
 // CachedObject is the normalized cache entry served by Exec(job).
@@ -17,36 +23,129 @@ type CachedObject struct {
 	Object          map[string]interface{}
 	Related         []map[string]interface{}
 	ObservedAt      int64
+
+	// relatedObjects are the objects Related resolves to, set on the
+	// copies served to jobs reading "related.*" fields.
+	relatedObjects map[string]*CachedObject
 }
 
 // CollectorCache stores normalized Kubernetes objects for cache-backed reads.
+//
+// Besides the primary map it maintains secondary indexes by GVR, namespace,
+// GVR+namespace, owner UID and label pair, updated on Upsert and Delete, so
+// that lookups cost in proportion to the result rather than the cache size.
 type CollectorCache struct {
-	lock    sync.RWMutex
-	objects map[string]*CachedObject
+	lock           sync.RWMutex
+	objects        map[string]*CachedObject
+	byGVR          map[string]keySet
+	byNamespace    map[string]keySet
+	byGVRNamespace map[string]keySet
+	byOwner        map[string]keySet
+	byLabel        map[string]keySet
 }
 
+// keySet is a set of primary cache keys.
+type keySet map[string]struct{}
+
 func NewCollectorCache() *CollectorCache {
 	return &CollectorCache{
-		objects: make(map[string]*CachedObject),
+		objects:        make(map[string]*CachedObject),
+		byGVR:          make(map[string]keySet),
+		byNamespace:    make(map[string]keySet),
+		byGVRNamespace: make(map[string]keySet),
+		byOwner:        make(map[string]keySet),
+		byLabel:        make(map[string]keySet),
 	}
 }
 
 func (c *CollectorCache) Upsert(obj *CachedObject) {
+	c.upsertIf(obj, nil)
+}
+
+// UpsertIfNewer stores obj unless the cache already holds the object at
+// the same or a newer resourceVersion, e.g. because another informer
+// delivered it first. It reports whether obj was stored.
+func (c *CollectorCache) UpsertIfNewer(obj *CachedObject) bool {
+	return c.upsertIf(obj, func(order int) bool { return order < 0 })
+}
+
+// UpsertUnlessNewer stores obj unless the cache already holds the object at
+// a newer resourceVersion. It serves admission events, whose object carries
+// the resourceVersion the change was made against: a cached object at that
+// version predates the change. It reports whether obj was stored.
+func (c *CollectorCache) UpsertUnlessNewer(obj *CachedObject) bool {
+	return c.upsertIf(obj, func(order int) bool { return order <= 0 })
+}
+
+// upsertIf stores obj when the cache does not hold the object, their
+// resourceVersions cannot be ordered, or store accepts the order of the
+// cached version relative to obj's. The comparison and the store happen
+// under one lock, so concurrent writers cannot store an older version over
+// a newer one.
+func (c *CollectorCache) upsertIf(obj *CachedObject, store func(order int) bool) bool {
 	if obj == nil {
-		return
+		return false
 	}
 	if obj.ObservedAt == 0 {
 		obj.ObservedAt = time.Now().Unix()
 	}
+	key := cacheKey(obj.GVR, obj.Namespace, obj.Name)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	c.objects[cacheKey(obj.GVR, obj.Namespace, obj.Name)] = obj
+	existing, ok := c.objects[key]
+	if ok && store != nil {
+		if order, comparable := compareResourceVersions(existing.ResourceVersion, obj.ResourceVersion); comparable && !store(order) {
+			return false
+		}
+	}
+	if ok {
+		c.unindex(key, existing)
+	}
+	c.objects[key] = obj
+	c.index(key, obj)
+	return true
+}
+
+// HasNewer reports whether the cache holds the object at a resourceVersion
+// newer than resourceVersion.
+func (c *CollectorCache) HasNewer(gvr, namespace, name, resourceVersion string) bool {
+	existing, ok := c.Get(gvr, namespace, name)
+	if !ok {
+		return false
+	}
+	order, comparable := compareResourceVersions(existing.ResourceVersion, resourceVersion)
+	return comparable && order > 0
+}
+
+// compareResourceVersions orders two resourceVersions. They are opaque to
+// clients, but the API server derives them from the etcd revision, so
+// numeric versions are compared as numbers; otherwise only equality is
+// known.
+func compareResourceVersions(a, b string) (int, bool) {
+	if a == "" || b == "" {
+		return 0, false
+	}
+	x, errA := strconv.ParseUint(a, 10, 64)
+	y, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA != nil || errB != nil:
+		return 0, a == b
+	case x > y:
+		return 1, true
+	case x < y:
+		return -1, true
+	}
+	return 0, true
 }
 
 func (c *CollectorCache) Delete(gvr, namespace, name string) {
+	key := cacheKey(gvr, namespace, name)
 	c.lock.Lock()
 	defer c.lock.Unlock()
-	delete(c.objects, cacheKey(gvr, namespace, name))
+	if existing, ok := c.objects[key]; ok {
+		c.unindex(key, existing)
+		delete(c.objects, key)
+	}
 }
 
 func (c *CollectorCache) Get(gvr, namespace, name string) (*CachedObject, bool) {
@@ -56,32 +155,193 @@ func (c *CollectorCache) Get(gvr, namespace, name string) (*CachedObject, bool)
 	return obj, ok
 }
 
+// Len returns the number of cached objects.
+func (c *CollectorCache) Len() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return len(c.objects)
+}
+
+// List returns the cached objects of gvr in namespace matching the label
+// selector. An invalid selector matches nothing; use Select to get the
+// parse error.
 func (c *CollectorCache) List(gvr, namespace, selector string) []*CachedObject {
+	result, err := c.Select(gvr, namespace, selector, "")
+	if err != nil {
+		return make([]*CachedObject, 0)
+	}
+	return result
+}
+
+// Select returns the cached objects of gvr in namespace that match both
+// selectors, written in the Kubernetes syntax: labelSelector supports =, ==,
+// !=, in, notin, key and !key; fieldSelector supports =, == and != on any
+// field path such as "spec.nodeName" or "status.phase". Empty arguments
+// match everything.
+//
+// The narrowest applicable index is scanned: GVR+namespace, GVR or
+// namespace, or the label pairs required by the selector.
+func (c *CollectorCache) Select(gvr, namespace, labelSelector, fieldSelector string) ([]*CachedObject, error) {
+	labelSel, fieldSel, err := parseSelectors(labelSelector, fieldSelector)
+	if err != nil {
+		return nil, err
+	}
 	c.lock.RLock()
 	defer c.lock.RUnlock()
-	totalScanned := 0
-	matchedGVR := 0
-	matchedNS := 0
-	matchedSel := 0
 	result := make([]*CachedObject, 0)
-	for _, obj := range c.objects {
+	match := func(obj *CachedObject) {
 		if obj == nil {
-			continue
+			return
 		}
-		totalScanned++
 		if gvr != "" && obj.GVR != gvr {
-			continue
+			return
 		}
-		matchedGVR++
 		if namespace != "" && obj.Namespace != namespace {
+			return
+		}
+		if !matchesSelectors(obj, labelSel, fieldSel) {
+			return
+		}
+		result = append(result, obj)
+	}
+	candidates, indexed := c.candidates(gvr, namespace, labelSel)
+	if !indexed {
+		for _, obj := range c.objects {
+			match(obj)
+		}
+		return result, nil
+	}
+	for key := range candidates {
+		match(c.objects[key])
+	}
+	return result, nil
+}
+
+// ListOwnedBy returns the cached objects whose ownerReferences include the
+// given owner UID.
+func (c *CollectorCache) ListOwnedBy(ownerUID string) []*CachedObject {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	result := make([]*CachedObject, 0, len(c.byOwner[ownerUID]))
+	for key := range c.byOwner[ownerUID] {
+		result = append(result, c.objects[key])
+	}
+	return result
+}
+
+// candidates returns the smallest index set containing every object that
+// can match. indexed is false when no index applies and all objects must be
+// scanned.
+func (c *CollectorCache) candidates(gvr, namespace string, labelSel labels.Selector) (keySet, bool) {
+	var best keySet
+	indexed := false
+	consider := func(set keySet) {
+		if !indexed || len(set) < len(best) {
+			best = set
+			indexed = true
+		}
+	}
+	switch {
+	case gvr != "" && namespace != "":
+		consider(c.byGVRNamespace[cacheKey(gvr, namespace, "")])
+	case gvr != "":
+		consider(c.byGVR[gvr])
+	case namespace != "":
+		consider(c.byNamespace[namespace])
+	}
+	requirements, _ := labelSel.Requirements()
+	for _, requirement := range requirements {
+		switch requirement.Operator() {
+		case selection.Equals, selection.DoubleEquals, selection.In:
+		default:
 			continue
 		}
-		matchedNS++
-		if !matchesSelector(obj, selector) {
+		values := requirement.Values().List()
+		if len(values) == 1 {
+			consider(c.byLabel[labelPair(requirement.Key(), values[0])])
 			continue
 		}
-		matchedSel++
-		result = append(result, obj)
+		union := make(keySet)
+		for _, value := range values {
+			for key := range c.byLabel[labelPair(requirement.Key(), value)] {
+				union[key] = struct{}{}
+			}
+		}
+		consider(union)
+	}
+	return best, indexed
+}
+
+func (c *CollectorCache) index(key string, obj *CachedObject) {
+	addKey(c.byGVR, obj.GVR, key)
+	addKey(c.byNamespace, obj.Namespace, key)
+	addKey(c.byGVRNamespace, cacheKey(obj.GVR, obj.Namespace, ""), key)
+	for _, owner := range ownerUIDs(obj) {
+		addKey(c.byOwner, owner, key)
+	}
+	for label, value := range objectLabels(obj) {
+		addKey(c.byLabel, labelPair(label, value), key)
+	}
+}
+
+func (c *CollectorCache) unindex(key string, obj *CachedObject) {
+	removeKey(c.byGVR, obj.GVR, key)
+	removeKey(c.byNamespace, obj.Namespace, key)
+	removeKey(c.byGVRNamespace, cacheKey(obj.GVR, obj.Namespace, ""), key)
+	for _, owner := range ownerUIDs(obj) {
+		removeKey(c.byOwner, owner, key)
+	}
+	for label, value := range objectLabels(obj) {
+		removeKey(c.byLabel, labelPair(label, value), key)
+	}
+}
+
+func addKey(index map[string]keySet, value, key string) {
+	set, ok := index[value]
+	if !ok {
+		set = make(keySet)
+		index[value] = set
+	}
+	set[key] = struct{}{}
+}
+
+func removeKey(index map[string]keySet, value, key string) {
+	set, ok := index[value]
+	if !ok {
+		return
+	}
+	delete(set, key)
+	if len(set) == 0 {
+		delete(index, value)
+	}
+}
+
+func labelPair(key, value string) string {
+	return key + "=" + value
+}
+
+// ownerUIDs returns the UIDs in the object's metadata.ownerReferences.
+func ownerUIDs(obj *CachedObject) []string {
+	if obj == nil {
+		return nil
+	}
+	ownersRaw, ok := nestedValue(obj.Object, []string{"metadata", "ownerReferences"})
+	if !ok {
+		return nil
+	}
+	owners, ok := ownersRaw.([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(owners))
+	for _, ownerRaw := range owners {
+		owner, ok := ownerRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if uid, _ := owner["uid"].(string); uid != "" {
+			result = append(result, uid)
+		}
 	}
 	return result
 }
@@ -90,35 +350,47 @@ func cacheKey(gvr, namespace, name string) string {
 	return gvr + "::" + namespace + "::" + name
 }
 
-func matchesSelector(obj *CachedObject, selector string) bool {
-	selector = strings.TrimSpace(selector)
-	if selector == "" {
+// parseSelectors parses a label and a field selector. Empty selectors
+// parse to selectors matching everything.
+func parseSelectors(labelSelector, fieldSelector string) (labels.Selector, fields.Selector, error) {
+	labelSel, err := labels.Parse(strings.TrimSpace(labelSelector))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid label selector %q: %w", labelSelector, err)
+	}
+	fieldSel, err := fields.ParseSelector(strings.TrimSpace(fieldSelector))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid field selector %q: %w", fieldSelector, err)
+	}
+	return labelSel, fieldSel, nil
+}
+
+func matchesSelectors(obj *CachedObject, labelSel labels.Selector, fieldSel fields.Selector) bool {
+	if !labelSel.Empty() && !labelSel.Matches(objectLabels(obj)) {
+		return false
+	}
+	if fieldSel.Empty() {
 		return true
 	}
+	set := fields.Set{}
+	for _, requirement := range fieldSel.Requirements() {
+		value, _ := FieldValue(obj, requirement.Field)
+		set[requirement.Field] = stringify(value)
+	}
+	return fieldSel.Matches(set)
+}
+
+func objectLabels(obj *CachedObject) labels.Set {
+	set := labels.Set{}
 	labelsValue, ok := nestedValue(obj.Object, []string{"metadata", "labels"})
 	if !ok {
-		return false
+		return set
 	}
-	labels, ok := labelsValue.(map[string]interface{})
+	values, ok := labelsValue.(map[string]interface{})
 	if !ok {
-		return false
+		return set
 	}
-	parts := strings.Split(selector, ",")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
-		tokens := strings.SplitN(part, "=", 2)
-		if len(tokens) != 2 {
-			return false
-		}
-		key := strings.TrimSpace(tokens[0])
-		expected := strings.TrimSpace(tokens[1])
-		actual, ok := labels[key]
-		if !ok || stringify(actual) != expected {
-			return false
-		}
+	for key, value := range values {
+		set[key] = stringify(value)
 	}
-	return true
+	return set
 }
@@ -1,41 +1,42 @@
 package k8sclient
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // handleResourceDeletion is the single entry point for all delete processing.
 // Called by both the admission webhook handler and the informer DeleteFunc.
-// It removes the object from cache, fires the onDelete callback (forwarding
-// to parser/inventory), and triggers cascade logic for namespace and
-// deployment deletions.
-func handleResourceDeletion(gvrText, namespace, name string) {
+// It removes the object from the cluster's cache, notifies the delete
+// handlers of the cluster's collectors (forwarding to parser/inventory), and
+// cascades to the namespace's contents and to the object's descendants.
+//
+// A deletion seen by both the webhook and the informer is forwarded once:
+// only the first finds the object in the cache.
+func (s *clusterRuntime) handleResourceDeletion(gvrText, namespace, name string) {
 	var uid string
-	if existing, ok := shared.cache.Get(gvrText, namespace, name); ok {
+	if existing, ok := s.cache.Get(gvrText, namespace, name); ok {
 		uid = existing.UID
-	}
-
-	shared.cache.Delete(gvrText, namespace, name)
-	if shared.onDelete != nil {
-		shared.onDelete(gvrText, namespace, name)
+		s.cache.Delete(gvrText, namespace, name)
+		s.notifyDelete(gvrText, namespace, name)
 	}
 
 	if gvrText == "v1/namespaces" {
-		cascadeNamespaceDelete(name)
-	}
-	if gvrText == "apps/v1/deployments" {
-		cascadeDeploymentDelete(namespace, name, uid)
+		s.cascadeNamespaceDelete(name)
 	}
+	s.cascadeOwnedDelete(gvrText, namespace, name, uid)
 }
 
 // cascadeNamespaceDelete removes all cached objects belonging to the
 // given namespace. Called when a namespace DELETE event is received.
 // This handles the case where namespace-scoped informers lose their
 // watch stream before child resource DELETE events fire.
-func cascadeNamespaceDelete(namespace string) {
+func (s *clusterRuntime) cascadeNamespaceDelete(namespace string) {
 	if namespace == "" {
 		return
 	}
 
-	entries := shared.cache.List("", namespace, "")
+	entries := s.cache.List("", namespace, "")
 
 	fmt.Printf("[CASCADE-NS] namespace=%s found=%d cached objects to delete\n",
 		namespace, len(entries))
@@ -44,70 +45,60 @@ func cascadeNamespaceDelete(namespace string) {
 		if entry.GVR == "v1/namespaces" {
 			continue
 		}
-		shared.cache.Delete(entry.GVR, entry.Namespace, entry.Name)
-		if shared.onDelete != nil {
-			shared.onDelete(entry.GVR, entry.Namespace, entry.Name)
-		}
+		s.cache.Delete(entry.GVR, entry.Namespace, entry.Name)
+		s.notifyDelete(entry.GVR, entry.Namespace, entry.Name)
 	}
 }
 
-// cascadeDeploymentDelete removes ReplicaSets and Pods owned by the
-// deleted Deployment. K8s garbage collector deletes these asynchronously,
-// but those DELETE events may be lost if the informer/webhook misses them.
-func cascadeDeploymentDelete(namespace, deploymentName, deploymentUID string) {
-	if namespace == "" || deploymentName == "" {
+// cascadeOwnedDelete removes every cached descendant of the deleted owner,
+// following metadata.ownerReferences through the cache's owner-UID index
+// for any GVR: Deployment→ReplicaSet→Pod, StatefulSet→Pod, CronJob→Job→Pod,
+// custom resources and so on. The Kubernetes garbage collector deletes these
+// asynchronously, but those DELETE events may be lost if the
+// informer/webhook misses them.
+//
+// When the owner was not cached its UID is unknown; its direct children are
+// then found by owner name and kind within its namespace.
+func (s *clusterRuntime) cascadeOwnedDelete(gvrText, namespace, name, uid string) {
+	var children []*CachedObject
+	if uid != "" {
+		children = s.cache.ListOwnedBy(uid)
+	} else if namespace != "" && name != "" {
+		resource := resourceFromGVR(gvrText)
+		for _, candidate := range s.cache.List("", namespace, "") {
+			if ownedByName(candidate, name, resource) {
+				children = append(children, candidate)
+			}
+		}
+	}
+	if len(children) == 0 {
 		return
 	}
 
-	allRS := shared.cache.List("apps/v1/replicasets", namespace, "")
-	var ownedRS []*CachedObject
-	for _, rs := range allRS {
-		if isOwnedBy(rs, deploymentUID, deploymentName, "Deployment") {
-			ownedRS = append(ownedRS, rs)
-		}
+	visited := map[string]bool{}
+	if uid != "" {
+		visited[uid] = true
 	}
-
-	fmt.Printf("[CASCADE-DEPLOY] deployment=%s/%s found=%d owned ReplicaSets\n",
-		namespace, deploymentName, len(ownedRS))
-
-	for _, rs := range ownedRS {
-		rsUID := rs.UID
-		rsName := rs.Name
-
-		pods := shared.cache.List("v1/pods", namespace, "")
-		podCount := 0
-		for _, pod := range pods {
-			if isOwnedBy(pod, rsUID, rsName, "ReplicaSet") {
-				shared.cache.Delete(pod.GVR, pod.Namespace, pod.Name)
-				if shared.onDelete != nil {
-					shared.onDelete(pod.GVR, pod.Namespace, pod.Name)
-				}
-				podCount++
-			}
+	for len(children) > 0 {
+		child := children[0]
+		children = children[1:]
+		if child == nil || (child.UID != "" && visited[child.UID]) {
+			continue
 		}
-		fmt.Printf("[CASCADE-DEPLOY]   rs=%s/%s found=%d owned Pods\n",
-			namespace, rsName, podCount)
-
-		shared.cache.Delete(rs.GVR, rs.Namespace, rs.Name)
-		if shared.onDelete != nil {
-			shared.onDelete(rs.GVR, rs.Namespace, rs.Name)
+		if child.UID != "" {
+			visited[child.UID] = true
+			children = append(children, s.cache.ListOwnedBy(child.UID)...)
 		}
+		s.cache.Delete(child.GVR, child.Namespace, child.Name)
+		s.notifyDelete(child.GVR, child.Namespace, child.Name)
 	}
 }
 
-func isOwnedBy(obj *CachedObject, ownerUID, ownerName, ownerKind string) bool {
-	if obj == nil || obj.Object == nil {
-		return false
-	}
-	metadataRaw, ok := obj.Object["metadata"]
-	if !ok {
-		return false
-	}
-	metadata, ok := metadataRaw.(map[string]interface{})
-	if !ok {
-		return false
-	}
-	ownersRaw, ok := metadata["ownerReferences"]
+// ownedByName reports whether obj has an owner reference with the given
+// name whose kind is served by resource, e.g. kind "Deployment" for
+// "deployments".
+func ownedByName(obj *CachedObject, ownerName, resource string) bool {
+	ownersRaw, ok := nestedValue(obj.Object, []string{"metadata", "ownerReferences"})
 	if !ok {
 		return false
 	}
@@ -120,16 +111,29 @@ func isOwnedBy(obj *CachedObject, ownerUID, ownerName, ownerKind string) bool {
 		if !ok {
 			continue
 		}
-		if ownerUID != "" {
-			if uid, _ := owner["uid"].(string); uid == ownerUID {
-				return true
-			}
-		}
-		if name, _ := owner["name"].(string); name == ownerName {
-			if kind, _ := owner["kind"].(string); kind == ownerKind {
-				return true
-			}
+		name, _ := owner["name"].(string)
+		kind, _ := owner["kind"].(string)
+		if name == ownerName && ResourceForKind(kind) == resource {
+			return true
 		}
 	}
 	return false
 }
+
+// ResourceForKind returns the conventional resource name of a kind: its
+// lowercase English plural, e.g. "Deployment" → "deployments",
+// "Ingress" → "ingresses", "NetworkPolicy" → "networkpolicies".
+func ResourceForKind(kind string) string {
+	kind = strings.ToLower(kind)
+	switch {
+	case kind == "":
+		return ""
+	case kind == "endpoints":
+		return kind
+	case strings.HasSuffix(kind, "s"), strings.HasSuffix(kind, "x"), strings.HasSuffix(kind, "ch"), strings.HasSuffix(kind, "sh"):
+		return kind + "es"
+	case strings.HasSuffix(kind, "y") && !strings.HasSuffix(kind, "ay") && !strings.HasSuffix(kind, "ey") && !strings.HasSuffix(kind, "oy"):
+		return kind[:len(kind)-1] + "ies"
+	}
+	return kind + "s"
+}
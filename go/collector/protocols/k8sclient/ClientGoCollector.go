@@ -1,17 +1,21 @@
 package k8sclient
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/saichler/l8pollaris/go/pollaris"
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 	"github.com/saichler/l8srlz/go/serialize/object"
 	"github.com/saichler/l8types/go/ifs"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/dynamicinformer"
@@ -22,21 +26,44 @@ import (
 
 // ClientGoCollector is a cache-first Kubernetes collector.
 //
-// All instances share a single connection, cache, and set of informers via
-// the package-level shared runtime. Instance fields hold convenience
-// references obtained from the shared runtime at Init/Connect time.
+// Instances pointing at the same cluster share one connection, cache, set of
+// informers and reaper through a reference-counted cluster runtime; instances
+// pointing at different clusters are fully isolated. The runtime is attached
+// at Connect time and released at Disconnect.
 type ClientGoCollector struct {
 	resources ifs.IResources
 	config    *l8tpollaris.L8PHostProtocol
+	runtime   *clusterRuntime
+
+	mu            sync.Mutex
+	onDelete      func(gvrText, namespace, name string)
+	streamHandler func(*l8tpollaris.CJob)
+	streams       map[string]*eventStream
+	logPositions  map[string]logPosition
 }
 
 func (c *ClientGoCollector) Init(config *l8tpollaris.L8PHostProtocol, resources ifs.IResources) error {
 	c.resources = resources
 	c.config = config
-	shared.init()
 	return c.ensureAdmissionServerStarted()
 }
 
+// SetDeleteHandler registers the function called whenever a resource of
+// this collector's cluster is deleted, whether observed by an informer, the
+// admission webhook, a cascade or the reaper. It implements
+// common.DeleteCollector.
+func (c *ClientGoCollector) SetDeleteHandler(handler func(gvrText, namespace, name string)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onDelete = handler
+}
+
+func (c *ClientGoCollector) deleteHandler() func(gvrText, namespace, name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.onDelete
+}
+
 func (c *ClientGoCollector) Protocol() l8tpollaris.L8PProtocol {
 	if c.config != nil {
 		return c.config.Protocol
@@ -47,7 +74,7 @@ func (c *ClientGoCollector) Protocol() l8tpollaris.L8PProtocol {
 func (c *ClientGoCollector) Exec(job *l8tpollaris.CJob) {
 	c.log(ifs.Debug_Level, "Exec start pollaris=%s job=%s target=%s", job.PollarisName, job.JobName, job.TargetId)
 
-	if !shared.connected {
+	if !c.Online() {
 		if err := c.Connect(); err != nil {
 			c.log(ifs.Debug_Level, "Exec connect error: %s", err.Error())
 			job.Error = err.Error()
@@ -74,20 +101,50 @@ func (c *ClientGoCollector) Exec(job *l8tpollaris.CJob) {
 
 	namespace := resolveSpecValue(spec.Namespace, spec.NamespaceFromArg, job.Arguments)
 	name := resolveSpecValue(spec.Name, spec.NameFromArg, job.Arguments)
+	selector := resolveSpecValue(spec.Selector, spec.SelectorFromArg, job.Arguments)
+	fieldSelector := resolveSpecValue(spec.FieldSelector, spec.FieldSelectorFromArg, job.Arguments)
+
+	if spec.Mode == ModeEventsStream {
+		c.execEventsStream(job, spec, namespace, selector, fieldSelector)
+		if job.Error == "" {
+			job.ErrorCount = 0
+		}
+		return
+	}
 
-	if err = c.ensureWatching(spec.GVR, namespace); err != nil {
-		c.log(ifs.Debug_Level, "Exec warm error: %s", err.Error())
+	if err = c.applySpec(spec); err != nil {
 		job.Error = err.Error()
 		job.ErrorCount++
 		return
 	}
+	registerJobLinksId(spec, job)
+
+	if spec.watched() {
+		watchLabels, watchFields := spec.watchSelectors()
+		if err = c.ensureWatching(spec.GVR, namespace, watchLabels, watchFields); err != nil {
+			c.log(ifs.Debug_Level, "Exec warm error: %s", err.Error())
+			job.Error = err.Error()
+			job.ErrorCount++
+			return
+		}
+		if err = c.ensureRelations(spec, namespace); err != nil {
+			job.Error = err.Error()
+			job.ErrorCount++
+			return
+		}
+	}
 
-	switch spec.Result {
-	case ResultMap:
+	switch {
+	case isMetricsGVR(spec.GVR):
+		c.execMetrics(job, spec, namespace, name, selector, fieldSelector)
+	case spec.Result == ResultGraph:
+		c.execGraph(job, spec, namespace)
+	case spec.Mode == ModeLogs:
+		c.execLogs(job, spec, namespace, name, selector, fieldSelector)
+	case spec.Result == ResultMap:
 		c.execMap(job, spec, namespace, name)
-	case ResultTable:
-		selector := resolveSpecValue(spec.Selector, spec.SelectorFromArg, job.Arguments)
-		c.execTable(job, spec, namespace, selector)
+	case spec.Result == ResultTable:
+		c.execTable(job, spec, namespace, selector, fieldSelector)
 	default:
 		job.Error = "unsupported cache result type " + spec.Result
 		job.ErrorCount++
@@ -102,12 +159,14 @@ func (c *ClientGoCollector) Exec(job *l8tpollaris.CJob) {
 }
 
 func (c *ClientGoCollector) execMap(job *l8tpollaris.CJob, spec *CacheSpec, namespace, name string) {
-	item, ok := shared.cache.Get(spec.GVR, namespace, name)
+	item, ok := c.runtime.cache.Get(spec.GVR, namespace, name)
 	if !ok {
 		job.Error = fmt.Sprintf("cache miss for %s/%s/%s", spec.GVR, namespace, name)
 		job.ErrorCount++
 		return
 	}
+	item = c.withMetrics(spec, namespace, []*CachedObject{item})[0]
+	item = withRelated(c.runtime.cache, spec.Fields, []*CachedObject{item})[0]
 	cmap, err := BuildCMap(item, spec.Fields)
 	if err != nil {
 		job.Error = err.Error()
@@ -123,8 +182,15 @@ func (c *ClientGoCollector) execMap(job *l8tpollaris.CJob, spec *CacheSpec, name
 	job.Result = enc.Data()
 }
 
-func (c *ClientGoCollector) execTable(job *l8tpollaris.CJob, spec *CacheSpec, namespace, selector string) {
-	items := shared.cache.List(spec.GVR, namespace, selector)
+func (c *ClientGoCollector) execTable(job *l8tpollaris.CJob, spec *CacheSpec, namespace, selector, fieldSelector string) {
+	items, err := c.runtime.cache.Select(spec.GVR, namespace, selector, fieldSelector)
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	items = c.withMetrics(spec, namespace, items)
+	items = withRelated(c.runtime.cache, spec.Fields, items)
 	tbl, err := BuildCTable(items, spec.Fields, spec.ColumnNames)
 	if err != nil {
 		job.Error = err.Error()
@@ -140,21 +206,73 @@ func (c *ClientGoCollector) execTable(job *l8tpollaris.CJob, spec *CacheSpec, na
 	job.Result = enc.Data()
 }
 
+// withMetrics joins the readings of the metrics APIs the spec asks for onto
+// items. Inventory is served even when the metrics APIs are unavailable,
+// e.g. without metrics-server, so a failed read is only logged.
+func (c *ClientGoCollector) withMetrics(spec *CacheSpec, namespace string, items []*CachedObject) []*CachedObject {
+	if !spec.Metrics && len(spec.CustomMetrics) == 0 {
+		return items
+	}
+	joined, err := c.joinMetrics(spec, namespace, items)
+	if err != nil {
+		c.log(ifs.Warning_Level, "metrics for %s unavailable: %s", spec.GVR, err.Error())
+	}
+	return joined
+}
+
+// Connect resolves the collector's cluster, attaches it to that cluster's
+// runtime and makes sure the runtime is connected and reaping.
 func (c *ClientGoCollector) Connect() error {
-	shared.init()
-	_, _, err := shared.connect(c.kubeConfig)
-	return err
+	cfg, err := c.kubeConfig()
+	if err != nil {
+		return err
+	}
+	key := clusterKey(cfg)
+	if c.runtime != nil && c.runtime.key != key {
+		shared.release(c.runtime, c, c.logger())
+		c.runtime = nil
+	}
+	if c.runtime == nil {
+		c.runtime = shared.acquire(key, c)
+	}
+	if _, err = c.runtime.connect(cfg); err != nil {
+		return err
+	}
+	c.runtime.restoreSnapshot(c.logger())
+	c.runtime.startSnapshots(c.logger())
+	c.runtime.startReaper(c.logger())
+	return nil
 }
 
+// Disconnect detaches the collector from its cluster runtime. The runtime,
+// with its informers and reaper, is only torn down when the last collector
+// of that cluster disconnects.
 func (c *ClientGoCollector) Disconnect() error {
-	shared.disconnect(c.logger())
+	c.stopStreams()
+	if c.runtime != nil {
+		shared.release(c.runtime, c, c.logger())
+		c.runtime = nil
+	}
+	c.SetDeleteHandler(nil)
+	c.mu.Lock()
+	c.logPositions = nil
+	c.mu.Unlock()
 	c.resources = nil
 	c.config = nil
 	return nil
 }
 
+// ReaperStats returns the statistics of the last reconciliation cycle of
+// the collector's cluster.
+func (c *ClientGoCollector) ReaperStats() ReaperStats {
+	if c.runtime == nil {
+		return ReaperStats{}
+	}
+	return c.runtime.reaperStatsSnapshot()
+}
+
 func (c *ClientGoCollector) Online() bool {
-	return shared.connected
+	return c.runtime != nil && c.runtime.isConnected()
 }
 
 // AdmissionHandler returns an HTTP handler that processes Kubernetes
@@ -179,7 +297,6 @@ func (c *ClientGoCollector) ensureAdmissionServerStarted() error {
 		if err := c.Connect(); err != nil {
 			return err
 		}
-		shared.startReaper()
 		return c.StartAdmissionServer(c.resources)
 	})
 }
@@ -189,120 +306,247 @@ func (c *ClientGoCollector) handleAdmissionEvent(event AdmissionEvent) error {
 	if event.Group != "" {
 		gvrText = event.Group + "/" + gvrText
 	}
-	if err := c.ensureWatching(gvrText, event.Namespace); err != nil {
+	// The API server may report the request in another served version
+	// than the one the polls ask for; cache it under the polled GVR.
+	gvrText = canonicalGVR(gvrText)
+	if !c.Online() {
+		if err := c.Connect(); err != nil {
+			return err
+		}
+	}
+	if err := c.ensureWatching(gvrText, event.Namespace, "", ""); err != nil {
 		return err
 	}
 	// The informer started by ensureWatching will observe the same
 	// mutation via the API server watch stream. We update the cache here
 	// as well for lower latency on the first event before the informer
-	// catches up.
+	// catches up. The object carries the resourceVersion the change was
+	// made against: when the informer already cached a newer one, the
+	// event is stale and dropped, without waking any host. Otherwise the
+	// informer's copy of the change, at the new resourceVersion, replaces
+	// this one once it arrives, and redeliveries of it are dropped. A
+	// deletion is only processed once, by whichever of the two sees it
+	// first.
 	if event.Operation == "DELETE" {
-		handleResourceDeletion(gvrText, event.Namespace, event.Name)
+		c.runtime.handleResourceDeletion(gvrText, event.Namespace, event.Name)
 		return nil
 	}
-	if event.Object != nil {
-		shared.cache.Upsert(normalizeObject(gvrText, event.Object, event.Operation))
+	if event.Object == nil || !c.runtime.cache.UpsertUnlessNewer(cacheObject(gvrText, event.Object, event.Operation)) {
+		return nil
+	}
+	shared.notifySubscribers(gvrText, event.Namespace)
+	return nil
+}
+
+// applySpec registers the enrichers, projection and relations declared by
+// spec. When they add fields, objects of the GVR cached before are
+// normalized again so that the fields are available on the first poll.
+func (c *ClientGoCollector) applySpec(spec *CacheSpec) error {
+	changed, err := registerSpecEnrichers(spec)
+	if err != nil {
+		return err
+	}
+	if registerSpecProjection(spec) {
+		changed = true
+	}
+	if registerSpecRelations(spec) {
+		changed = true
+	}
+	if changed && c.runtime != nil {
+		c.runtime.refreshGVR(spec.GVR)
 	}
-	shared.notifySubscribers()
 	return nil
 }
 
 // ensureWatching starts an informer for the given GVR+namespace exactly
 // once, using sync.Once per warm key to prevent duplicate informers.
 //
-// If an all-namespace informer is already running for this GVR, a
-// namespace-specific request is a no-op (the all-namespace informer
-// already covers it). This prevents duplicate watches.
-func (c *ClientGoCollector) ensureWatching(gvrText, namespace string) error {
-	if shared.dynamicClient == nil || gvrText == "" {
-		return nil
-	}
-
-	// If an all-namespace informer already covers this GVR, skip.
-	allNsKey := cacheKey(gvrText, "", "*")
-	if namespace != "" && shared.isWarmed(allNsKey) {
+// Label and field selectors are pushed down to the informer's list and
+// watch, so only matching objects are transferred and cached. A field
+// selector the API server does not support for the resource is dropped from
+// the watch; the cache still applies it when serving the job.
+//
+// An informer already covering the request makes it a no-op: an unfiltered
+// informer of the namespace or of all namespaces covers any selector, and an
+// all-namespace informer with the same selectors covers a namespace. This
+// prevents duplicate watches. The covering informer is marked as used, so
+// that it is not stopped as idle.
+func (c *ClientGoCollector) ensureWatching(gvrText, namespace, labelSelector, fieldSelector string) error {
+	if c.runtime == nil || c.runtime.client() == nil || gvrText == "" {
 		return nil
 	}
-
-	warmKey := cacheKey(gvrText, namespace, "*")
-	if shared.isWarmed(warmKey) {
-		return nil
+	rt := c.runtime
+
+	warmKey := watchKey(gvrText, namespace, labelSelector, fieldSelector)
+	for _, key := range []string{
+		watchKey(gvrText, "", "", ""),
+		watchKey(gvrText, namespace, "", ""),
+		watchKey(gvrText, "", labelSelector, fieldSelector),
+		warmKey,
+	} {
+		if rt.isWarmed(key) {
+			rt.touch(key)
+			return nil
+		}
 	}
 
 	var startErr error
-	once := shared.onceForKey(warmKey)
+	once := rt.onceForKey(warmKey)
 	once.Do(func() {
 		gvr, err := ParseGVR(gvrText)
 		if err != nil {
 			startErr = err
 			return
 		}
-		startErr = c.startInformer(gvr, gvrText, namespace, warmKey)
-		if startErr == nil {
-			shared.markWarmed(warmKey)
+		if served := rt.servedGVR(gvr); served != gvr {
+			c.log(ifs.Debug_Level, "%s is not served, watching %s", gvrText, served.String())
+			gvr = served
 		}
+		if fieldSelector != "" {
+			if err = probeFieldSelector(rt, gvr, namespace, fieldSelector); err != nil {
+				c.log(ifs.Debug_Level, "field selector %q not supported for %s, filtering in cache: %s",
+					fieldSelector, gvrText, err.Error())
+				fieldSelector = ""
+			}
+		}
+		startErr = c.startInformer(rt, gvr, gvrText, namespace, labelSelector, fieldSelector, warmKey)
 	})
 	return startErr
 }
 
-func (c *ClientGoCollector) startInformer(gvr schema.GroupVersionResource, gvrText, namespace, warmKey string) error {
-	c.log(ifs.Debug_Level, "startInformer gvr=%s namespace=%s", gvrText, namespace)
-	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(shared.dynamicClient, 0, namespace, nil)
+// watchKey identifies an informer by GVR, namespace and selectors.
+func watchKey(gvrText, namespace, labelSelector, fieldSelector string) string {
+	if labelSelector == "" && fieldSelector == "" {
+		return cacheKey(gvrText, namespace, "*")
+	}
+	return cacheKey(gvrText, namespace, "*|"+labelSelector+"|"+fieldSelector)
+}
+
+// probeFieldSelector lists a single object with the field selector to learn
+// whether the API server supports it. Watching with an unsupported field
+// selector would keep the informer from ever syncing.
+func probeFieldSelector(rt *clusterRuntime, gvr schema.GroupVersionResource, namespace, fieldSelector string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	options := metav1.ListOptions{FieldSelector: fieldSelector, Limit: 1}
+	var err error
+	if namespace == "" {
+		_, err = rt.client().Resource(gvr).List(ctx, options)
+	} else {
+		_, err = rt.client().Resource(gvr).Namespace(namespace).List(ctx, options)
+	}
+	return err
+}
+
+func (c *ClientGoCollector) startInformer(rt *clusterRuntime, gvr schema.GroupVersionResource, gvrText, namespace, labelSelector, fieldSelector, warmKey string) error {
+	c.log(ifs.Debug_Level, "startInformer cluster=%s gvr=%s namespace=%s labels=%q fields=%q",
+		rt.key, gvrText, namespace, labelSelector, fieldSelector)
+	filtered := labelSelector != "" || fieldSelector != ""
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(rt.client(), InformerResync, namespace, func(options *metav1.ListOptions) {
+		options.LabelSelector = labelSelector
+		options.FieldSelector = fieldSelector
+	})
 	informer := factory.ForResource(gvr).Informer()
+	if err := informer.SetTransform(pruneTransform); err != nil {
+		return err
+	}
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			item, ok := obj.(*unstructured.Unstructured)
 			if !ok {
 				return
 			}
-			shared.cache.Upsert(normalizeObject(gvrText, item, "ADD"))
+			rt.cache.UpsertIfNewer(cacheObject(gvrText, item, "ADD"))
 		},
-		UpdateFunc: func(_, obj interface{}) {
+		UpdateFunc: func(old, obj interface{}) {
 			item, ok := obj.(*unstructured.Unstructured)
 			if !ok {
 				return
 			}
-			shared.cache.Upsert(normalizeObject(gvrText, item, "UPDATE"))
+			// A resync delivers the object unchanged; it is stored again
+			// to refresh its computed fields, unless the cache is ahead.
+			if previous, ok := old.(*unstructured.Unstructured); ok && previous.GetResourceVersion() == item.GetResourceVersion() {
+				if !rt.cache.HasNewer(gvrText, item.GetNamespace(), item.GetName(), item.GetResourceVersion()) {
+					rt.cache.Upsert(cacheObject(gvrText, item, "UPDATE"))
+				}
+				return
+			}
+			rt.cache.UpsertIfNewer(cacheObject(gvrText, item, "UPDATE"))
 		},
 		DeleteFunc: func(obj interface{}) {
 			item, ok := extractDeletedObject(obj)
 			if !ok {
 				return
 			}
-			handleResourceDeletion(gvrText, item.GetNamespace(), item.GetName())
+			// A filtered informer also reports objects that merely stopped
+			// matching its selectors. While an unfiltered informer covers
+			// the namespace, only that one reports real deletions.
+			if filtered && (rt.isWarmed(watchKey(gvrText, "", "", "")) || rt.isWarmed(watchKey(gvrText, item.GetNamespace(), "", ""))) {
+				return
+			}
+			rt.handleResourceDeletion(gvrText, item.GetNamespace(), item.GetName())
 		},
 	})
-	factory.Start(shared.stopCh)
-	if !cache.WaitForCacheSync(shared.stopCh, informer.HasSynced) {
+	watched := newWatchedInformer(rt, warmKey, gvrText, namespace, labelSelector, fieldSelector)
+	watched.informer = informer
+	factory.Start(watched.stopCh)
+	if rt.takeRestored(warmKey) {
+		// The snapshot serves the informer while it syncs.
+		rt.markWarmed(watched)
+		go func() {
+			if !cache.WaitForCacheSync(watched.stopCh, informer.HasSynced) {
+				c.log(ifs.Warning_Level, "startInformer %s: stopped before syncing, serving the snapshot", warmKey)
+				return
+			}
+			c.seedFromInformer(rt, watched)
+			c.reconcileInformer(rt, watched)
+			rt.clearRestored(gvrText)
+		}()
+		return nil
+	}
+	if !cache.WaitForCacheSync(watched.stopCh, informer.HasSynced) {
+		watched.stop()
 		return fmt.Errorf("failed to sync informer cache for %s", warmKey)
 	}
-	// Seed the collector cache from the informer's store to guarantee all
-	// objects are available before the first poll. The async AddFunc
-	// callbacks may not have finished yet, but the store is complete.
-	for _, obj := range informer.GetStore().List() {
+	rt.markWarmed(watched)
+	c.seedFromInformer(rt, watched)
+	c.reconcileInformer(rt, watched)
+	return nil
+}
+
+// reconcileInformer removes the cached objects the synced informer no
+// longer lists, restored from a snapshot or left from a previous informer.
+func (c *ClientGoCollector) reconcileInformer(rt *clusterRuntime, watched *watchedInformer) {
+	if deleted := rt.reconcileRestored(watched); deleted > 0 {
+		c.log(ifs.Info_Level, "startInformer %s: %d objects were deleted while not watched", watched.key, deleted)
+	}
+}
+
+// seedFromInformer copies the informer's store into the collector cache to
+// guarantee all objects are available before the first poll. The async
+// AddFunc callbacks may not have finished yet, but the store is complete.
+func (c *ClientGoCollector) seedFromInformer(rt *clusterRuntime, watched *watchedInformer) {
+	items := watched.informer.GetStore().List()
+	for _, obj := range items {
 		item, ok := obj.(*unstructured.Unstructured)
 		if !ok {
 			continue
 		}
-		shared.cache.Upsert(normalizeObject(gvrText, item, "ADD"))
+		rt.cache.UpsertIfNewer(cacheObject(watched.gvrText, item, "ADD"))
 	}
-	c.log(ifs.Debug_Level, "startInformer synced warmKey=%s cached=%d", warmKey, len(informer.GetStore().List()))
-	return nil
+	c.log(ifs.Debug_Level, "startInformer synced warmKey=%s cached=%d", watched.key, len(items))
 }
 
+// kubeConfig resolves the configuration of the collector's cluster: the
+// target's kubeconfig credential, then KUBECONFIG, then an admin.conf in
+// the working directory and last the in-cluster configuration. The target's
+// credential comes first so that a collector running in a pod still reaches
+// the cluster of every target instead of its own.
 func (c *ClientGoCollector) kubeConfig() (*rest.Config, error) {
-	cfg, err := rest.InClusterConfig()
-	if err == nil {
-		return cfg, nil
-	}
 	if c.resources != nil && c.config != nil && c.config.CredId != "" {
 		_, _, kubeconfig, _, credErr := c.resources.Security().Credential(c.config.CredId, "kubeconfig", c.resources)
 		if credErr == nil {
-			cfg, cfgErr := restConfigFromString(kubeconfig)
-			if cfgErr == nil {
-				return cfg, nil
-			}
-			return nil, cfgErr
+			return restConfigFromString(kubeconfig)
 		}
 	}
 	envPath := os.Getenv("KUBECONFIG")
@@ -321,7 +565,7 @@ func (c *ClientGoCollector) kubeConfig() (*rest.Config, error) {
 			return cfg, nil
 		}
 	}
-	return nil, err
+	return rest.InClusterConfig()
 }
 
 func restConfigFromString(kubeconfig string) (*rest.Config, error) {
@@ -336,11 +580,19 @@ func restConfigFromString(kubeconfig string) (*rest.Config, error) {
 	return clientcmd.RESTConfigFromKubeConfig(data)
 }
 
+// NormalizeObject converts a raw Kubernetes object, as returned by the API
+// server or "kubectl -o json", into a CachedObject with the same computed
+// "_k" fields the informers produce. gvr is "group/version/resource".
+func NormalizeObject(gvr string, obj map[string]interface{}, operation string) *CachedObject {
+	return normalizeObject(gvr, &unstructured.Unstructured{Object: obj}, operation)
+}
+
 func normalizeObject(gvr string, item *unstructured.Unstructured, operation string) *CachedObject {
 	if item == nil {
 		return nil
 	}
 	obj := item.DeepCopy().Object
+	pruneObject(obj)
 	enrichObject(gvr, obj)
 	return &CachedObject{
 		GVR:             gvr,
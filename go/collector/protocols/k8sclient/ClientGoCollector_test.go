@@ -2,19 +2,34 @@ package k8sclient
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 	"github.com/saichler/l8srlz/go/serialize/object"
+	"github.com/saichler/l8types/go/ifs"
+	"github.com/saichler/l8utils/go/utils/registry"
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	kubetesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/yaml"
 )
 
@@ -308,3 +323,1397 @@ users:
 		t.Fatalf("unexpected host: %s", cfg.Host)
 	}
 }
+
+func TestClusterRuntimesAreIsolatedAndRefCounted(t *testing.T) {
+	east := clusterKey(&rest.Config{Host: "https://east:6443", BearerToken: "a"})
+	west := clusterKey(&rest.Config{Host: "https://west:6443", BearerToken: "a"})
+	if east == west || east != clusterKey(&rest.Config{Host: "https://east:6443", BearerToken: "a"}) {
+		t.Fatalf("unexpected cluster keys %s %s", east, west)
+	}
+
+	deletes := make(map[string][]string)
+	collector := func(host string) *ClientGoCollector {
+		c := &ClientGoCollector{}
+		c.SetDeleteHandler(func(gvrText, namespace, name string) {
+			deletes[host] = append(deletes[host], namespace+"/"+name)
+		})
+		return c
+	}
+	h1, h2, h3 := collector("h1"), collector("h2"), collector("h3")
+	rt1 := shared.acquire(east, h1)
+	rt2 := shared.acquire(east, h2)
+	rt3 := shared.acquire(west, h3)
+	if rt1 != rt2 || rt1 == rt3 || rt1.refs != 2 {
+		t.Fatalf("expected hosts of the same cluster to share one runtime")
+	}
+
+	rt1.cache.Upsert(&CachedObject{GVR: "v1/pods", Namespace: "default", Name: "api-0"})
+	rt3.cache.Upsert(&CachedObject{GVR: "v1/pods", Namespace: "default", Name: "api-0"})
+	rt1.handleResourceDeletion("v1/pods", "default", "api-0")
+	if _, ok := rt3.cache.Get("v1/pods", "default", "api-0"); !ok {
+		t.Fatal("delete in one cluster must not touch another cluster's cache")
+	}
+	if len(deletes["h1"]) != 1 || len(deletes["h2"]) != 1 || len(deletes["h3"]) != 0 {
+		t.Fatalf("unexpected delete fan-out %v", deletes)
+	}
+
+	shared.release(rt1, h1, nil)
+	if _, ok := shared.runtimes[east]; !ok {
+		t.Fatal("runtime must survive while another host uses it")
+	}
+	shared.release(rt2, h2, nil)
+	shared.release(rt3, h3, nil)
+	if len(shared.runtimes) != 0 {
+		t.Fatalf("expected all runtimes released, got %d", len(shared.runtimes))
+	}
+	select {
+	case <-rt1.stopCh:
+	default:
+		t.Fatal("expected the released runtime's informers to be stopped")
+	}
+}
+
+// credentialResources serves the kubeconfig credentials of credentials by
+// CredId; the other resources are not used by kubeConfig.
+type credentialResources struct {
+	ifs.IResources
+	credentials map[string]string
+}
+
+type credentialSecurity struct {
+	ifs.ISecurityProvider
+	credentials map[string]string
+}
+
+func (r *credentialResources) Security() ifs.ISecurityProvider {
+	return &credentialSecurity{credentials: r.credentials}
+}
+
+func (s *credentialSecurity) Credential(credId, key string, _ ifs.IResources) (string, string, string, string, error) {
+	kubeconfig, ok := s.credentials[credId]
+	if !ok || key != "kubeconfig" {
+		return "", "", "", "", errors.New("no credential " + credId)
+	}
+	return "", "", kubeconfig, "", nil
+}
+
+func TestTargetCredentialsSelectTheirOwnClusterRuntime(t *testing.T) {
+	kubeconfig := func(server string) string {
+		return `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: ` + server + `
+  name: target
+contexts:
+- context:
+    cluster: target
+    user: target
+  name: target
+current-context: target
+users:
+- name: target
+  user:
+    token: test-token
+`
+	}
+	resources := &credentialResources{credentials: map[string]string{
+		"east": kubeconfig("https://east:6443"),
+		"west": kubeconfig("https://west:6443"),
+	}}
+	t.Setenv("KUBECONFIG", "")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("KUBERNETES_SERVICE_PORT", "443")
+
+	runtimeOf := func(credId string) (*ClientGoCollector, *clusterRuntime) {
+		collector := &ClientGoCollector{resources: resources, config: &l8tpollaris.L8PHostProtocol{CredId: credId}}
+		cfg, err := collector.kubeConfig()
+		if err != nil {
+			t.Fatalf("kubeConfig(%s): %v", credId, err)
+		}
+		return collector, shared.acquire(clusterKey(cfg), collector)
+	}
+	eastCollector, east := runtimeOf("east")
+	defer shared.release(east, eastCollector, nil)
+	westCollector, west := runtimeOf("west")
+	defer shared.release(west, westCollector, nil)
+	if east == west || !strings.HasPrefix(east.key, "https://east:6443#") || !strings.HasPrefix(west.key, "https://west:6443#") {
+		t.Fatalf("expected each target's credential to select its own cluster runtime, got %s and %s", east.key, west.key)
+	}
+}
+
+func TestSelectSupportsLabelAndFieldSelectors(t *testing.T) {
+	c := NewCollectorCache()
+	pod := func(name, app, tier, node, phase string) *CachedObject {
+		labels := map[string]interface{}{"app": app}
+		if tier != "" {
+			labels["tier"] = tier
+		}
+		return &CachedObject{GVR: "v1/pods", Namespace: "default", Name: name, Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "labels": labels},
+			"spec":     map[string]interface{}{"nodeName": node},
+			"status":   map[string]interface{}{"phase": phase},
+		}}
+	}
+	c.Upsert(pod("web-0", "web", "front", "node-1", "Running"))
+	c.Upsert(pod("web-1", "web", "", "node-2", "Pending"))
+	c.Upsert(pod("db-0", "db", "back", "node-1", "Running"))
+
+	cases := []struct {
+		labels, fields string
+		expected       int
+	}{
+		{"app=web", "", 2},
+		{"app!=web", "", 1},
+		{"app in (web,db),tier", "", 2},
+		{"app notin (db),!tier", "", 1},
+		{"", "spec.nodeName=node-1", 2},
+		{"app=web", "spec.nodeName=node-1,status.phase!=Pending", 1},
+	}
+	for _, tc := range cases {
+		items, err := c.Select("v1/pods", "default", tc.labels, tc.fields)
+		if err != nil || len(items) != tc.expected {
+			t.Fatalf("Select(%q, %q) = %d items (%v), expected %d", tc.labels, tc.fields, len(items), err, tc.expected)
+		}
+	}
+	if _, err := c.Select("v1/pods", "", "app in web", ""); err == nil {
+		t.Fatal("expected error for invalid label selector")
+	}
+	if _, err := ParseCacheSpec(`{"gvr":"v1/pods","fieldSelector":"spec.nodeName"}`, nil); err == nil {
+		t.Fatal("expected error for invalid field selector in spec")
+	}
+}
+
+func TestEnsureWatchingPushesSelectorsDown(t *testing.T) {
+	scheme := runtime.NewScheme()
+	pod := func(name, app string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Pod",
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "labels": map[string]interface{}{"app": app}},
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(scheme,
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "pods"}: "PodList"},
+		pod("web-0", "web"), pod("db-0", "db"))
+
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#selectors", collector)
+	collector.runtime = rt
+	defer shared.release(rt, collector, nil)
+	rt.dynamicClient, rt.connected = client, true
+
+	if err := collector.ensureWatching("v1/pods", "default", "app=web", ""); err != nil {
+		t.Fatalf("ensureWatching error: %v", err)
+	}
+	if items := rt.cache.List("v1/pods", "", ""); len(items) != 1 || items[0].Name != "web-0" {
+		t.Fatalf("expected only the selected pod to be watched, got %d", len(items))
+	}
+	if err := collector.ensureWatching("v1/pods", "", "", ""); err != nil {
+		t.Fatalf("ensureWatching error: %v", err)
+	}
+	if items := rt.cache.List("v1/pods", "", ""); len(items) != 2 {
+		t.Fatalf("expected the unfiltered informer to cache all pods, got %d", len(items))
+	}
+	if !rt.isWarmed(watchKey("v1/pods", "", "", "")) {
+		t.Fatal("expected the unfiltered informer to be warmed")
+	}
+}
+
+func indexedPod(i int, owner string) *CachedObject {
+	name := "pod-" + strconv.Itoa(i)
+	namespace := "ns-" + strconv.Itoa(i%100)
+	return &CachedObject{GVR: "v1/pods", Namespace: namespace, Name: name, UID: "uid-" + name, Object: map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"name": name, "namespace": namespace,
+			"labels":          map[string]interface{}{"app": "app-" + strconv.Itoa(i%1000)},
+			"ownerReferences": []interface{}{map[string]interface{}{"kind": "ReplicaSet", "uid": owner}},
+		},
+		"status": map[string]interface{}{"phase": "Running"},
+	}}
+}
+
+func TestCollectorCacheIndexes(t *testing.T) {
+	c := NewCollectorCache()
+	for i := 0; i < 2000; i++ {
+		c.Upsert(indexedPod(i, "rs-"+strconv.Itoa(i%10)))
+		c.Upsert(&CachedObject{GVR: "v1/services", Namespace: "ns-" + strconv.Itoa(i%100), Name: "svc-" + strconv.Itoa(i)})
+	}
+	if n := len(c.List("v1/pods", "ns-7", "")); n != 20 {
+		t.Fatalf("expected 20 pods in ns-7, got %d", n)
+	}
+	if n := len(c.List("", "ns-7", "")); n != 40 {
+		t.Fatalf("expected 40 objects in ns-7, got %d", n)
+	}
+	if n := len(c.List("", "", "app in (app-1,app-2)")); n != 4 {
+		t.Fatalf("expected 4 pods for the label set, got %d", n)
+	}
+	if n := len(c.ListOwnedBy("rs-3")); n != 200 {
+		t.Fatalf("expected 200 pods owned by rs-3, got %d", n)
+	}
+
+	// Re-labelling and re-parenting an object must move it between index entries.
+	moved := indexedPod(1, "rs-new")
+	moved.Object["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"app": "moved"}
+	c.Upsert(moved)
+	if len(c.List("", "", "app=app-1")) != 1 || len(c.List("", "", "app=moved")) != 1 ||
+		len(c.ListOwnedBy("rs-1")) != 199 || len(c.ListOwnedBy("rs-new")) != 1 {
+		t.Fatal("expected indexes to follow the updated object")
+	}
+	c.Delete(moved.GVR, moved.Namespace, moved.Name)
+	if len(c.List("", "", "app=moved")) != 0 || len(c.ListOwnedBy("rs-new")) != 0 || c.Len() != 3999 {
+		t.Fatal("expected the deleted object to leave every index")
+	}
+	if _, ok := c.byOwner["rs-new"]; ok {
+		t.Fatal("expected empty index entries to be dropped")
+	}
+}
+
+func benchmarkCache(b *testing.B) *CollectorCache {
+	b.Helper()
+	c := NewCollectorCache()
+	for i := 0; i < 100000; i++ {
+		c.Upsert(indexedPod(i, "rs-"+strconv.Itoa(i%5000)))
+	}
+	b.ResetTimer()
+	return c
+}
+
+func BenchmarkCacheSelectByGVRNamespace(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.List("v1/pods", "ns-42", "")
+	}
+}
+
+func BenchmarkCacheSelectByLabel(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.List("v1/pods", "", "app=app-42")
+	}
+}
+
+func BenchmarkCacheListOwnedBy(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.ListOwnedBy("rs-42")
+	}
+}
+
+// BenchmarkCacheSelectFullScan is the unindexed baseline: a field selector
+// alone cannot use an index and visits every object.
+func BenchmarkCacheSelectFullScan(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.Select("", "", "", "metadata.name=pod-42")
+	}
+}
+
+func BenchmarkCacheUpsert(b *testing.B) {
+	c := benchmarkCache(b)
+	for i := 0; i < b.N; i++ {
+		c.Upsert(indexedPod(i%100000, "rs-"+strconv.Itoa(i%5000)))
+	}
+}
+
+func TestCascadeFollowsOwnerReferences(t *testing.T) {
+	owned := func(gvr, name, uid, ownerKind, ownerName, ownerUID string) *CachedObject {
+		metadata := map[string]interface{}{"name": name, "namespace": "prod", "uid": uid}
+		if ownerName != "" {
+			metadata["ownerReferences"] = []interface{}{map[string]interface{}{"kind": ownerKind, "name": ownerName, "uid": ownerUID}}
+		}
+		return &CachedObject{GVR: gvr, Namespace: "prod", Name: name, UID: uid, Object: map[string]interface{}{"metadata": metadata}}
+	}
+	deleted := make(map[string]bool)
+	collector := &ClientGoCollector{}
+	collector.SetDeleteHandler(func(gvrText, namespace, name string) { deleted[gvrText+"/"+name] = true })
+	rt := shared.acquire("test#cascade", collector)
+	defer shared.release(rt, collector, nil)
+
+	rt.cache.Upsert(owned("batch/v1/cronjobs", "backup", "cj", "", "", ""))
+	rt.cache.Upsert(owned("batch/v1/jobs", "backup-1", "job1", "CronJob", "backup", "cj"))
+	rt.cache.Upsert(owned("v1/pods", "backup-1-x", "pod1", "Job", "backup-1", "job1"))
+	rt.cache.Upsert(owned("apps/v1/statefulsets", "db", "", "", "", ""))
+	rt.cache.Upsert(owned("v1/pods", "db-0", "pod2", "StatefulSet", "db", "ss"))
+	rt.cache.Upsert(owned("v1/pods", "other", "pod3", "Job", "other", "job2"))
+
+	rt.handleResourceDeletion("batch/v1/cronjobs", "prod", "backup")
+	if !deleted["batch/v1/jobs/backup-1"] || !deleted["v1/pods/backup-1-x"] {
+		t.Fatalf("expected the job and its pod to cascade, got %v", deleted)
+	}
+	rt.handleResourceDeletion("apps/v1/statefulsets", "prod", "db")
+	if !deleted["v1/pods/db-0"] {
+		t.Fatal("expected the pod to cascade by owner name when the owner UID is unknown")
+	}
+	if deleted["v1/pods/other"] || rt.cache.Len() != 1 {
+		t.Fatalf("unexpected cascade result, %d objects left: %v", rt.cache.Len(), deleted)
+	}
+	if ResourceForKind("NetworkPolicy") != "networkpolicies" || ResourceForKind("Ingress") != "ingresses" || ResourceForKind("Gateway") != "gateways" {
+		t.Fatal("unexpected kind pluralization")
+	}
+}
+
+func TestReaperReconcilesWithList(t *testing.T) {
+	pod := func(name, uid string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Pod",
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "uid": uid},
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "pods"}: "PodList"},
+		pod("live", "u1"), pod("recreated", "u3"))
+
+	deleted := make(map[string]bool)
+	collector := &ClientGoCollector{}
+	collector.SetDeleteHandler(func(gvrText, namespace, name string) { deleted[name] = true })
+	rt := shared.acquire("test#reaper", collector)
+	defer shared.release(rt, collector, nil)
+	rt.dynamicClient, rt.connected = client, true
+
+	old := time.Now().Add(-time.Hour).Unix()
+	for _, item := range []*unstructured.Unstructured{pod("live", "u1"), pod("gone", "u2"), pod("recreated", "u0")} {
+		obj := normalizeObject("v1/pods", item, "ADD")
+		obj.ObservedAt = old
+		rt.cache.Upsert(obj)
+	}
+	fresh := normalizeObject("v1/pods", pod("new", "u4"), "ADD")
+	rt.cache.Upsert(fresh)
+	unwatched := normalizeObject("v1/pods", pod("elsewhere", "u5"), "ADD")
+	unwatched.Namespace, unwatched.ObservedAt = "other", old
+	rt.cache.Upsert(unwatched)
+	rt.markWarmed(newWatchedInformer(rt, watchKey("v1/pods", "default", "", ""), "v1/pods", "default", "", ""))
+	rt.markWarmed(newWatchedInformer(rt, watchKey("v1/pods", "default", "app=api", ""), "v1/pods", "default", "app=api", ""))
+
+	stats := rt.reapStaleEntries(nil)
+	if stats.GVRs != 1 || stats.Pages != 1 || stats.Checked != 3 || stats.Skipped != 1 ||
+		stats.Reaped != 1 || stats.Refreshed != 1 || stats.Cycle != 1 {
+		t.Fatalf("unexpected reaper stats %+v", stats)
+	}
+	if !deleted["gone"] || deleted["live"] || deleted["new"] || deleted["elsewhere"] {
+		t.Fatalf("unexpected deletions %v", deleted)
+	}
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" && action.GetNamespace() != "default" {
+			t.Fatalf("expected the LIST to be scoped to the watched namespace, got %q", action.GetNamespace())
+		}
+	}
+	if item, ok := rt.cache.Get("v1/pods", "default", "recreated"); !ok || item.UID != "u3" {
+		t.Fatal("expected the recreated pod to be refreshed")
+	}
+	collector.runtime = rt
+	if collector.ReaperStats().Reaped != 1 {
+		t.Fatal("expected the collector to expose the last cycle's stats")
+	}
+}
+
+func TestEnricherRegistry(t *testing.T) {
+	job := map[string]interface{}{
+		"metadata": map[string]interface{}{"name": "backup"},
+		"spec":     map[string]interface{}{"completions": float64(3)},
+		"status": map[string]interface{}{"succeeded": float64(3), "startTime": "2026-01-01T00:00:00Z",
+			"completionTime": "2026-01-01T00:02:30Z",
+			"conditions":     []interface{}{map[string]interface{}{"type": "Complete", "status": "True"}}},
+	}
+	enrichObject("batch/v1/jobs", job)
+	computed := job["_k"].(map[string]interface{})
+	if computed["status"] != "Complete" || computed["completions"] != "3/3" || computed["duration"] != "2m" {
+		t.Fatalf("unexpected job fields %v", computed)
+	}
+
+	hpa := map[string]interface{}{
+		"spec": map[string]interface{}{"scaleTargetRef": map[string]interface{}{"kind": "Deployment", "name": "web"},
+			"maxReplicas": float64(5),
+			"metrics": []interface{}{map[string]interface{}{"type": "Resource", "resource": map[string]interface{}{
+				"name": "cpu", "target": map[string]interface{}{"averageUtilization": float64(80)}}}}},
+		"status": map[string]interface{}{"currentReplicas": float64(2),
+			"currentMetrics": []interface{}{map[string]interface{}{"type": "Resource", "resource": map[string]interface{}{
+				"name": "cpu", "current": map[string]interface{}{"averageUtilization": float64(45)}}}}},
+	}
+	enrichObject("autoscaling/v2/horizontalpodautoscalers", hpa)
+	if computed = hpa["_k"].(map[string]interface{}); computed["targets"] != "cpu: 45%/80%" || computed["reference"] != "Deployment/web" {
+		t.Fatalf("unexpected hpa fields %v", computed)
+	}
+
+	vs := map[string]interface{}{"spec": map[string]interface{}{"hosts": []interface{}{"a", "b"}, "gateways": []interface{}{"gw"}}}
+	enrichObject("networking.istio.io/v1/virtualservices", vs)
+	if computed = vs["_k"].(map[string]interface{}); computed["hosts"] != "a,b" || computed["gateways"] != "gw" {
+		t.Fatalf("unexpected virtualservice fields %v", computed)
+	}
+
+	// A GVR-specific enricher overrides the built-in of the resource.
+	RegisterEnricher("apps/v1/deployments", BuiltinEnricher, func(obj, out map[string]interface{}) { out["custom"] = "yes" })
+	defer RegisterEnricher("apps/v1/deployments", BuiltinEnricher, nil)
+	deployment := map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(1)}}
+	enrichObject("apps/v1/deployments", deployment)
+	if computed = deployment["_k"].(map[string]interface{}); computed["custom"] != "yes" || computed["ready"] != nil {
+		t.Fatalf("expected the built-in to be overridden, got %v", computed)
+	}
+
+	spec, err := ParseCacheSpec(`{"gvr":"v1/pods","enrich":{"restartcounts":"{.status.containerStatuses[*].restartCount}","node":".spec.nodeName"}}`, nil)
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	defer func() {
+		for field := range spec.Enrich {
+			RegisterEnricher("v1/pods", "spec:"+field, nil)
+		}
+	}()
+	if changed, err := registerSpecEnrichers(spec); err != nil || !changed {
+		t.Fatalf("expected new spec enrichers, got %v (%v)", changed, err)
+	}
+	if changed, _ := registerSpecEnrichers(spec); changed {
+		t.Fatal("expected registering the same spec twice to be a no-op")
+	}
+	pod := map[string]interface{}{
+		"spec":   map[string]interface{}{"nodeName": "node-1"},
+		"status": map[string]interface{}{"containerStatuses": []interface{}{map[string]interface{}{"restartCount": float64(1)}, map[string]interface{}{"restartCount": float64(4)}}},
+	}
+	enrichObject("v1/pods", pod)
+	if computed = pod["_k"].(map[string]interface{}); computed["restartcounts"] != "1 4" || computed["node"] != "node-1" || computed["restarts"] != "5" {
+		t.Fatalf("unexpected spec enriched fields %v", computed)
+	}
+	changedSpec, _ := ParseCacheSpec(`{"gvr":"v1/pods","enrich":{"node":".status.hostIP"}}`, nil)
+	if changed, _ := registerSpecEnrichers(changedSpec); !changed {
+		t.Fatal("expected a changed expression to be registered")
+	}
+	pod["status"].(map[string]interface{})["hostIP"] = "10.0.0.7"
+	enrichObject("v1/pods", pod)
+	if computed = pod["_k"].(map[string]interface{}); computed["node"] != "10.0.0.7" {
+		t.Fatalf("expected the changed expression to apply, got %v", computed["node"])
+	}
+	registered := 0
+	for _, entry := range enrichers.targets["v1/pods"] {
+		if entry.name == "spec:node" {
+			registered++
+		}
+	}
+	if registered != 1 {
+		t.Fatalf("expected the changed expression to replace the old one, got %d enrichers", registered)
+	}
+	if _, err = ParseCacheSpec(`{"gvr":"v1/pods","enrich":{"bad":"{.status[}"}}`, nil); err == nil {
+		t.Fatal("expected error for invalid jsonpath")
+	}
+}
+
+func TestGVRToLinksIdIsDerivedAndVersionTolerant(t *testing.T) {
+	if got := GVRToLinksId("v1/pods"); got != "K8sPod" {
+		t.Fatalf("expected pods from the boot models, got %q", got)
+	}
+	if got := GVRToLinksId("networking.istio.io/v1/virtualservices"); got != "IstioVs" {
+		t.Fatalf("expected version-tolerant virtualservices, got %q", got)
+	}
+	if got := canonicalGVR("networking.istio.io/v1/virtualservices"); got != "networking.istio.io/v1beta1/virtualservices" {
+		t.Fatalf("expected the polled version, got %q", got)
+	}
+	if GVRToLinksId("example.com/v1/widgets") != "" {
+		t.Fatal("expected no mapping for an unknown CRD")
+	}
+
+	model := &l8tpollaris.L8Pollaris{Name: "ExWidget", Polling: map[string]*l8tpollaris.L8Poll{
+		"widgets": {Name: "widgets", Protocol: l8tpollaris.L8PProtocol_L8PKubernetesAPI,
+			What: `{"result":"table","gvr":"example.com/v1/widgets"}`},
+	}}
+	if err := RegisterGVRLinksFromPollarisModels([]*l8tpollaris.L8Pollaris{model}); err != nil {
+		t.Fatalf("register models: %v", err)
+	}
+	if got := GVRToLinksId("example.com/v2/widgets"); got != "ExWidget" {
+		t.Fatalf("expected the model's LinksId, got %q", got)
+	}
+	if err := RegisterGVRLinksId("example.com/v1/widgets", ""); err != nil {
+		t.Fatalf("unregister: %v", err)
+	}
+	if GVRToLinksId("example.com/v1/widgets") != "" {
+		t.Fatal("expected the mapping to be removed")
+	}
+	if err := RegisterGVRLinksId("widgets", "ExWidget"); err == nil {
+		t.Fatal("expected an error for an invalid gvr")
+	}
+}
+
+func TestRuntimeModelDeletesAreForwarded(t *testing.T) {
+	forwarded := make(map[string]string)
+	collector := &ClientGoCollector{}
+	collector.SetDeleteHandler(func(gvrText, namespace, name string) {
+		// As CollectorService.handleK8sDelete, which drops unmapped GVRs.
+		if linksId := GVRToLinksId(gvrText); linksId != "" {
+			forwarded[name] = linksId
+		}
+	})
+	rt := shared.acquire("test#links", collector)
+	defer shared.release(rt, collector, nil)
+
+	gizmo := func(name string) *CachedObject {
+		return &CachedObject{GVR: "example.com/v1/gizmos", Namespace: "prod", Name: name,
+			Object: map[string]interface{}{"metadata": map[string]interface{}{"name": name, "namespace": "prod"}}}
+	}
+	rt.cache.Upsert(gizmo("g1"))
+	rt.handleResourceDeletion("example.com/v1/gizmos", "prod", "g1")
+	if len(forwarded) != 0 {
+		t.Fatalf("expected no forwarding before a job of the model ran, got %v", forwarded)
+	}
+
+	poll := &l8tpollaris.L8Poll{Name: "gizmos", Protocol: l8tpollaris.L8PProtocol_L8PKubernetesAPI}
+	spec, err := ParseCacheSpec(`{"result":"table","gvr":"example.com/v1/gizmos"}`, poll)
+	if err != nil {
+		t.Fatalf("parse spec: %v", err)
+	}
+	registerJobLinksId(spec, &l8tpollaris.CJob{PollarisName: "ExGizmo", JobName: "gizmos", LinksId: "ExGizmo"})
+	defer RegisterGVRLinksId("example.com/v1/gizmos", "")
+	rt.cache.Upsert(gizmo("g2"))
+	rt.handleResourceDeletion("example.com/v1/gizmos", "prod", "g2")
+	if forwarded["g2"] != "ExGizmo" {
+		t.Fatalf("expected the delete forwarded to the job's LinksId, got %v", forwarded)
+	}
+
+	pods, _ := ParseCacheSpec(`{"result":"table","gvr":"v1/pods"}`, poll)
+	registerJobLinksId(pods, &l8tpollaris.CJob{LinksId: "K8sC"})
+	if got := GVRToLinksId("v1/pods"); got != "K8sPod" {
+		t.Fatalf("expected the models' mapping to be kept, got %q", got)
+	}
+}
+
+func TestServedGVRResolvesPreferredVersion(t *testing.T) {
+	rt := newClusterRuntime("test")
+	rt.discovery = &fakediscovery.FakeDiscovery{Fake: &kubetesting.Fake{Resources: []*metav1.APIResourceList{
+		{GroupVersion: "networking.istio.io/v1", APIResources: []metav1.APIResource{{Name: "virtualservices"}}},
+		{GroupVersion: "v1", APIResources: []metav1.APIResource{{Name: "pods"}}},
+	}}}
+
+	stale := schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+	if got := rt.servedGVR(stale); got.Version != "v1" {
+		t.Fatalf("expected the served v1, got %s", got.String())
+	}
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	if got := rt.servedGVR(pods); got != pods {
+		t.Fatalf("expected a served gvr unchanged, got %s", got.String())
+	}
+	unknown := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "widgets"}
+	if got := rt.servedGVR(unknown); got != unknown {
+		t.Fatalf("expected an unknown gvr unchanged, got %s", got.String())
+	}
+}
+
+func TestWebhookManagerRotatesCertificatesAndConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{validatingWebhookGVR: "ValidatingWebhookConfigurationList"})
+	store := &certStore{}
+	rules := []WebhookRule{{APIGroups: []string{""}, APIVersions: []string{"v1"}, Resources: []string{"pods"}, Operations: []string{"CREATE"}}}
+	manager := newWebhookManager(WebhookConfigOptions{Name: "l8collector-k8s", ServiceName: "l8collector", Namespace: "probler"},
+		rules, dir, client, store)
+
+	now := time.Now()
+	if err := manager.start(nil, now); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	first := store.current()
+	if first == nil || !first.servesNames(webhookDNSNames("l8collector", "probler")) {
+		t.Fatal("expected a serving certificate signed by the generated CA")
+	}
+	caBundle := func() string {
+		config, err := client.Resource(validatingWebhookGVR).Get(context.Background(), "l8collector-k8s", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("get webhook configuration: %v", err)
+		}
+		webhooks, _, _ := unstructured.NestedSlice(config.Object, "webhooks")
+		bundle, _, _ := unstructured.NestedString(webhooks[0].(map[string]interface{}), "clientConfig", "caBundle")
+		return bundle
+	}
+	if caBundle() == "" {
+		t.Fatal("expected the caBundle to be applied")
+	}
+
+	// A restart reuses the stored certificate.
+	if err := manager.start(nil, now); err != nil || !bytes.Equal(store.current().certPEM, first.certPEM) {
+		t.Fatalf("expected the stored certificate to be reused (%v)", err)
+	}
+	if rotated, err := manager.rotateIfDue(nil, now); err != nil || rotated {
+		t.Fatalf("expected no rotation of a fresh certificate (%v)", err)
+	}
+	rotated, err := manager.rotateIfDue(nil, now.Add(CertValidity-CertRenewBefore/2))
+	if err != nil || !rotated {
+		t.Fatalf("expected rotation before expiry (%v)", err)
+	}
+	if bytes.Equal(store.current().certPEM, first.certPEM) {
+		t.Fatal("expected the new certificate to be served")
+	}
+	if got := manager.caBundle(store.current().caPEM); !bytes.Contains(got, first.caPEM) {
+		t.Fatal("expected the caBundle to trust the previous CA during rotation")
+	}
+
+	reloaded := &certStore{}
+	if changed, err := reloaded.reloadIfChanged(dir); err != nil || !changed {
+		t.Fatalf("expected the rotated files to load (%v)", err)
+	}
+	if changed, _ := reloaded.reloadIfChanged(dir); changed {
+		t.Fatal("expected unchanged files not to reload")
+	}
+	if cert, err := reloaded.getCertificate(nil); err != nil || cert.Leaf.NotAfter != store.current().notAfter {
+		t.Fatalf("expected the rotated certificate from disk (%v)", err)
+	}
+
+	if err = manager.remove(); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err = client.Resource(validatingWebhookGVR).Get(context.Background(), "l8collector-k8s", metav1.GetOptions{}); err == nil {
+		t.Fatal("expected the webhook configuration to be removed")
+	}
+}
+
+func TestAdmissionSelectorsDeduplicationAndTargetedWakeups(t *testing.T) {
+	poll := func(name, what string) *l8tpollaris.L8Poll {
+		return &l8tpollaris.L8Poll{Name: name, Protocol: l8tpollaris.L8PProtocol_L8PKubernetesAPI, What: what}
+	}
+	model := &l8tpollaris.L8Pollaris{Name: "kubernetesapi", Polling: map[string]*l8tpollaris.L8Poll{
+		"pods":  poll("pods", `{"gvr":"v1/pods","namespace":"prod","selector":"app=api"}`),
+		"pods2": poll("pods2", `{"gvr":"v1/pods","namespace":"stage","selector":"app=api"}`),
+		"nodes": poll("nodes", `{"gvr":"v1/nodes"}`),
+	}}
+	rules, err := WebhookRulesFromPollarisModels([]*l8tpollaris.L8Pollaris{model})
+	if err != nil {
+		t.Fatalf("rules: %v", err)
+	}
+	pods := rules[len(rules)-1]
+	if strings.Join(pods.Namespaces, ",") != "prod,stage" || pods.ObjectSelector != "app=api" {
+		t.Fatalf("unexpected pods rule: %#v", pods)
+	}
+	config := admissionregistrationFromRules("hook", "svc", "ns", "/admission", rules)
+	if len(config.Webhooks) != 2 || config.Webhooks[0].Name != "svc.ns.svc" || config.Webhooks[0].NamespaceSelector != nil ||
+		config.Webhooks[1].NamespaceSelector == nil || config.Webhooks[1].ObjectSelector.MatchLabels["app"] != "api" {
+		t.Fatalf("unexpected webhooks: %#v", config.Webhooks)
+	}
+
+	event := func(namespace, app, resourceVersion string) AdmissionEvent {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Pod")
+		obj.SetNamespace(namespace)
+		obj.SetName("api-0")
+		obj.SetLabels(map[string]string{"app": app})
+		obj.SetResourceVersion(resourceVersion)
+		return AdmissionEvent{Version: "v1", Resource: "pods", Namespace: namespace, Name: "api-0", Operation: "UPDATE", Object: obj}
+	}
+	if !matchesWebhookRule(rules, event("prod", "api", "1")) || matchesWebhookRule(rules, event("dev", "api", "1")) ||
+		matchesWebhookRule(rules, event("prod", "web", "1")) {
+		t.Fatal("expected namespace and object selectors to filter events")
+	}
+
+	rt := newClusterRuntime("dedup")
+	if !rt.cache.UpsertIfNewer(normalizeObject("v1/pods", event("prod", "api", "7").Object, "ADD")) {
+		t.Fatal("expected the first event to be stored")
+	}
+	if rt.cache.UpsertIfNewer(normalizeObject("v1/pods", event("prod", "api", "7").Object, "UPDATE")) ||
+		rt.cache.UpsertIfNewer(normalizeObject("v1/pods", event("prod", "api", "6").Object, "UPDATE")) {
+		t.Fatal("expected the same or an older resourceVersion to be dropped")
+	}
+	if !rt.cache.HasNewer("v1/pods", "prod", "api-0", "6") || rt.cache.HasNewer("v1/pods", "prod", "api-0", "7") {
+		t.Fatal("unexpected staleness of admission events")
+	}
+	deletes := 0
+	collector := &ClientGoCollector{}
+	collector.SetDeleteHandler(func(string, string, string) { deletes++ })
+	rt.collectors[collector] = struct{}{}
+	rt.handleResourceDeletion("v1/pods", "prod", "api-0")
+	rt.handleResourceDeletion("v1/pods", "prod", "api-0")
+	if deletes != 1 {
+		t.Fatalf("expected a single forwarded deletion, got %d", deletes)
+	}
+
+	prodPods := poll("pods", `{"gvr":"v1/pods","namespaceFromArg":"ns"}`)
+	prodCh := SubscribeAdmissionEventsFor(func(gvrText, namespace string) bool {
+		return PollCovers(prodPods, map[string]string{"ns": "prod"}, gvrText, namespace)
+	})
+	defer UnsubscribeAdmissionEvents(prodCh)
+	nodesCh := SubscribeAdmissionEventsFor(func(gvrText, namespace string) bool {
+		return PollCovers(model.Polling["nodes"], nil, gvrText, namespace)
+	})
+	defer UnsubscribeAdmissionEvents(nodesCh)
+	shared.notifySubscribers("v1/pods", "prod")
+	select {
+	case <-prodCh:
+	default:
+		t.Fatal("expected the host polling prod pods to be woken")
+	}
+	select {
+	case <-nodesCh:
+		t.Fatal("expected the host polling nodes not to be woken")
+	default:
+	}
+	shared.notifySubscribers("v1/pods", "dev")
+	select {
+	case <-prodCh:
+		t.Fatal("expected no wakeup for another namespace")
+	default:
+	}
+}
+
+func TestAdmissionThenInformerOrder(t *testing.T) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "pods"}: "PodList"})
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#admission-order", collector)
+	collector.runtime = rt
+	defer shared.release(rt, collector, nil)
+	rt.dynamicClient, rt.connected = client, true
+	woken := SubscribeAdmissionEvents()
+	defer UnsubscribeAdmissionEvents(woken)
+	wakeups := func() int {
+		select {
+		case <-woken:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	pod := func(resourceVersion, app string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("v1")
+		obj.SetKind("Pod")
+		obj.SetNamespace("prod")
+		obj.SetName("api-0")
+		obj.SetLabels(map[string]string{"app": app})
+		obj.SetResourceVersion(resourceVersion)
+		return obj
+	}
+	admit := func(obj *unstructured.Unstructured) {
+		event := AdmissionEvent{Version: "v1", Resource: "pods", Namespace: "prod", Name: "api-0", Operation: "UPDATE", Object: obj}
+		if err := collector.handleAdmissionEvent(event); err != nil {
+			t.Fatalf("admission event: %v", err)
+		}
+	}
+	app := func() string {
+		cached, _ := rt.cache.Get("v1/pods", "prod", "api-0")
+		value, _ := FieldValue(cached, "metadata.labels.app")
+		return stringify(value)
+	}
+	rt.cache.UpsertIfNewer(cacheObject("v1/pods", pod("6", "api"), "ADD"))
+
+	// The admission event carries the resourceVersion the change was made
+	// against, the informer then delivers the change at its new version.
+	admit(pod("6", "api-v2"))
+	if app() != "api-v2" || wakeups() != 1 {
+		t.Fatal("expected the admission event to update the cache and wake the hosts")
+	}
+	if !rt.cache.UpsertIfNewer(cacheObject("v1/pods", pod("7", "api-v2"), "UPDATE")) {
+		t.Fatal("expected the informer's copy to replace the admission copy")
+	}
+	if rt.cache.UpsertIfNewer(cacheObject("v1/pods", pod("7", "api-v2"), "UPDATE")) {
+		t.Fatal("expected a redelivery of the informer's copy to be dropped")
+	}
+	admit(pod("6", "api-v2"))
+	if wakeups() != 0 {
+		t.Fatal("expected a repeated admission event to be dropped without waking the hosts")
+	}
+
+	var wg sync.WaitGroup
+	for version := 8; version <= 50; version++ {
+		wg.Add(1)
+		go func(version int) {
+			defer wg.Done()
+			rt.cache.UpsertIfNewer(cacheObject("v1/pods", pod(strconv.Itoa(version), "api"), "UPDATE"))
+		}(version)
+	}
+	wg.Wait()
+	if cached, _ := rt.cache.Get("v1/pods", "prod", "api-0"); cached.ResourceVersion != "50" {
+		t.Fatalf("expected concurrent writers to keep the newest version, got %s", cached.ResourceVersion)
+	}
+}
+
+func TestLogsResumeAndEventsStream(t *testing.T) {
+	lines := []string{
+		"2026-01-01T00:00:01Z starting",
+		"2026-01-01T00:00:02Z ready",
+	}
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/prod/pods/api-0/log" {
+			http.NotFound(w, r)
+			return
+		}
+		queries = append(queries, r.URL.RawQuery)
+		w.Write([]byte(strings.Join(lines, "\n") + "\n"))
+	}))
+	defer server.Close()
+	kube, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("kube client: %v", err)
+	}
+
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#logs", collector)
+	defer shared.release(rt, collector, nil)
+	rt.kubeClient, rt.connected = kube, true
+	collector.runtime = rt
+	rt.cache.Upsert(normalizeObject("v1/pods", &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Pod",
+		"metadata": map[string]interface{}{"name": "api-0", "namespace": "prod", "uid": "u1"},
+		"spec":     map[string]interface{}{"containers": []interface{}{map[string]interface{}{"name": "app"}}},
+	}}, "ADD"))
+
+	spec, err := ParseCacheSpec(`{"mode":"logs","namespaceFromArg":"ns","tailLines":10}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	rows := func() int {
+		job := &l8tpollaris.CJob{PollarisName: "k8s", JobName: "logs", Arguments: map[string]string{"ns": "prod"}}
+		collector.execLogs(job, spec, "prod", "", "", "")
+		if job.Error != "" {
+			t.Fatalf("logs: %s", job.Error)
+		}
+		return len(decodeResult(t, job).(*l8tpollaris.CTable).Rows)
+	}
+	if n := rows(); n != 2 || !strings.Contains(queries[0], "tailLines=10") {
+		t.Fatalf("expected the tail of the log, got %d rows (%s)", n, queries[0])
+	}
+	lines = append(lines, "2026-01-01T00:00:03Z serving")
+	if n := rows(); n != 1 || !strings.Contains(queries[1], "sinceTime=") {
+		t.Fatalf("expected only the new line on resume, got %d rows (%s)", n, queries[1])
+	}
+	lines = append(lines, "2026-01-01T00:00:03Z listening", "2026-01-01T00:00:03Z serving")
+	if n := rows(); n != 2 {
+		t.Fatalf("expected the new lines sharing the last line's timestamp, got %d rows", n)
+	}
+	if n := rows(); n != 0 {
+		t.Fatalf("expected no line to be read twice, got %d rows", n)
+	}
+	rt.cache.Delete("v1/pods", "prod", "api-0")
+	rows()
+	if len(collector.logPositions) != 0 {
+		t.Fatalf("expected the positions of deleted pods to be dropped, got %v", collector.logPositions)
+	}
+
+	events := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "events"}: "EventList"})
+	rt.dynamicClient = events
+	results := make(chan *l8tpollaris.CJob, 1)
+	collector.SetStreamHandler(func(job *l8tpollaris.CJob) { results <- job })
+	defer collector.stopStreams()
+	streamSpec, err := ParseCacheSpec(`{"mode":"events-stream"}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	job := &l8tpollaris.CJob{PollarisName: "k8s", JobName: "events"}
+	collector.execEventsStream(job, streamSpec, "prod", "", "")
+	if job.Error != "" {
+		t.Fatalf("events stream: %s", job.Error)
+	}
+	event := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Event", "reason": "BackOff",
+		"metadata": map[string]interface{}{"name": "api-0.1", "namespace": "prod"},
+	}}
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "events"}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err = events.Resource(gvr).Namespace("prod").Create(context.Background(), event, metav1.CreateOptions{}); err != nil {
+			t.Fatalf("create event: %v", err)
+		}
+		select {
+		case result := <-results:
+			cmap := decodeResult(t, result).(*l8tpollaris.CMap)
+			reason, _ := object.NewDecode(cmap.Data["reason"], 0, nil).Get()
+			if result.JobName != "events" || reason != "BackOff" {
+				t.Fatalf("unexpected stream result %s %v", result.JobName, reason)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the created event to be streamed")
+		}
+		events.Resource(gvr).Namespace("prod").Delete(context.Background(), "api-0.1", metav1.DeleteOptions{})
+	}
+}
+
+// decodeResult decodes an encoded CMap or CTable job result.
+func decodeResult(t *testing.T, job *l8tpollaris.CJob) interface{} {
+	t.Helper()
+	r := registry.NewRegistry()
+	r.Register(&l8tpollaris.CMap{})
+	r.Register(&l8tpollaris.CTable{})
+	value, err := object.NewDecode(job.Result, 0, r).Get()
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	return value
+}
+
+func TestMetricsAreJoinedOntoPodsAndNodes(t *testing.T) {
+	responses := map[string]string{
+		"/apis/metrics.k8s.io/v1beta1/namespaces/prod/pods": `{"kind":"PodMetricsList","apiVersion":"metrics.k8s.io/v1beta1","items":[
+			{"metadata":{"name":"api-0","namespace":"prod","labels":{"app":"api"}},"window":"15s","containers":[
+				{"name":"app","usage":{"cpu":"120m","memory":"64Mi"}},{"name":"proxy","usage":{"cpu":"5000000n","memory":"16Mi"}}]}]}`,
+		"/apis/metrics.k8s.io/v1beta1/nodes": `{"kind":"NodeMetricsList","apiVersion":"metrics.k8s.io/v1beta1","items":[
+			{"metadata":{"name":"node-a"},"window":"20s","usage":{"cpu":"500m","memory":"1Gi"}}]}`,
+		"/apis/custom.metrics.k8s.io/v1beta2/namespaces/prod/pods/*/requests_per_second": `{"kind":"MetricValueList","apiVersion":"custom.metrics.k8s.io/v1beta2","items":[
+			{"describedObject":{"kind":"Pod","namespace":"prod","name":"api-0","apiVersion":"/v1"},"metric":{"name":"requests_per_second"},"value":"250m"}]}`,
+	}
+	reads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		reads++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("dynamic client: %v", err)
+	}
+
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#metrics", collector)
+	defer shared.release(rt, collector, nil)
+	rt.dynamicClient, rt.connected = client, true
+	collector.runtime = rt
+	pod := NormalizeObject("v1/pods", map[string]interface{}{
+		"apiVersion": "v1", "kind": "Pod",
+		"metadata": map[string]interface{}{"name": "api-0", "namespace": "prod"},
+	}, "ADD")
+	node := NormalizeObject("v1/nodes", map[string]interface{}{
+		"apiVersion": "v1", "kind": "Node",
+		"metadata": map[string]interface{}{"name": "node-a"},
+		"status":   map[string]interface{}{"allocatable": map[string]interface{}{"cpu": "2", "memory": "4Gi"}},
+	}, "ADD")
+
+	podSpec, err := ParseCacheSpec(`{"gvr":"v1/pods","metrics":true,"customMetrics":["requests_per_second"]}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	pods := collector.withMetrics(podSpec, "prod", []*CachedObject{pod})
+	usage := pods[0].Object["_k"].(map[string]interface{})
+	if usage["cpuUsage"] != "125m" || usage["memoryUsage"] != "80Mi" || usage["usageWindow"] != "15s" ||
+		usage["metrics"].(map[string]interface{})["requests_per_second"] != "250m" {
+		t.Fatalf("unexpected pod usage %v", usage)
+	}
+	if _, ok := pod.Object["_k"].(map[string]interface{})["cpuUsage"]; ok {
+		t.Fatal("expected the cached pod to be left untouched")
+	}
+
+	nodeSpec, err := ParseCacheSpec(`{"gvr":"v1/nodes","metrics":true}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	usage = collector.withMetrics(nodeSpec, "", []*CachedObject{node})[0].Object["_k"].(map[string]interface{})
+	if usage["cpuUsagePercent"] != int64(25) || usage["memoryUsagePercent"] != int64(25) {
+		t.Fatalf("unexpected node usage %v", usage)
+	}
+	if _, err = ParseCacheSpec(`{"gvr":"apps/v1/deployments","metrics":true}`, nil); err == nil {
+		t.Fatal("expected metrics to be rejected for deployments")
+	}
+
+	metricsSpec, err := ParseCacheSpec(`{"gvr":"metrics.k8s.io/v1beta1/pods","selector":"app=api","fields":["metadata.name","_k.cpuUsage","_k.memoryUsageBytes"]}`, nil)
+	if err != nil || metricsSpec.watched() {
+		t.Fatalf("expected an unwatched metrics spec, err %v", err)
+	}
+	job := &l8tpollaris.CJob{}
+	collector.execMetrics(job, metricsSpec, "prod", "", "app=api", "")
+	if job.Error != "" {
+		t.Fatalf("metrics: %s", job.Error)
+	}
+	if rows := decodeResult(t, job).(*l8tpollaris.CTable).Rows; len(rows) != 1 {
+		t.Fatalf("expected one pod metrics row, got %d", len(rows))
+	}
+	if reads != 3 {
+		t.Fatalf("expected readings to be shared within MetricsMaxAge, got %d reads", reads)
+	}
+}
+
+func TestInformersPruneProjectAndStop(t *testing.T) {
+	configMap := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "ConfigMap",
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "resourceVersion": "1",
+				"managedFields": []interface{}{map[string]interface{}{"manager": "kubectl"}}},
+			"data": map[string]interface{}{"keep": "yes", "drop": "no"},
+		}}
+	}
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "configmaps"}: "ConfigMapList"},
+		configMap("a"), configMap("b"))
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#informers", collector)
+	collector.runtime = rt
+	defer shared.release(rt, collector, nil)
+	rt.dynamicClient, rt.connected = client, true
+
+	resetProjection := func() {
+		projections.mu.Lock()
+		defer projections.mu.Unlock()
+		delete(projections.byGVR, "v1/configmaps")
+	}
+	resetProjection()
+	defer resetProjection()
+	projected, err := ParseCacheSpec(`{"gvr":"v1/configmaps","project":["data.keep"]}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if err = collector.applySpec(projected); err != nil {
+		t.Fatalf("applySpec: %v", err)
+	}
+	if err = collector.ensureWatching("v1/configmaps", "default", "", ""); err != nil {
+		t.Fatalf("ensureWatching: %v", err)
+	}
+	item, ok := rt.cache.Get("v1/configmaps", "default", "a")
+	if !ok {
+		t.Fatal("expected the config map to be cached")
+	}
+	if _, ok = nestedValue(item.Object, []string{"data", "drop"}); ok || item.Object["data"].(map[string]interface{})["keep"] != "yes" {
+		t.Fatalf("expected the projection to be applied, got %v", item.Object["data"])
+	}
+	if _, ok = nestedValue(item.Object, []string{"metadata", "managedFields"}); ok {
+		t.Fatal("expected managedFields to be pruned")
+	}
+
+	whole, _ := ParseCacheSpec(`{"gvr":"v1/configmaps"}`, nil)
+	if err = collector.applySpec(whole); err != nil {
+		t.Fatalf("applySpec: %v", err)
+	}
+	item, _ = rt.cache.Get("v1/configmaps", "default", "a")
+	if _, ok = nestedValue(item.Object, []string{"data", "drop"}); !ok {
+		t.Fatal("expected a spec without projection to restore whole objects")
+	}
+	if _, ok = nestedValue(item.Object, []string{"metadata", "managedFields"}); ok {
+		t.Fatal("expected managedFields to stay pruned")
+	}
+	if _, err = ParseCacheSpec(`{"gvr":"v1/configmaps","project":["data..keep"]}`, nil); err == nil {
+		t.Fatal("expected an invalid project path to be rejected")
+	}
+
+	timeout := InformerIdleTimeout
+	defer func() { InformerIdleTimeout = timeout }()
+	InformerIdleTimeout = time.Hour
+	rt.stopIdleInformers(nil)
+	if !rt.isWarmed(watchKey("v1/configmaps", "default", "", "")) {
+		t.Fatal("expected a used informer to keep running")
+	}
+	InformerIdleTimeout = time.Nanosecond
+	rt.stopIdleInformers(nil)
+	if rt.isWarmed(watchKey("v1/configmaps", "default", "", "")) || len(rt.cache.List("v1/configmaps", "", "")) != 0 {
+		t.Fatal("expected the idle informer to be stopped and its objects evicted")
+	}
+	if err = collector.ensureWatching("v1/configmaps", "", "", ""); err != nil {
+		t.Fatalf("ensureWatching: %v", err)
+	}
+	if len(rt.cache.List("v1/configmaps", "", "")) != 2 {
+		t.Fatal("expected watching to restart after a stop")
+	}
+	if collector.StopWatching("v1/configmaps") != 1 || len(rt.cache.List("v1/configmaps", "", "")) != 0 {
+		t.Fatal("expected StopWatching to stop the informer and evict its objects")
+	}
+}
+
+func TestSnapshotRestoresCacheAndEmitsMissedDeletes(t *testing.T) {
+	dir := SnapshotDir
+	defer func() { SnapshotDir = dir }()
+	SnapshotDir = t.TempDir()
+	secret := func(name string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1", "kind": "Secret",
+			"metadata": map[string]interface{}{"name": name, "namespace": "default", "uid": "u-" + name, "resourceVersion": "1"},
+			"type":     "Opaque",
+			"data":     map[string]interface{}{"size": int64(3)},
+		}}
+	}
+
+	before := &ClientGoCollector{}
+	rt := shared.acquire("test#snapshot", before)
+	rt.cache.Upsert(normalizeObject("v1/secrets", secret("kept"), "ADD"))
+	rt.cache.Upsert(normalizeObject("v1/secrets", secret("removed"), "ADD"))
+	watched := watchKey("v1/secrets", "", "", "")
+	rt.markWarmed(newWatchedInformer(rt, watched, "v1/secrets", "", "", ""))
+	shared.release(rt, before, nil)
+
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{{Version: "v1", Resource: "secrets"}: "SecretList"},
+		secret("kept"))
+	var mu sync.Mutex
+	deleted := make(map[string]bool)
+	after := &ClientGoCollector{}
+	after.SetDeleteHandler(func(gvrText, namespace, name string) {
+		mu.Lock()
+		defer mu.Unlock()
+		deleted[name] = true
+	})
+	rt = shared.acquire("test#snapshot", after)
+	after.runtime = rt
+	defer shared.release(rt, after, nil)
+	rt.dynamicClient, rt.connected = client, true
+	rt.restoreSnapshot(nil)
+
+	item, ok := rt.cache.Get("v1/secrets", "default", "removed")
+	if !ok || item.Object["data"].(map[string]interface{})["size"] != int64(3) {
+		t.Fatal("expected the snapshot to be restored with its value types")
+	}
+	if rt.takeRestored(watchKey("v1/secrets", "other", "", "")) || !rt.restored[watched] {
+		t.Fatal("expected only the informers saved with the snapshot to be served from it")
+	}
+	if err := after.ensureWatching("v1/secrets", "", "", ""); err != nil {
+		t.Fatalf("ensureWatching: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		done := deleted["removed"]
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the deletion missed while down to be emitted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok = rt.cache.Get("v1/secrets", "default", "removed"); ok || deleted["kept"] {
+		t.Fatal("expected only the deleted secret to be removed")
+	}
+	if _, ok = rt.cache.Get("v1/secrets", "default", "kept"); !ok {
+		t.Fatal("expected the live secret to stay cached")
+	}
+	rt.mu.Lock()
+	remaining := len(rt.restored)
+	rt.mu.Unlock()
+	if remaining != 0 {
+		t.Fatal("expected the snapshot to serve its informer only once")
+	}
+}
+
+func TestRelationsResolveRelatedFields(t *testing.T) {
+	resetRelations := func() {
+		relations.mu.Lock()
+		defer relations.mu.Unlock()
+		for _, gvrText := range []string{"v1/pods", "v1/services"} {
+			delete(relations.byGVR, gvrText)
+		}
+	}
+	resetRelations()
+	defer resetRelations()
+	owned := func(kind, name string) []interface{} {
+		return []interface{}{map[string]interface{}{"apiVersion": "apps/v1", "kind": kind, "name": name, "controller": true}}
+	}
+	object := func(gvrText, kind, namespace, name string, fields map[string]interface{}) *CachedObject {
+		obj := map[string]interface{}{"apiVersion": "v1", "kind": kind,
+			"metadata": map[string]interface{}{"name": name, "namespace": namespace, "resourceVersion": "1"}}
+		for key, value := range fields {
+			if key == "ownerReferences" {
+				obj["metadata"].(map[string]interface{})[key] = value
+				continue
+			}
+			obj[key] = value
+		}
+		return cacheObject(gvrText, &unstructured.Unstructured{Object: obj}, "ADD")
+	}
+	node := func(ready string) *CachedObject {
+		return object("v1/nodes", "Node", "", "node-a", map[string]interface{}{"status": map[string]interface{}{
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready", "status": ready}}}})
+	}
+
+	podSpec, err := ParseCacheSpec(`{"gvr":"v1/pods","relations":[{"name":"node"},{"name":"workload"}],
+		"fields":["metadata.name","related.node.status","related.workload.metadata.name"]}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if podSpec.Relations[0].GVR != "v1/nodes" || !podSpec.Relations[0].ClusterScoped || !podSpec.Relations[1].Owner {
+		t.Fatalf("expected the well-known relations to be completed, got %+v", podSpec.Relations)
+	}
+	serviceSpec, err := ParseCacheSpec(`{"gvr":"v1/services","relations":[{"name":"endpoints"}]}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if !registerSpecRelations(podSpec) || !registerSpecRelations(serviceSpec) || registerSpecRelations(podSpec) {
+		t.Fatal("expected relations to report changes only when new")
+	}
+
+	cache := NewCollectorCache()
+	cache.Upsert(node("True"))
+	cache.Upsert(object("apps/v1/deployments", "Deployment", "prod", "api", nil))
+	cache.Upsert(object("apps/v1/replicasets", "ReplicaSet", "prod", "api-5d8f", map[string]interface{}{"ownerReferences": owned("Deployment", "api")}))
+	cache.Upsert(object("v1/pods", "Pod", "prod", "api-0", map[string]interface{}{
+		"ownerReferences": owned("ReplicaSet", "api-5d8f"), "spec": map[string]interface{}{"nodeName": "node-a"}}))
+	cache.Upsert(object("v1/services", "Service", "prod", "api", nil))
+	cache.Upsert(object("v1/endpoints", "Endpoints", "prod", "api", map[string]interface{}{
+		"subsets": []interface{}{map[string]interface{}{"addresses": []interface{}{map[string]interface{}{"ip": "10.0.0.7"}}}}}))
+
+	related := func(gvrText, name, field string) interface{} {
+		item, _ := cache.Get(gvrText, "prod", name)
+		value, _ := FieldValue(withRelated(cache, []string{field}, []*CachedObject{item})[0], field)
+		return value
+	}
+	if value := related("v1/pods", "api-0", "related.node.status"); value != "Ready" {
+		t.Fatalf("expected the node status, got %v", value)
+	}
+	if value := related("v1/pods", "api-0", "related.workload.metadata.name"); value != "api" {
+		t.Fatalf("expected the deployment through the replica set, got %v", value)
+	}
+	if value := related("v1/services", "api", "related.endpoints.subsets"); value == nil {
+		t.Fatal("expected the endpoints of the service")
+	}
+
+	cache.Upsert(node("False"))
+	if value := related("v1/pods", "api-0", "related.node.status"); value != "NotReady" {
+		t.Fatalf("expected the related node change to show, got %v", value)
+	}
+	cache.Upsert(object("v1/pods", "Pod", "prod", "api-0", map[string]interface{}{"spec": map[string]interface{}{"nodeName": "node-b"}}))
+	if value := related("v1/pods", "api-0", "related.node.status"); value != nil {
+		t.Fatalf("expected the pod's move to an uncached node to clear the field, got %v", value)
+	}
+	pod, _ := cache.Get("v1/pods", "prod", "api-0")
+	if _, err = BuildCTable(withRelated(cache, podSpec.Fields, []*CachedObject{pod}), podSpec.Fields, nil); err != nil {
+		t.Fatalf("table: %v", err)
+	}
+
+	for _, raw := range []string{
+		`{"gvr":"v1/pods","relations":[{"name":"unknown"}]}`,
+		`{"gvr":"v1/pods","relations":[{"name":"a.b","owner":true}]}`,
+		`{"gvr":"v1/pods","relations":[{"name":"x","gvr":"v1/nodes"}]}`,
+	} {
+		if _, err = ParseCacheSpec(raw, nil); err == nil {
+			t.Fatalf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestGraphResultBuildsTopology(t *testing.T) {
+	cached := func(gvrText, kind, name, uid string, fields map[string]interface{}) *CachedObject {
+		obj := map[string]interface{}{"apiVersion": "v1", "kind": kind,
+			"metadata": map[string]interface{}{"name": name, "namespace": "prod", "uid": uid}}
+		for key, value := range fields {
+			if key == "labels" || key == "ownerReferences" {
+				obj["metadata"].(map[string]interface{})[key] = value
+				continue
+			}
+			obj[key] = value
+		}
+		return normalizeObject(gvrText, &unstructured.Unstructured{Object: obj}, "ADD")
+	}
+	ownedBy := func(uid string) []interface{} {
+		return []interface{}{map[string]interface{}{"uid": uid, "controller": true}}
+	}
+	objects := []*CachedObject{
+		cached("apps/v1/deployments", "Deployment", "api", "d1", nil),
+		cached("apps/v1/replicasets", "ReplicaSet", "api-5d8f", "r1", map[string]interface{}{"ownerReferences": ownedBy("d1")}),
+		cached("v1/pods", "Pod", "api-0", "p1", map[string]interface{}{
+			"ownerReferences": ownedBy("r1"), "labels": map[string]interface{}{"app": "api"}}),
+		cached("v1/pods", "Pod", "db-0", "p2", map[string]interface{}{"labels": map[string]interface{}{"app": "db"}}),
+		cached("v1/services", "Service", "api", "s1", map[string]interface{}{
+			"spec": map[string]interface{}{"selector": map[string]interface{}{"app": "api"}}}),
+		cached("v1/endpoints", "Endpoints", "api", "e1", map[string]interface{}{"subsets": []interface{}{map[string]interface{}{
+			"addresses": []interface{}{map[string]interface{}{"targetRef": map[string]interface{}{"kind": "Pod", "name": "api-0", "uid": "p1"}}}}}}),
+		cached("networking.k8s.io/v1/ingresses", "Ingress", "web", "i1", map[string]interface{}{"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{"http": map[string]interface{}{"paths": []interface{}{
+				map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "api"}}},
+				map[string]interface{}{"backend": map[string]interface{}{"service": map[string]interface{}{"name": "missing"}}}}}}}}}),
+		cached("networking.istio.io/v1beta1/virtualservices", "VirtualService", "api", "v1", map[string]interface{}{"spec": map[string]interface{}{
+			"http": []interface{}{map[string]interface{}{"route": []interface{}{
+				map[string]interface{}{"destination": map[string]interface{}{"host": "api.prod.svc.cluster.local"}}}}}}}),
+	}
+
+	topology := BuildTopology(objects)
+	if len(topology.Nodes) != len(objects) {
+		t.Fatalf("expected a node per object, got %d", len(topology.Nodes))
+	}
+	id := func(gvrText, name string) string { return cacheKey(gvrText, "prod", name) }
+	expected := map[string]bool{
+		id("apps/v1/deployments", "api") + "|" + id("apps/v1/replicasets", "api-5d8f") + "|" + EdgeOwns:              true,
+		id("apps/v1/replicasets", "api-5d8f") + "|" + id("v1/pods", "api-0") + "|" + EdgeOwns:                        true,
+		id("v1/services", "api") + "|" + id("v1/pods", "api-0") + "|" + EdgeSelects:                                  true,
+		id("v1/services", "api") + "|" + id("v1/endpoints", "api") + "|" + EdgeEndpoints:                             true,
+		id("v1/endpoints", "api") + "|" + id("v1/pods", "api-0") + "|" + EdgeTargets:                                 true,
+		id("networking.k8s.io/v1/ingresses", "web") + "|" + id("v1/services", "api") + "|" + EdgeRoutes:              true,
+		id("networking.istio.io/v1beta1/virtualservices", "api") + "|" + id("v1/services", "api") + "|" + EdgeRoutes: true,
+	}
+	if len(topology.Edges) != len(expected) {
+		t.Fatalf("expected %d edges, got %d", len(expected), len(topology.Edges))
+	}
+	for _, edge := range topology.Edges {
+		key := stringOf(edge.Object, "from") + "|" + stringOf(edge.Object, "to") + "|" + stringOf(edge.Object, "type")
+		if !expected[key] {
+			t.Fatalf("unexpected edge %s", key)
+		}
+	}
+
+	cmap, err := BuildGraphCMap(topology)
+	if err != nil {
+		t.Fatalf("graph: %v", err)
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(cmap); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded := decodeResult(t, &l8tpollaris.CJob{Result: enc.Data()}).(*l8tpollaris.CMap)
+	nodes := decodeResult(t, &l8tpollaris.CJob{Result: decoded.Data["nodes"]}).(*l8tpollaris.CTable)
+	edges := decodeResult(t, &l8tpollaris.CJob{Result: decoded.Data["edges"]}).(*l8tpollaris.CTable)
+	if len(nodes.Rows) != len(objects) || len(edges.Rows) != len(expected) || edges.Columns[2] != "type" {
+		t.Fatalf("unexpected graph tables: %d nodes, %d edges, columns %v", len(nodes.Rows), len(edges.Rows), edges.Columns)
+	}
+
+	spec, err := ParseCacheSpec(`{"result":"graph","namespaceFromArg":"ns"}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if spec.GVR != TopologyGVRs[0] || len(spec.watchedSpecs()) != len(TopologyGVRs) || !spec.watchedSpecs()[0].optional {
+		t.Fatalf("expected the graph to read the topology GVRs, got %s %v", spec.GVR, spec.Graph)
+	}
+	poll := &l8tpollaris.L8Poll{Protocol: l8tpollaris.L8PProtocol_L8PKubernetesAPI, What: `{"result":"graph","namespaceFromArg":"ns"}`}
+	if !PollCovers(poll, map[string]string{"ns": "prod"}, "networking.k8s.io/v1/ingresses", "prod") ||
+		PollCovers(poll, map[string]string{"ns": "prod"}, "v1/configmaps", "prod") {
+		t.Fatal("expected a graph poll to cover exactly its GVRs")
+	}
+	if _, err = ParseCacheSpec(`{"result":"graph","graph":["pods"]}`, nil); err == nil {
+		t.Fatal("expected an invalid graph gvr to be rejected")
+	}
+}
+
+func TestRefreshKeepsComputedFieldsOfProjectedObjects(t *testing.T) {
+	resetPods := func() {
+		projections.mu.Lock()
+		delete(projections.byGVR, "v1/pods")
+		projections.mu.Unlock()
+		enrichers.mu.Lock()
+		delete(enrichers.targets, "v1/pods")
+		enrichers.mu.Unlock()
+	}
+	resetPods()
+	defer resetPods()
+	collector := &ClientGoCollector{}
+	rt := shared.acquire("test#refresh", collector)
+	collector.runtime = rt
+	defer shared.release(rt, collector, nil)
+
+	projected, err := ParseCacheSpec(`{"gvr":"v1/pods","project":["spec.nodeName"]}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if err = collector.applySpec(projected); err != nil {
+		t.Fatalf("applySpec: %v", err)
+	}
+	rt.cache.Upsert(cacheObject("v1/pods", &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1", "kind": "Pod",
+		"metadata": map[string]interface{}{"name": "api-0", "namespace": "prod", "creationTimestamp": "2026-01-01T00:00:00Z"},
+		"spec":     map[string]interface{}{"nodeName": "node-a"},
+		"status": map[string]interface{}{"phase": "Running", "containerStatuses": []interface{}{
+			map[string]interface{}{"name": "app", "ready": true, "restartCount": int64(3)}}},
+	}}, "ADD"))
+	computed := func() map[string]interface{} {
+		item, _ := rt.cache.Get("v1/pods", "prod", "api-0")
+		return item.Object["_k"].(map[string]interface{})
+	}
+	if computed()["restarts"] != "3" || computed()["ready"] != "1/1" {
+		t.Fatalf("unexpected computed fields %v", computed())
+	}
+
+	enriched, err := ParseCacheSpec(`{"gvr":"v1/pods","project":["spec.nodeName"],"enrich":{"node":".spec.nodeName"}}`, nil)
+	if err != nil {
+		t.Fatalf("spec: %v", err)
+	}
+	if err = collector.applySpec(enriched); err != nil {
+		t.Fatalf("applySpec: %v", err)
+	}
+	if fields := computed(); fields["restarts"] != "3" || fields["ready"] != "1/1" || fields["node"] != "node-a" || fields["age"] == "" {
+		t.Fatalf("expected the refresh to keep the computed fields and add the new ones, got %v", fields)
+	}
+}
@@ -15,31 +15,17 @@ import (
 // The goal is to produce the same attribute values that "kubectl get -o wide"
 // displays so that the k8sclient protocol is format-compatible with the
 // kubectl protocol when processed by the downstream parser.
+//
+// The enrichers applied to each GVR come from the enricher registry (see
+// RegisterEnricher), which holds the built-ins below.
 func enrichObject(gvr string, obj map[string]interface{}) {
 	if obj == nil {
 		return
 	}
-	resource := resourceFromGVR(gvr)
 	computed := make(map[string]interface{})
-
-	switch resource {
-	case "nodes":
-		enrichNode(obj, computed)
-	case "pods":
-		enrichPod(obj, computed)
-	case "deployments":
-		enrichDeployment(obj, computed)
-	case "statefulsets":
-		enrichStatefulSet(obj, computed)
-	case "daemonsets":
-		enrichDaemonSet(obj, computed)
-	case "services":
-		enrichService(obj, computed)
+	for _, enrich := range enrichersFor(gvr) {
+		enrich(obj, computed)
 	}
-
-	// Always compute relative age from creationTimestamp.
-	enrichAge(obj, computed)
-
 	if len(computed) > 0 {
 		obj["_k"] = computed
 	}
@@ -401,6 +387,225 @@ func servicePortsString(obj map[string]interface{}) string {
 	return strings.Join(parts, ",")
 }
 
+// --- job ---
+
+func enrichJob(obj map[string]interface{}, out map[string]interface{}) {
+	out["status"] = jobStatus(obj)
+	succeeded := intOr(obj, 0, "status", "succeeded")
+	completions := intOr(obj, -1, "spec", "completions")
+	parallelism := intOr(obj, 1, "spec", "parallelism")
+	switch {
+	case completions >= 0:
+		out["completions"] = fmt.Sprintf("%d/%d", succeeded, completions)
+	case parallelism > 1:
+		out["completions"] = fmt.Sprintf("%d/1 of %d", succeeded, parallelism)
+	default:
+		out["completions"] = fmt.Sprintf("%d/1", succeeded)
+	}
+	out["duration"] = jobDuration(obj)
+	enrichPodTemplate(obj, out)
+	out["selector"] = matchLabelsString(obj, "spec", "selector", "matchLabels")
+}
+
+func jobStatus(obj map[string]interface{}) string {
+	conditions, _ := nestedSlice(obj, "status", "conditions")
+	for _, c := range mapsOf(conditions) {
+		if stringOf(c, "status") != "True" {
+			continue
+		}
+		switch stringOf(c, "type") {
+		case "Complete":
+			return "Complete"
+		case "Failed":
+			return "Failed"
+		case "Suspended":
+			return "Suspended"
+		}
+	}
+	if suspend, _ := nestedValue(obj, []string{"spec", "suspend"}); suspend == true {
+		return "Suspended"
+	}
+	return "Running"
+}
+
+func jobDuration(obj map[string]interface{}) string {
+	start, ok := timestampOf(obj, "status", "startTime")
+	if !ok {
+		return ""
+	}
+	end, ok := timestampOf(obj, "status", "completionTime")
+	if !ok {
+		end = time.Now()
+	}
+	return formatRelativeAge(end.Sub(start))
+}
+
+// --- cronjob ---
+
+func enrichCronJob(obj map[string]interface{}, out map[string]interface{}) {
+	out["schedule"] = stringOr(obj, "", "spec", "schedule")
+	out["timezone"] = stringOr(obj, "<none>", "spec", "timeZone")
+	suspend, _ := nestedValue(obj, []string{"spec", "suspend"})
+	out["suspend"] = "False"
+	if suspend == true {
+		out["suspend"] = "True"
+	}
+	active, _ := nestedSlice(obj, "status", "active")
+	out["active"] = fmt.Sprint(len(active))
+	out["lastschedule"] = "<none>"
+	if last, ok := timestampOf(obj, "status", "lastScheduleTime"); ok {
+		out["lastschedule"] = formatRelativeAge(time.Since(last))
+	}
+	template, _ := nestedMap(obj, "spec", "jobTemplate")
+	enrichPodTemplate(template, out)
+	out["selector"] = matchLabelsString(template, "spec", "selector", "matchLabels")
+}
+
+// --- persistentvolumeclaim ---
+
+var accessModeAbbreviations = map[string]string{
+	"ReadWriteOnce":    "RWO",
+	"ReadOnlyMany":     "ROX",
+	"ReadWriteMany":    "RWX",
+	"ReadWriteOncePod": "RWOP",
+}
+
+func enrichPVC(obj map[string]interface{}, out map[string]interface{}) {
+	out["status"] = stringOr(obj, "", "status", "phase")
+	out["volume"] = stringOr(obj, "", "spec", "volumeName")
+	out["capacity"] = stringOr(obj, "", "status", "capacity", "storage")
+	modes, _ := nestedSlice(obj, "status", "accessModes")
+	abbreviated := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		name := fmt.Sprint(mode)
+		if short, ok := accessModeAbbreviations[name]; ok {
+			name = short
+		}
+		abbreviated = append(abbreviated, name)
+	}
+	out["accessmodes"] = strings.Join(abbreviated, ",")
+	out["storageclass"] = stringOr(obj, "<unset>", "spec", "storageClassName")
+	out["volumemode"] = stringOr(obj, "Filesystem", "spec", "volumeMode")
+}
+
+// --- ingress ---
+
+func enrichIngress(obj map[string]interface{}, out map[string]interface{}) {
+	out["class"] = stringOr(obj, "<none>", "spec", "ingressClassName")
+	rules, _ := nestedSlice(obj, "spec", "rules")
+	hosts := make([]string, 0, len(rules))
+	for _, rule := range mapsOf(rules) {
+		if host := stringOf(rule, "host"); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	out["hosts"] = "*"
+	if len(hosts) > 0 {
+		out["hosts"] = strings.Join(hosts, ",")
+	}
+	out["address"] = loadBalancerAddress(obj)
+	out["ports"] = "80"
+	if tls, _ := nestedSlice(obj, "spec", "tls"); len(tls) > 0 {
+		out["ports"] = "80, 443"
+	}
+}
+
+func loadBalancerAddress(obj map[string]interface{}) string {
+	ingress, _ := nestedSlice(obj, "status", "loadBalancer", "ingress")
+	parts := make([]string, 0, len(ingress))
+	for _, entry := range mapsOf(ingress) {
+		if ip := stringOf(entry, "ip"); ip != "" {
+			parts = append(parts, ip)
+		} else if hostname := stringOf(entry, "hostname"); hostname != "" {
+			parts = append(parts, hostname)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// --- horizontalpodautoscaler ---
+
+func enrichHPA(obj map[string]interface{}, out map[string]interface{}) {
+	out["reference"] = stringOr(obj, "", "spec", "scaleTargetRef", "kind") + "/" +
+		stringOr(obj, "", "spec", "scaleTargetRef", "name")
+	out["targets"] = hpaTargets(obj)
+	out["minpods"] = fmt.Sprint(intOr(obj, 1, "spec", "minReplicas"))
+	out["maxpods"] = fmt.Sprint(intOr(obj, 0, "spec", "maxReplicas"))
+	out["replicas"] = fmt.Sprint(intOr(obj, 0, "status", "currentReplicas"))
+}
+
+// hpaTargets renders resource utilization metrics as kubectl does, e.g.
+// "cpu: 45%/80%, memory: <unknown>/70%".
+func hpaTargets(obj map[string]interface{}) string {
+	current := make(map[string]int)
+	currentMetrics, _ := nestedSlice(obj, "status", "currentMetrics")
+	for _, metric := range mapsOf(currentMetrics) {
+		resource, _ := nestedMap(metric, "resource")
+		if value, ok := nestedValue(resource, []string{"current", "averageUtilization"}); ok {
+			if n, ok := toInt(value); ok {
+				current[stringOf(resource, "name")] = n
+			}
+		}
+	}
+	metrics, _ := nestedSlice(obj, "spec", "metrics")
+	parts := make([]string, 0, len(metrics))
+	for _, metric := range mapsOf(metrics) {
+		if stringOf(metric, "type") != "Resource" {
+			continue
+		}
+		resource, _ := nestedMap(metric, "resource")
+		name := stringOf(resource, "name")
+		target := intOr(resource, -1, "target", "averageUtilization")
+		if target < 0 {
+			continue
+		}
+		value := "<unknown>"
+		if n, ok := current[name]; ok {
+			value = fmt.Sprintf("%d%%", n)
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s/%d%%", name, value, target))
+	}
+	if len(parts) == 0 {
+		return "<none>"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// --- istio ---
+
+func enrichVirtualService(obj map[string]interface{}, out map[string]interface{}) {
+	out["gateways"] = joinedStrings(obj, "spec", "gateways")
+	out["hosts"] = joinedStrings(obj, "spec", "hosts")
+}
+
+func enrichDestinationRule(obj map[string]interface{}, out map[string]interface{}) {
+	out["host"] = stringOr(obj, "", "spec", "host")
+}
+
+func enrichIstioGateway(obj map[string]interface{}, out map[string]interface{}) {
+	servers, _ := nestedSlice(obj, "spec", "servers")
+	hosts := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, server := range mapsOf(servers) {
+		entries, _ := server["hosts"].([]interface{})
+		for _, host := range entries {
+			h := fmt.Sprint(host)
+			if !seen[h] {
+				seen[h] = true
+				hosts = append(hosts, h)
+			}
+		}
+	}
+	out["hosts"] = strings.Join(hosts, ",")
+	out["selector"] = matchLabelsString(obj, "spec", "selector")
+}
+
+func enrichServiceEntry(obj map[string]interface{}, out map[string]interface{}) {
+	out["hosts"] = joinedStrings(obj, "spec", "hosts")
+	out["location"] = stringOr(obj, "", "spec", "location")
+	out["resolution"] = stringOr(obj, "", "spec", "resolution")
+}
+
 // --- shared helpers for pod template ---
 
 func enrichPodTemplate(obj map[string]interface{}, out map[string]interface{}) {
@@ -508,6 +713,36 @@ func formatRelativeAge(d time.Duration) string {
 
 // --- nested access helpers ---
 
+func stringOr(obj map[string]interface{}, fallback string, path ...string) string {
+	val, ok := nestedValue(obj, path)
+	if !ok || val == nil || fmt.Sprint(val) == "" {
+		return fallback
+	}
+	return fmt.Sprint(val)
+}
+
+func joinedStrings(obj map[string]interface{}, path ...string) string {
+	items, _ := nestedSlice(obj, path...)
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		parts = append(parts, fmt.Sprint(item))
+	}
+	return strings.Join(parts, ",")
+}
+
+func timestampOf(obj map[string]interface{}, path ...string) (time.Time, bool) {
+	val, ok := nestedValue(obj, path)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, ok := val.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, ts)
+	return t, err == nil
+}
+
 func nestedMap(obj map[string]interface{}, path ...string) (map[string]interface{}, bool) {
 	val, ok := nestedValue(obj, path)
 	if !ok {
@@ -0,0 +1,177 @@
+package k8sclient
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Enricher computes kubectl-style fields for a raw K8s object. It reads obj
+// and writes its fields into out, which becomes obj["_k"].
+type Enricher func(obj map[string]interface{}, out map[string]interface{})
+
+// BuiltinEnricher is the name under which the built-in enricher of each
+// resource is registered. Registering another enricher under this name for
+// the same resource, or for a more specific target, overrides it.
+const BuiltinEnricher = "builtin"
+
+type namedEnricher struct {
+	name       string
+	fn         Enricher
+	expression string // JSONPath of a cache spec enricher
+}
+
+var enrichers = struct {
+	mu      sync.RWMutex
+	targets map[string][]namedEnricher
+}{targets: make(map[string][]namedEnricher)}
+
+// RegisterEnricher registers fn under name for target, which is one of:
+//   - a GVR, e.g. "batch/v1/jobs"
+//   - a group-qualified resource, e.g. "virtualservices.networking.istio.io"
+//   - a resource, e.g. "jobs"
+//   - "*" for every object
+//
+// An object runs the enrichers of all matching targets, from the least to
+// the most specific. Names are shared across targets: an enricher registered
+// for a more specific target replaces the one with the same name from a less
+// specific target, and registering a name again for the same target replaces
+// it. A nil fn removes the registration.
+func RegisterEnricher(target, name string, fn Enricher) {
+	registerEnricher(target, name, "", fn)
+}
+
+func registerEnricher(target, name, expression string, fn Enricher) {
+	enrichers.mu.Lock()
+	defer enrichers.mu.Unlock()
+	list := enrichers.targets[target]
+	for i, entry := range list {
+		if entry.name != name {
+			continue
+		}
+		if fn == nil {
+			enrichers.targets[target] = append(list[:i:i], list[i+1:]...)
+		} else {
+			list[i].fn, list[i].expression = fn, expression
+		}
+		return
+	}
+	if fn != nil {
+		enrichers.targets[target] = append(list, namedEnricher{name: name, fn: fn, expression: expression})
+	}
+}
+
+// enricherTargets returns the targets matching gvr, least specific first.
+func enricherTargets(gvr string) []string {
+	resource := resourceFromGVR(gvr)
+	targets := []string{"*", resource}
+	if parts := strings.Split(gvr, "/"); len(parts) == 3 {
+		targets = append(targets, resource+"."+parts[0])
+	}
+	return append(targets, gvr)
+}
+
+// enrichersFor resolves the enrichers to run for gvr.
+func enrichersFor(gvr string) []Enricher {
+	enrichers.mu.RLock()
+	defer enrichers.mu.RUnlock()
+	var resolved []namedEnricher
+	for _, target := range enricherTargets(gvr) {
+	next:
+		for _, entry := range enrichers.targets[target] {
+			for i := range resolved {
+				if resolved[i].name == entry.name {
+					resolved[i].fn = entry.fn
+					continue next
+				}
+			}
+			resolved = append(resolved, entry)
+		}
+	}
+	result := make([]Enricher, len(resolved))
+	for i, entry := range resolved {
+		result[i] = entry.fn
+	}
+	return result
+}
+
+// JSONPathEnricher returns an enricher setting the computed field to the
+// result of a kubectl-style JSONPath expression, e.g.
+// "{.status.containerStatuses[*].restartCount}". Braces are optional.
+// Missing keys produce an empty value.
+func JSONPathEnricher(field, expression string) (Enricher, error) {
+	expression = strings.TrimSpace(expression)
+	if !strings.HasPrefix(expression, "{") {
+		expression = "{" + expression + "}"
+	}
+	path := jsonpath.New(field).AllowMissingKeys(true)
+	if err := path.Parse(expression); err != nil {
+		return nil, fmt.Errorf("invalid jsonpath for %s: %w", field, err)
+	}
+	var mu sync.Mutex
+	return func(obj map[string]interface{}, out map[string]interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		buf := &bytes.Buffer{}
+		if err := path.Execute(buf, obj); err != nil {
+			return
+		}
+		out[field] = buf.String()
+	}, nil
+}
+
+// registerSpecEnrichers registers the JSONPath enrichers declared by a
+// cache spec for its GVR, one per field, so that a changed expression
+// replaces the enricher of the field. It returns true if any registration
+// is new or changed, meaning cached objects of the GVR need to be enriched
+// again.
+func registerSpecEnrichers(spec *CacheSpec) (bool, error) {
+	changed := false
+	for field, expression := range spec.Enrich {
+		name := "spec:" + field
+		enrichers.mu.RLock()
+		exists := false
+		for _, entry := range enrichers.targets[spec.GVR] {
+			if entry.name == name && entry.expression == expression {
+				exists = true
+				break
+			}
+		}
+		enrichers.mu.RUnlock()
+		if exists {
+			continue
+		}
+		fn, err := JSONPathEnricher(field, expression)
+		if err != nil {
+			return changed, err
+		}
+		registerEnricher(spec.GVR, name, expression, fn)
+		changed = true
+	}
+	return changed, nil
+}
+
+func init() {
+	RegisterEnricher("nodes", BuiltinEnricher, enrichNode)
+	RegisterEnricher("pods", BuiltinEnricher, enrichPod)
+	RegisterEnricher("deployments", BuiltinEnricher, enrichDeployment)
+	RegisterEnricher("statefulsets", BuiltinEnricher, enrichStatefulSet)
+	RegisterEnricher("daemonsets", BuiltinEnricher, enrichDaemonSet)
+	RegisterEnricher("services", BuiltinEnricher, enrichService)
+	RegisterEnricher("jobs", BuiltinEnricher, enrichJob)
+	RegisterEnricher("cronjobs", BuiltinEnricher, enrichCronJob)
+	RegisterEnricher("persistentvolumeclaims", BuiltinEnricher, enrichPVC)
+	RegisterEnricher("ingresses", BuiltinEnricher, enrichIngress)
+	RegisterEnricher("horizontalpodautoscalers", BuiltinEnricher, enrichHPA)
+	RegisterEnricher("virtualservices.networking.istio.io", BuiltinEnricher, enrichVirtualService)
+	RegisterEnricher("destinationrules.networking.istio.io", BuiltinEnricher, enrichDestinationRule)
+	RegisterEnricher("gateways.networking.istio.io", BuiltinEnricher, enrichIstioGateway)
+	RegisterEnricher("serviceentries.networking.istio.io", BuiltinEnricher, enrichServiceEntry)
+	RegisterEnricher("nodes.metrics.k8s.io", BuiltinEnricher, enrichUsage)
+	RegisterEnricher("pods.metrics.k8s.io", BuiltinEnricher, enrichUsage)
+	// Always compute relative age from creationTimestamp.
+	RegisterEnricher("*", "age", enrichAge)
+}
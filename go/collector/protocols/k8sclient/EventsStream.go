@@ -0,0 +1,337 @@
+package k8sclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+	"github.com/saichler/l8types/go/ifs"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// StreamBackoff bounds the delay between reconnect attempts of an events
+// stream. The delay doubles after every failed attempt and is reset once a
+// watch delivers an event.
+var StreamBackoff = struct {
+	Min time.Duration
+	Max time.Duration
+}{Min: time.Second, Max: time.Minute}
+
+// StreamBufferSize bounds the events waiting to be forwarded by a stream.
+// When the handler falls behind, the oldest waiting events are dropped.
+var StreamBufferSize = 256
+
+// eventStream is the long-lived watch of one events-stream job. Every
+// received event is delivered, as a CMap of the spec's fields, in a copy
+// of the job through the collector's stream handler.
+type eventStream struct {
+	collector     *ClientGoCollector
+	runtime       *clusterRuntime
+	template      *l8tpollaris.CJob
+	spec          *CacheSpec
+	namespace     string
+	labelSelector string
+	fieldSelector string
+	buffer        chan *unstructured.Unstructured
+	stop          chan struct{}
+
+	mtx             sync.Mutex
+	resourceVersion string
+	online          bool
+	lastError       string
+	dropped         int
+}
+
+// SetStreamHandler registers the function that receives the job results
+// produced by events streams. It implements common.StreamCollector.
+func (c *ClientGoCollector) SetStreamHandler(handler func(*l8tpollaris.CJob)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streamHandler = handler
+}
+
+func (c *ClientGoCollector) handleStream(job *l8tpollaris.CJob) {
+	c.mu.Lock()
+	handler := c.streamHandler
+	c.mu.Unlock()
+	if handler != nil {
+		handler(job)
+	}
+}
+
+// execEventsStream makes sure the events stream of job is running, with
+// the namespace and selectors resolved from the job's arguments. A new
+// stream resumes from the resourceVersion of the job's resume argument,
+// when set. Events are delivered asynchronously, so the job itself carries
+// no result; it reports an error while the stream is down.
+func (c *ClientGoCollector) execEventsStream(job *l8tpollaris.CJob, spec *CacheSpec, namespace, selector, fieldSelector string) {
+	key := job.PollarisName + "::" + job.JobName
+	c.mu.Lock()
+	if c.streamHandler == nil {
+		c.mu.Unlock()
+		job.Error = "kubernetes events stream requires a stream handler"
+		job.ErrorCount++
+		return
+	}
+	if c.streams == nil {
+		c.streams = make(map[string]*eventStream)
+	}
+	stream, ok := c.streams[key]
+	if ok && (stream.runtime != c.runtime || stream.namespace != namespace ||
+		stream.labelSelector != selector || stream.fieldSelector != fieldSelector) {
+		stream.close()
+		ok = false
+	}
+	if !ok {
+		stream = &eventStream{
+			collector:       c,
+			runtime:         c.runtime,
+			template:        streamTemplate(job),
+			spec:            spec,
+			namespace:       namespace,
+			labelSelector:   selector,
+			fieldSelector:   fieldSelector,
+			buffer:          make(chan *unstructured.Unstructured, StreamBufferSize),
+			stop:            make(chan struct{}),
+			resourceVersion: resolveSpecValue("", spec.ResumeFromArg, job.Arguments),
+		}
+		c.streams[key] = stream
+		go stream.run()
+		go stream.forward()
+	}
+	c.mu.Unlock()
+
+	stream.mtx.Lock()
+	defer stream.mtx.Unlock()
+	if !stream.online && stream.lastError != "" {
+		job.Error = "kubernetes events stream down: " + stream.lastError
+		job.ErrorCount++
+	}
+}
+
+// streamTemplate copies the identifying fields of job for stream results.
+func streamTemplate(job *l8tpollaris.CJob) *l8tpollaris.CJob {
+	template := &l8tpollaris.CJob{
+		TargetId:     job.TargetId,
+		HostId:       job.HostId,
+		PollarisName: job.PollarisName,
+		JobName:      job.JobName,
+		LinksId:      job.LinksId,
+		Always:       true,
+	}
+	if job.Arguments != nil {
+		template.Arguments = make(map[string]string, len(job.Arguments))
+		for k, v := range job.Arguments {
+			template.Arguments[k] = v
+		}
+	}
+	return template
+}
+
+// stopStreams terminates every events stream of the collector.
+func (c *ClientGoCollector) stopStreams() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, stream := range c.streams {
+		stream.close()
+		delete(c.streams, key)
+	}
+}
+
+func (s *eventStream) close() {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	select {
+	case <-s.stop:
+	default:
+		close(s.stop)
+	}
+}
+
+func (s *eventStream) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// run keeps the watch open until the stream is stopped, resuming from the
+// last resourceVersion received and reconnecting with exponential backoff.
+func (s *eventStream) run() {
+	delay := StreamBackoff.Min
+	for !s.stopped() {
+		received, err := s.watch()
+		s.mtx.Lock()
+		s.online = false
+		if err != nil {
+			s.lastError = err.Error()
+		}
+		s.mtx.Unlock()
+		if s.stopped() {
+			return
+		}
+		if received {
+			delay = StreamBackoff.Min
+		}
+		if err != nil {
+			s.collector.log(ifs.Warning_Level, "events stream %s failed: %s, reconnecting in %s",
+				s.template.JobName, err.Error(), delay.String())
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > StreamBackoff.Max {
+			delay = StreamBackoff.Max
+		}
+	}
+}
+
+// watch runs one watch of the stream and returns when it ends. received
+// reports whether it delivered an event. An expired resourceVersion makes
+// the stream resume from the current state, skipping what it missed.
+func (s *eventStream) watch() (received bool, err error) {
+	client := s.runtime.client()
+	if client == nil {
+		return false, errNotConnected
+	}
+	gvr, err := ParseGVR(s.spec.GVR)
+	if err != nil {
+		return false, err
+	}
+	gvr = s.runtime.servedGVR(gvr)
+	resource := client.Resource(gvr).Namespace(s.namespace)
+
+	s.mtx.Lock()
+	options := metav1.ListOptions{
+		LabelSelector:       s.labelSelector,
+		FieldSelector:       s.fieldSelector,
+		ResourceVersion:     s.resourceVersion,
+		AllowWatchBookmarks: true,
+	}
+	s.mtx.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-s.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	watcher, err := resource.Watch(ctx, options)
+	if err != nil {
+		if apierrors.IsResourceExpired(err) || apierrors.IsGone(err) {
+			return false, s.resumeFromNow(ctx, resource)
+		}
+		return false, err
+	}
+	defer watcher.Stop()
+
+	s.mtx.Lock()
+	s.online = true
+	s.lastError = ""
+	s.mtx.Unlock()
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Error:
+			status := apierrors.FromObject(event.Object)
+			if apierrors.IsResourceExpired(status) || apierrors.IsGone(status) {
+				return received, s.resumeFromNow(ctx, resource)
+			}
+			return received, status
+		case watch.Bookmark, watch.Added, watch.Modified:
+			item, ok := event.Object.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			s.mtx.Lock()
+			s.resourceVersion = item.GetResourceVersion()
+			s.mtx.Unlock()
+			if event.Type != watch.Bookmark {
+				s.enqueue(item)
+				received = true
+			}
+		}
+	}
+	return received, nil
+}
+
+// resumeFromNow moves the stream's position to the current state.
+func (s *eventStream) resumeFromNow(ctx context.Context, resource interface {
+	List(context.Context, metav1.ListOptions) (*unstructured.UnstructuredList, error)
+}) error {
+	list, err := resource.List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	s.resourceVersion = list.GetResourceVersion()
+	s.mtx.Unlock()
+	return nil
+}
+
+// enqueue buffers an event for forwarding, dropping the oldest waiting
+// event when the buffer is full.
+func (s *eventStream) enqueue(item *unstructured.Unstructured) {
+	for {
+		select {
+		case s.buffer <- item:
+			return
+		default:
+		}
+		select {
+		case <-s.buffer:
+			s.mtx.Lock()
+			s.dropped++
+			s.mtx.Unlock()
+		default:
+		}
+	}
+}
+
+// forward delivers the buffered events until the stream is stopped.
+func (s *eventStream) forward() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case item := <-s.buffer:
+			s.collector.handleStream(s.result(item))
+		}
+		s.mtx.Lock()
+		dropped := s.dropped
+		s.dropped = 0
+		s.mtx.Unlock()
+		if dropped > 0 {
+			s.collector.log(ifs.Warning_Level, "events stream %s fell behind, dropped %d events",
+				s.template.JobName, dropped)
+		}
+	}
+}
+
+func (s *eventStream) result(item *unstructured.Unstructured) *l8tpollaris.CJob {
+	job := streamTemplate(s.template)
+	cmap, err := BuildCMap(normalizeObject(s.spec.GVR, item, ModeEventsStream), s.spec.Fields)
+	if err != nil {
+		job.Error = err.Error()
+		return job
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(cmap); err != nil {
+		job.Error = err.Error()
+		return job
+	}
+	job.Result = enc.Data()
+	return job
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 )
 
 // ParseGVR parses resource strings in the form:
@@ -30,3 +31,77 @@ func ParseGVR(raw string) (schema.GroupVersionResource, error) {
 		return schema.GroupVersionResource{}, fmt.Errorf("invalid gvr %q", raw)
 	}
 }
+
+// servedGVR resolves gvr to a version the cluster serves. A GVR whose
+// version is served is returned as is; otherwise the preferred version of
+// its group that serves the resource is used, so that a model still naming
+// an older version (e.g. Istio v1beta1 after the upgrade to v1) keeps being
+// watched. Resolutions are remembered until the runtime disconnects. When
+// discovery is unavailable or the resource is unknown, gvr is returned.
+func (s *clusterRuntime) servedGVR(gvr schema.GroupVersionResource) schema.GroupVersionResource {
+	s.mu.Lock()
+	disc := s.discovery
+	resolved, ok := s.served[gvr.String()]
+	s.mu.Unlock()
+	if ok {
+		return resolved
+	}
+	if disc == nil {
+		return gvr
+	}
+
+	resolved = gvr
+	if !servesResource(disc, gvr.GroupVersion().String(), gvr.Resource) {
+		lists, err := discovery.ServerPreferredResources(disc)
+		if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+			return gvr
+		}
+		for _, list := range lists {
+			gv, err := schema.ParseGroupVersion(list.GroupVersion)
+			if err != nil || gv.Group != gvr.Group {
+				continue
+			}
+			for _, resource := range list.APIResources {
+				if resource.Name == gvr.Resource {
+					resolved = gv.WithResource(gvr.Resource)
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.served[gvr.String()] = resolved
+	s.mu.Unlock()
+	return resolved
+}
+
+// serves reports whether the cluster serves gvrText in some version. It
+// assumes so when discovery is unavailable.
+func (s *clusterRuntime) serves(gvrText string) bool {
+	gvr, err := ParseGVR(gvrText)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	disc := s.discovery
+	s.mu.Unlock()
+	if disc == nil {
+		return true
+	}
+	gvr = s.servedGVR(gvr)
+	return servesResource(disc, gvr.GroupVersion().String(), gvr.Resource)
+}
+
+// servesResource reports whether the group version serves resource.
+func servesResource(disc discovery.DiscoveryInterface, groupVersion, resource string) bool {
+	list, err := disc.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil || list == nil {
+		return false
+	}
+	for _, served := range list.APIResources {
+		if served.Name == resource {
+			return true
+		}
+	}
+	return false
+}
@@ -1,53 +1,146 @@
 package k8sclient
 
-// gvrToLinksId maps GVR strings (as used by informers) to LinksId values
-// (as defined in probler/prob/common/Links_k8s.go and parser/boot/k8s/).
-var gvrToLinksId = map[string]string{
-	"v1/pods":                      "K8sPod",
-	"apps/v1/deployments":          "K8sDeploy",
-	"apps/v1/statefulsets":         "K8sSts",
-	"apps/v1/daemonsets":           "K8sDs",
-	"apps/v1/replicasets":          "K8sRs",
-	"batch/v1/jobs":                "K8sJob",
-	"batch/v1/cronjobs":            "K8sCj",
-	"v1/services":                  "K8sSvc",
-	"v1/configmaps":                "K8sCm",
-	"v1/secrets":                   "K8sSec",
-	"v1/namespaces":                "K8sNs",
-	"v1/nodes":                     "K8sNode",
-	"v1/persistentvolumes":         "K8sPv",
-	"v1/persistentvolumeclaims":    "K8sPvc",
-	"v1/endpoints":                 "K8sEp",
-	"v1/events":                    "K8sEvt",
-	"v1/serviceaccounts":           "K8sSa",
-	"v1/limitranges":               "K8sLr",
-	"v1/resourcequotas":            "K8sRq",
-
-	"networking.k8s.io/v1/ingresses":       "K8sIng",
-	"networking.k8s.io/v1/ingressclasses":  "K8sIngCl",
-	"networking.k8s.io/v1/networkpolicies": "K8sNetPol",
-	"policy/v1/poddisruptionbudgets":       "K8sPdb",
-	"storage.k8s.io/v1/storageclasses":     "K8sScl",
-	"autoscaling/v2/horizontalpodautoscalers":           "K8sHpa",
-	"discovery.k8s.io/v1/endpointslices":                "K8sEpSl",
-	"rbac.authorization.k8s.io/v1/roles":                "K8sRole",
-	"rbac.authorization.k8s.io/v1/rolebindings":         "K8sRb",
-	"rbac.authorization.k8s.io/v1/clusterroles":         "K8sCr",
-	"rbac.authorization.k8s.io/v1/clusterrolebindings":  "K8sCrb",
-	"apiextensions.k8s.io/v1/customresourcedefinitions": "K8sCrd",
-
-	"management.loft.sh/v1/virtualclusterinstances": "K8sVCl",
-
-	"networking.istio.io/v1alpha3/envoyfilters":            "IstioEf",
-	"networking.istio.io/v1beta1/virtualservices":          "IstioVs",
-	"networking.istio.io/v1beta1/destinationrules":         "IstioDr",
-	"networking.istio.io/v1beta1/gateways":                 "IstioGw",
-	"networking.istio.io/v1beta1/serviceentries":           "IstioSe",
-	"networking.istio.io/v1beta1/sidecars":                 "IstioSc",
-	"security.istio.io/v1beta1/authorizationpolicies":      "IstioAp",
-	"security.istio.io/v1beta1/peerauthentications":        "IstioPa",
+import (
+	"fmt"
+	"sync"
+
+	"github.com/saichler/l8parser/go/parser/boot"
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+)
+
+// gvrLinks maps GVR strings (as used by informers) to LinksId values (as
+// defined in probler/prob/common/Links_k8s.go and parser/boot/k8s/).
+//
+// The mapping is derived from the pollaris models: a boot model is named
+// after the LinksId of the objects its Kubernetes polls collect. It is
+// seeded from the boot models on first use and extended at runtime with
+// RegisterGVRLinksId and RegisterGVRLinksFromPollarisModels, and by the jobs
+// the collector executes (see registerJobLinksId).
+//
+// Lookups are version-tolerant: a GVR that is not registered under its exact
+// version resolves through its group and resource, so an API version bump
+// (e.g. Istio v1beta1 to v1) or a webhook event in another served version
+// still maps to the LinksId.
+type gvrLinks struct {
+	mu        sync.RWMutex
+	seed      sync.Once
+	byGVR     map[string]string
+	byGR      map[string]string
+	canonical map[string]string
 }
 
+var links = &gvrLinks{
+	byGVR:     make(map[string]string),
+	byGR:      make(map[string]string),
+	canonical: make(map[string]string),
+}
+
+// GVRToLinksId returns the LinksId of the objects of gvrText, or "" when no
+// pollaris model collects the GVR's group and resource.
 func GVRToLinksId(gvrText string) string {
-	return gvrToLinksId[gvrText]
+	links.ensureSeeded()
+	links.mu.RLock()
+	defer links.mu.RUnlock()
+	if linksId, ok := links.byGVR[gvrText]; ok {
+		return linksId
+	}
+	return links.byGR[groupResource(gvrText)]
+}
+
+// RegisterGVRLinksId maps gvrText, and any other version of its group and
+// resource, to linksId. An empty linksId removes the mapping.
+func RegisterGVRLinksId(gvrText, linksId string) error {
+	gr := groupResource(gvrText)
+	if gr == "" {
+		return fmt.Errorf("invalid gvr %q", gvrText)
+	}
+	links.ensureSeeded()
+	links.register(gvrText, gr, linksId)
+	return nil
+}
+
+// RegisterGVRLinksFromPollarisModels registers the GVR of every Kubernetes
+// poll of the models under the model's name, which is its LinksId.
+func RegisterGVRLinksFromPollarisModels(models []*l8tpollaris.L8Pollaris) error {
+	links.ensureSeeded()
+	return links.registerModels(models)
+}
+
+// registerJobLinksId maps the GVR of spec to the LinksId of job, the parser
+// its results are sent to, when no model maps the GVR yet. Models added at
+// runtime, e.g. CRD polls, thus get their deletions and admission events
+// forwarded once one of their jobs ran; GVRs already mapped are left as is.
+func registerJobLinksId(spec *CacheSpec, job *l8tpollaris.CJob) {
+	if job.LinksId == "" || spec.Result == ResultGraph || !spec.watched() || GVRToLinksId(spec.GVR) != "" {
+		return
+	}
+	_ = RegisterGVRLinksId(spec.GVR, job.LinksId)
+}
+
+// canonicalGVR returns the GVR registered for the group and resource of
+// gvrText, so that objects observed in another served version are cached
+// under the GVR the polls ask for. Unregistered GVRs are returned as is.
+func canonicalGVR(gvrText string) string {
+	links.ensureSeeded()
+	links.mu.RLock()
+	defer links.mu.RUnlock()
+	if _, ok := links.byGVR[gvrText]; ok {
+		return gvrText
+	}
+	if canonical, ok := links.canonical[groupResource(gvrText)]; ok {
+		return canonical
+	}
+	return gvrText
+}
+
+func (l *gvrLinks) ensureSeeded() {
+	l.seed.Do(func() {
+		// The boot models are parsed by the collector on startup as well,
+		// an invalid spec surfaces there.
+		_ = l.registerModels(boot.GetAllPolarisModels())
+	})
+}
+
+func (l *gvrLinks) registerModels(models []*l8tpollaris.L8Pollaris) error {
+	for _, model := range models {
+		if model == nil || model.Name == "" {
+			continue
+		}
+		for _, poll := range model.Polling {
+			if poll == nil || poll.Protocol != l8tpollaris.L8PProtocol_L8PKubernetesAPI {
+				continue
+			}
+			spec, err := ParseCacheSpec(poll.What, poll)
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", model.Name, poll.Name, err)
+			}
+			l.register(spec.GVR, groupResource(spec.GVR), model.Name)
+		}
+	}
+	return nil
+}
+
+func (l *gvrLinks) register(gvrText, gr, linksId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if linksId == "" {
+		delete(l.byGVR, gvrText)
+		if l.canonical[gr] == gvrText {
+			delete(l.byGR, gr)
+			delete(l.canonical, gr)
+		}
+		return
+	}
+	l.byGVR[gvrText] = linksId
+	l.byGR[gr] = linksId
+	l.canonical[gr] = gvrText
+}
+
+// groupResource returns "group/resource" of gvrText, "" if it is invalid.
+func groupResource(gvrText string) string {
+	gvr, err := ParseGVR(gvrText)
+	if err != nil {
+		return ""
+	}
+	return gvr.Group + "/" + gvr.Resource
 }
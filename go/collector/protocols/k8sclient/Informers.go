@@ -0,0 +1,362 @@
+package k8sclient
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/saichler/l8types/go/ifs"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerResync is the resync period of the informers. A resync delivers
+// every object again, refreshing time-relative computed fields such as
+// "_k.age". Zero disables resyncs.
+var InformerResync time.Duration
+
+// InformerIdleTimeout stops an informer when no job has read through it
+// for this long, e.g. because no poll references its GVR any more. Its
+// objects are evicted from the cache unless another informer covers them,
+// and the next job reading the GVR starts it again. Zero keeps informers
+// running until the cluster runtime disconnects.
+var InformerIdleTimeout = 30 * time.Minute
+
+// PrunePaths are removed from every object before it is stored by an
+// informer or the cache. They are large and never read by polls.
+var PrunePaths = [][]string{
+	{"metadata", "managedFields"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+}
+
+// projectionBase is kept by every projection: the identity, labels and
+// owners the cache indexes, and the computed fields.
+var projectionBase = []string{
+	"apiVersion", "kind", "_k",
+	"metadata.name", "metadata.namespace", "metadata.uid", "metadata.resourceVersion",
+	"metadata.labels", "metadata.ownerReferences", "metadata.creationTimestamp",
+}
+
+// watchedInformer is a running informer of a cluster runtime. It stops
+// on its own or with the runtime.
+type watchedInformer struct {
+	key           string
+	gvrText       string
+	namespace     string
+	labelSelector string
+	fieldSelector string
+	informer      cache.SharedIndexInformer
+	stopCh        chan struct{}
+	stopOnce      sync.Once
+	lastUsed      time.Time
+}
+
+func newWatchedInformer(rt *clusterRuntime, key, gvrText, namespace, labelSelector, fieldSelector string) *watchedInformer {
+	w := &watchedInformer{
+		key:           key,
+		gvrText:       gvrText,
+		namespace:     namespace,
+		labelSelector: labelSelector,
+		fieldSelector: fieldSelector,
+		stopCh:        make(chan struct{}),
+		lastUsed:      time.Now(),
+	}
+	runtimeStop := rt.stopCh
+	go func() {
+		select {
+		case <-runtimeStop:
+			w.stop()
+		case <-w.stopCh:
+		}
+	}()
+	return w
+}
+
+func (w *watchedInformer) stop() {
+	w.stopOnce.Do(func() { close(w.stopCh) })
+}
+
+// covers reports whether obj is within the informer's namespace and
+// selectors.
+func (w *watchedInformer) covers(obj *CachedObject) bool {
+	if w.gvrText != obj.GVR || (w.namespace != "" && w.namespace != obj.Namespace) {
+		return false
+	}
+	labelSel, fieldSel, err := parseSelectors(w.labelSelector, w.fieldSelector)
+	return err == nil && matchesSelectors(obj, labelSel, fieldSel)
+}
+
+// touch records that a job read through the informer of key.
+func (s *clusterRuntime) touch(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if w, ok := s.informers[key]; ok {
+		w.lastUsed = time.Now()
+	}
+}
+
+// stopInformers stops the informers of the runtime selected by match and
+// evicts the objects no remaining informer covers. It returns how many
+// informers were stopped.
+func (s *clusterRuntime) stopInformers(match func(*watchedInformer) bool) int {
+	s.mu.Lock()
+	var stopped []*watchedInformer
+	for key, w := range s.informers {
+		if match(w) {
+			stopped = append(stopped, w)
+			delete(s.informers, key)
+			delete(s.warmOnce, key)
+		}
+	}
+	remaining := make([]*watchedInformer, 0, len(s.informers))
+	for _, w := range s.informers {
+		remaining = append(remaining, w)
+	}
+	s.mu.Unlock()
+
+	for _, w := range stopped {
+		w.stop()
+		candidates, _ := s.cache.Select(w.gvrText, w.namespace, w.labelSelector, w.fieldSelector)
+	next:
+		for _, obj := range candidates {
+			for _, other := range remaining {
+				if other.covers(obj) {
+					continue next
+				}
+			}
+			// The object still exists, so this is an eviction and not a
+			// deletion: the delete handlers are not called.
+			s.cache.Delete(obj.GVR, obj.Namespace, obj.Name)
+		}
+	}
+	return len(stopped)
+}
+
+// stopIdleInformers stops the informers unused for InformerIdleTimeout.
+func (s *clusterRuntime) stopIdleInformers(logger ifs.ILogger) {
+	if InformerIdleTimeout <= 0 {
+		return
+	}
+	idleSince := time.Now().Add(-InformerIdleTimeout)
+	var keys []string
+	count := s.stopInformers(func(w *watchedInformer) bool {
+		if w.lastUsed.Before(idleSince) {
+			keys = append(keys, w.key)
+			return true
+		}
+		return false
+	})
+	if count > 0 && logger != nil {
+		logger.Info("cluster runtime ", s.key, ": stopped idle informers ", strings.Join(keys, ", "))
+	}
+}
+
+// StopWatching stops every informer of gvrText in the collector's cluster
+// and evicts their objects from the cache. As the cluster runtime is
+// shared, this affects all the collectors of the cluster; the next job
+// reading the GVR starts watching it again. It returns how many informers
+// were stopped.
+func (c *ClientGoCollector) StopWatching(gvrText string) int {
+	if c.runtime == nil {
+		return 0
+	}
+	return c.runtime.stopInformers(func(w *watchedInformer) bool {
+		return w.gvrText == gvrText
+	})
+}
+
+// refreshGVR normalizes the cached objects of gvrText again, after its
+// enrichers, projection or relations changed. Objects are taken from the
+// informer stores, which hold them whole, and else from the cache (see
+// recacheObject).
+func (s *clusterRuntime) refreshGVR(gvrText string) {
+	s.mu.Lock()
+	var stores []cache.Store
+	for _, w := range s.informers {
+		if w.gvrText == gvrText && w.informer != nil {
+			stores = append(stores, w.informer.GetStore())
+		}
+	}
+	s.mu.Unlock()
+
+	for _, item := range s.cache.List(gvrText, "", "") {
+		var whole *unstructured.Unstructured
+		for _, store := range stores {
+			if obj, ok, _ := store.GetByKey(storeKey(item.Namespace, item.Name)); ok {
+				if whole, ok = obj.(*unstructured.Unstructured); ok {
+					break
+				}
+			}
+		}
+		refreshed := recacheObject(item)
+		if whole != nil {
+			refreshed = cacheObject(item.GVR, whole, item.Operation)
+		}
+		refreshed.ObservedAt = item.ObservedAt
+		s.cache.Upsert(refreshed)
+	}
+}
+
+// timeRelativeFields are the computed fields that change with time alone.
+var timeRelativeFields = map[string]bool{"age": true, "duration": true, "lastschedule": true}
+
+// recacheObject normalizes a cached object again when its whole object is
+// not at hand, e.g. when restored from a snapshot. As the object may have
+// been projected, the computed "_k" fields it holds, computed from the
+// whole object, are kept; only the time-relative fields are recomputed,
+// and the fields of enrichers registered since are added. Likewise, its
+// Related are kept when they cannot be computed from it.
+func recacheObject(item *CachedObject) *CachedObject {
+	refreshed := cacheObject(item.GVR, &unstructured.Unstructured{Object: item.Object}, item.Operation)
+	saved, _ := item.Object["_k"].(map[string]interface{})
+	recomputed, _ := refreshed.Object["_k"].(map[string]interface{})
+	if saved != nil {
+		computed := make(map[string]interface{}, len(saved)+len(recomputed))
+		for key, value := range saved {
+			computed[key] = value
+		}
+		for key, value := range recomputed {
+			if _, ok := saved[key]; !ok || (timeRelativeFields[key] && stringify(value) != "") {
+				computed[key] = value
+			}
+		}
+		refreshed.Object["_k"] = computed
+	}
+	if len(refreshed.Related) == 0 {
+		refreshed.Related = item.Related
+	}
+	return refreshed
+}
+
+// pruneTransform is the informers' transform, pruning objects before they
+// enter the informer store. It does not apply the projections, which only
+// reduce the cache's copies: refreshGVR recomputes them from the stores.
+func pruneTransform(obj interface{}) (interface{}, error) {
+	if item, ok := obj.(*unstructured.Unstructured); ok {
+		pruneObject(item.Object)
+	}
+	return obj, nil
+}
+
+// pruneObject removes PrunePaths from obj.
+func pruneObject(obj map[string]interface{}) {
+	for _, path := range PrunePaths {
+		parent, ok := nestedMap(obj, path[:len(path)-1]...)
+		if ok {
+			delete(parent, path[len(path)-1])
+		}
+	}
+}
+
+// cacheObject normalizes item for the cache, computing its Related from
+// the whole object and keeping only the fields of the projection declared
+// for gvrText by the cache specs.
+func cacheObject(gvrText string, item *unstructured.Unstructured, operation string) *CachedObject {
+	obj := normalizeObject(gvrText, item, operation)
+	if obj != nil {
+		obj.Related = relatedRefs(obj)
+		obj.Object = projectObject(gvrText, obj.Object)
+	}
+	return obj
+}
+
+// projection is the union of the fields the cache specs of a GVR read.
+// whole is set when a spec reads whole objects.
+type projection struct {
+	whole bool
+	paths map[string]struct{}
+}
+
+var projections = struct {
+	mu    sync.RWMutex
+	byGVR map[string]*projection
+}{byGVR: make(map[string]*projection)}
+
+// registerSpecProjection adds the fields spec projects to the projection of
+// its GVR; a spec without projection makes the cache keep whole objects.
+// It returns true when an existing projection widened, meaning cached
+// objects of the GVR lack fields and need to be refreshed.
+func registerSpecProjection(spec *CacheSpec) bool {
+	projections.mu.RLock()
+	current := projections.byGVR[spec.GVR]
+	covered := current != nil && (current.whole || (len(spec.Project) > 0 && current.includes(spec.Project)))
+	projections.mu.RUnlock()
+	if covered {
+		return false
+	}
+
+	projections.mu.Lock()
+	defer projections.mu.Unlock()
+	current, existed := projections.byGVR[spec.GVR]
+	if !existed {
+		current = &projection{paths: make(map[string]struct{})}
+		projections.byGVR[spec.GVR] = current
+	}
+	if current.whole {
+		return false
+	}
+	if len(spec.Project) == 0 {
+		current.whole = true
+		return existed
+	}
+	widened := false
+	for _, path := range spec.Project {
+		if _, ok := current.paths[path]; !ok {
+			current.paths[path] = struct{}{}
+			widened = existed
+		}
+	}
+	return widened
+}
+
+func (p *projection) includes(paths []string) bool {
+	for _, path := range paths {
+		if _, ok := p.paths[path]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// projectObject returns obj reduced to the projection of gvrText, or obj
+// when the GVR has no projection.
+func projectObject(gvrText string, obj map[string]interface{}) map[string]interface{} {
+	projections.mu.RLock()
+	current := projections.byGVR[gvrText]
+	if current == nil || current.whole {
+		projections.mu.RUnlock()
+		return obj
+	}
+	paths := make([]string, 0, len(projectionBase)+len(current.paths))
+	paths = append(paths, projectionBase...)
+	for path := range current.paths {
+		paths = append(paths, path)
+	}
+	projections.mu.RUnlock()
+
+	projected := make(map[string]interface{})
+	for _, path := range paths {
+		copyPath(obj, projected, strings.Split(path, "."))
+	}
+	return projected
+}
+
+// copyPath copies the value at path from src to dst. A path reaching into
+// a list keeps the whole list.
+func copyPath(src, dst map[string]interface{}, path []string) {
+	value, ok := src[path[0]]
+	if !ok {
+		return
+	}
+	child, isMap := value.(map[string]interface{})
+	if len(path) == 1 || !isMap {
+		dst[path[0]] = value
+		return
+	}
+	next, _ := dst[path[0]].(map[string]interface{})
+	if next == nil {
+		next = make(map[string]interface{})
+		dst[path[0]] = next
+	}
+	copyPath(child, next, path[1:])
+}
@@ -0,0 +1,280 @@
+package k8sclient
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LogBufferBytes bounds the log bytes read per container and poll, and
+// LogMaxLines the lines kept from them, the most recent ones.
+var (
+	LogBufferBytes int64 = 1 << 20
+	LogMaxLines          = 1000
+)
+
+// logLine is one line of a container's log.
+type logLine struct {
+	timestamp time.Time
+	message   string
+}
+
+// logPosition is where the next read of a container's log resumes: after
+// the lines at timestamp whose messages were already read, as several
+// lines may share a timestamp.
+type logPosition struct {
+	timestamp time.Time
+	read      []string
+}
+
+// execLogs reads the logs of the containers of the selected pods: the pod
+// named name, or the pods of namespace matching the selectors. Each read
+// resumes after the last line read by the previous poll of the job, or
+// from the job's resume position; the first read is bounded by TailLines
+// or SinceSeconds. The result is a table with a row per line. The positions
+// of the containers no longer selected, e.g. of deleted pods, are dropped.
+func (c *ClientGoCollector) execLogs(job *l8tpollaris.CJob, spec *CacheSpec, namespace, name, selector, fieldSelector string) {
+	rt := c.runtime
+	client := rt.kube()
+	if client == nil {
+		job.Error = errNotConnected.Error()
+		job.ErrorCount++
+		return
+	}
+
+	var pods []*CachedObject
+	if name != "" {
+		if pod, ok := rt.cache.Get(spec.GVR, namespace, name); ok {
+			pods = append(pods, pod)
+		}
+	} else {
+		var err error
+		if pods, err = rt.cache.Select(spec.GVR, namespace, selector, fieldSelector); err != nil {
+			job.Error = err.Error()
+			job.ErrorCount++
+			return
+		}
+	}
+	container := resolveSpecValue(spec.Container, spec.ContainerFromArg, job.Arguments)
+	resume := resolveSpecValue("", spec.ResumeFromArg, job.Arguments)
+
+	rows := make([]*CachedObject, 0)
+	var errs []string
+	selected := make(map[string]bool)
+	for _, pod := range pods {
+		for _, containerName := range podContainers(pod, container) {
+			key := logPositionKey(job, pod.Namespace, pod.Name, containerName)
+			selected[key] = true
+			position, known := c.logPosition(key)
+			if !known && resume != "" {
+				if parsed, err := time.Parse(time.RFC3339Nano, resume); err == nil {
+					position, known = logPosition{timestamp: parsed}, true
+				}
+			}
+			lines, next, err := readContainerLog(client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name,
+				logOptions(spec, containerName, position.timestamp, known)).Stream, position, known)
+			if err != nil {
+				errs = append(errs, pod.Namespace+"/"+pod.Name+"/"+containerName+": "+err.Error())
+				continue
+			}
+			for _, line := range lines {
+				rows = append(rows, logRow(spec.GVR, pod, containerName, line))
+			}
+			if !next.timestamp.IsZero() {
+				c.setLogPosition(key, next)
+			}
+		}
+	}
+	c.dropLogPositions(job, selected)
+	if len(errs) > 0 && len(rows) == 0 {
+		job.Error = "logs: " + strings.Join(errs, "; ")
+		job.ErrorCount++
+		return
+	}
+
+	tbl, err := BuildCTable(rows, spec.Fields, spec.ColumnNames)
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(tbl); err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	job.Result = enc.Data()
+}
+
+// podContainers returns container when set, else the names of the pod's
+// containers.
+func podContainers(pod *CachedObject, container string) []string {
+	if container != "" {
+		return []string{container}
+	}
+	raw, _ := nestedValue(pod.Object, []string{"spec", "containers"})
+	items, _ := raw.([]interface{})
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		if spec, ok := item.(map[string]interface{}); ok {
+			if name, _ := spec["name"].(string); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func logOptions(spec *CacheSpec, container string, since time.Time, resume bool) *corev1.PodLogOptions {
+	limit := LogBufferBytes
+	options := &corev1.PodLogOptions{Container: container, Timestamps: true, LimitBytes: &limit}
+	switch {
+	case resume:
+		sinceTime := metav1.NewTime(since)
+		options.SinceTime = &sinceTime
+	case spec.SinceSeconds > 0:
+		sinceSeconds := spec.SinceSeconds
+		options.SinceSeconds = &sinceSeconds
+	case spec.TailLines > 0:
+		tailLines := spec.TailLines
+		options.TailLines = &tailLines
+	}
+	return options
+}
+
+// readContainerLog reads a log stream, keeping its last LogMaxLines lines,
+// and returns the position after them. When resuming, SinceTime has a one
+// second precision, so lines before the position were already read and
+// are skipped, as are the lines at its timestamp whose messages were read.
+func readContainerLog(open func(context.Context) (io.ReadCloser, error), position logPosition, resume bool) ([]logLine, logPosition, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	stream, err := open(ctx)
+	if err != nil {
+		return nil, position, err
+	}
+	defer stream.Close()
+
+	read := make(map[string]int, len(position.read))
+	for _, message := range position.read {
+		read[message]++
+	}
+	next := logPosition{}
+	// ring keeps the last LogMaxLines lines, oldest is the oldest once full.
+	ring := make([]logLine, 0)
+	oldest := 0
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 0, 64*1024), int(LogBufferBytes))
+	for scanner.Scan() {
+		line := parseLogLine(scanner.Text())
+		if !line.timestamp.IsZero() {
+			if !line.timestamp.Equal(next.timestamp) {
+				next = logPosition{timestamp: line.timestamp}
+			}
+			next.read = append(next.read, line.message)
+		}
+		if resume && !line.timestamp.IsZero() {
+			if line.timestamp.Before(position.timestamp) {
+				continue
+			}
+			if line.timestamp.Equal(position.timestamp) && read[line.message] > 0 {
+				read[line.message]--
+				continue
+			}
+		}
+		if len(ring) < LogMaxLines {
+			ring = append(ring, line)
+			continue
+		}
+		ring[oldest] = line
+		oldest = (oldest + 1) % len(ring)
+	}
+	if err = scanner.Err(); err != nil && len(ring) == 0 {
+		return nil, position, fmt.Errorf("read log: %w", err)
+	}
+	if next.timestamp.IsZero() {
+		next = position
+	}
+	return append(ring[oldest:], ring[:oldest]...), next, nil
+}
+
+// parseLogLine splits the RFC 3339 timestamp the API server prefixes to
+// every line when asked for timestamps.
+func parseLogLine(raw string) logLine {
+	line := logLine{message: raw}
+	if index := strings.IndexByte(raw, ' '); index > 0 {
+		if timestamp, err := time.Parse(time.RFC3339Nano, raw[:index]); err == nil {
+			line.timestamp = timestamp
+			line.message = raw[index+1:]
+		}
+	}
+	return line
+}
+
+func logRow(gvr string, pod *CachedObject, container string, line logLine) *CachedObject {
+	timestamp := ""
+	if !line.timestamp.IsZero() {
+		timestamp = line.timestamp.Format(time.RFC3339Nano)
+	}
+	return &CachedObject{
+		GVR:       gvr,
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		UID:       pod.UID,
+		Operation: ModeLogs,
+		Object: map[string]interface{}{
+			"namespace": pod.Namespace,
+			"pod":       pod.Name,
+			"container": container,
+			"timestamp": timestamp,
+			"message":   line.message,
+		},
+	}
+}
+
+func logPositionKey(job *l8tpollaris.CJob, namespace, pod, container string) string {
+	return logPositionPrefix(job) + namespace + "/" + pod + "/" + container
+}
+
+func logPositionPrefix(job *l8tpollaris.CJob) string {
+	return job.PollarisName + "::" + job.JobName + "::"
+}
+
+// logPosition returns the position after the last log lines read for key.
+func (c *ClientGoCollector) logPosition(key string) (logPosition, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	position, ok := c.logPositions[key]
+	return position, ok
+}
+
+func (c *ClientGoCollector) setLogPosition(key string, position logPosition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.logPositions == nil {
+		c.logPositions = make(map[string]logPosition)
+	}
+	c.logPositions[key] = position
+}
+
+// dropLogPositions removes the positions of job for the containers that
+// are not selected.
+func (c *ClientGoCollector) dropLogPositions(job *l8tpollaris.CJob, selected map[string]bool) {
+	prefix := logPositionPrefix(job)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.logPositions {
+		if strings.HasPrefix(key, prefix) && !selected[key] {
+			delete(c.logPositions, key)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package k8sclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MetricsMaxAge is how long a reading of the metrics APIs is shared by the
+// jobs of a cluster before it is read again. metrics-server refreshes its
+// readings every 15 seconds by default.
+var MetricsMaxAge = 15 * time.Second
+
+// CustomMetricsVersion is the custom.metrics.k8s.io version queried. An
+// older served version is used when the cluster does not serve it.
+var CustomMetricsVersion = "v1beta2"
+
+const (
+	metricsGroup       = "metrics.k8s.io"
+	customMetricsGroup = "custom.metrics.k8s.io"
+)
+
+var metricsGroupVersion = schema.GroupVersion{Group: metricsGroup, Version: "v1beta1"}
+
+// isMetricsGVR reports whether gvrText is a metrics.k8s.io resource. Those
+// cannot be watched, so they are read on demand instead of being cached.
+func isMetricsGVR(gvrText string) bool {
+	gvr, err := ParseGVR(gvrText)
+	return err == nil && gvr.Group == metricsGroup
+}
+
+// metricsCache holds the latest readings of the metrics APIs of a cluster
+// by query.
+type metricsCache struct {
+	mu    sync.Mutex
+	reads map[string]metricsRead
+}
+
+type metricsRead struct {
+	at    time.Time
+	items []*unstructured.Unstructured
+}
+
+// get returns the reading of key, calling read when there is none younger
+// than MetricsMaxAge.
+func (m *metricsCache) get(key string, read func() ([]*unstructured.Unstructured, error)) ([]*unstructured.Unstructured, error) {
+	m.mu.Lock()
+	cached, ok := m.reads[key]
+	m.mu.Unlock()
+	if ok && time.Since(cached.at) < MetricsMaxAge {
+		return cached.items, nil
+	}
+	items, err := read()
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reads == nil {
+		m.reads = make(map[string]metricsRead)
+	}
+	m.reads[key] = metricsRead{at: time.Now(), items: items}
+	return items, nil
+}
+
+func (m *metricsCache) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads = nil
+}
+
+// resourceMetrics lists the NodeMetrics or PodMetrics of namespace, all
+// namespaces when empty.
+func (s *clusterRuntime) resourceMetrics(gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error) {
+	client := s.client()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	gvr = s.servedGVR(gvr)
+	return s.metrics.get(gvr.String()+"|"+namespace, func() ([]*unstructured.Unstructured, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		list, err := client.Resource(gvr).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", gvr.String(), err)
+		}
+		items := make([]*unstructured.Unstructured, len(list.Items))
+		for i := range list.Items {
+			items[i] = &list.Items[i]
+		}
+		return items, nil
+	})
+}
+
+// customMetric reads metric for all the objects of resource in namespace
+// from custom.metrics.k8s.io. It returns the MetricValue items.
+func (s *clusterRuntime) customMetric(resourceName, namespace, metric string) ([]*unstructured.Unstructured, error) {
+	client := s.client()
+	if client == nil {
+		return nil, errNotConnected
+	}
+	gvr := s.servedGVR(schema.GroupVersionResource{Group: customMetricsGroup, Version: CustomMetricsVersion, Resource: resourceName})
+	return s.metrics.get(gvr.String()+"|"+namespace+"|"+metric, func() ([]*unstructured.Unstructured, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		list, err := client.Resource(gvr).Namespace(namespace).Get(ctx, "*", metav1.GetOptions{}, metric)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", gvr.String(), metric, err)
+		}
+		values, _ := nestedSlice(list.Object, "items")
+		items := make([]*unstructured.Unstructured, 0, len(values))
+		for _, value := range mapsOf(values) {
+			items = append(items, &unstructured.Unstructured{Object: value})
+		}
+		return items, nil
+	})
+}
+
+// execMetrics serves a metrics.k8s.io resource like the cache serves the
+// others: the object named name as a map, or the objects matching the
+// selectors as a table. Objects carry the usage fields of enrichUsage.
+func (c *ClientGoCollector) execMetrics(job *l8tpollaris.CJob, spec *CacheSpec, namespace, name, selector, fieldSelector string) {
+	gvr, err := ParseGVR(spec.GVR)
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	labelSel, fieldSel, err := parseSelectors(selector, fieldSelector)
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	items, err := c.runtime.resourceMetrics(gvr, namespace)
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	rows := make([]*CachedObject, 0, len(items))
+	for _, item := range items {
+		obj := normalizeObject(spec.GVR, item, "UPDATE")
+		if (name == "" || obj.Name == name) && matchesSelectors(obj, labelSel, fieldSel) {
+			rows = append(rows, obj)
+		}
+	}
+
+	var result interface{}
+	if spec.Result == ResultMap {
+		if len(rows) == 0 {
+			job.Error = fmt.Sprintf("no metrics for %s/%s/%s", spec.GVR, namespace, name)
+			job.ErrorCount++
+			return
+		}
+		result, err = BuildCMap(rows[0], spec.Fields)
+	} else {
+		result, err = BuildCTable(rows, spec.Fields, spec.ColumnNames)
+	}
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(result); err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	job.Result = enc.Data()
+}
+
+// joinMetrics returns copies of items with the readings of the metrics
+// APIs added to their computed "_k" fields, joined by namespace and name:
+//   - with "metrics", the usage of enrichUsage from the NodeMetrics or
+//     PodMetrics of the object, and for nodes cpuUsagePercent and
+//     memoryUsagePercent of the allocatable capacity, as `kubectl top nodes`
+//   - with "customMetrics", "metrics.<name>" for every custom metric
+//
+// Objects without a reading are returned as they are; the cached objects
+// are never modified. A failed read leaves its fields out and is returned
+// as the error, along with the joined items.
+func (c *ClientGoCollector) joinMetrics(spec *CacheSpec, namespace string, items []*CachedObject) ([]*CachedObject, error) {
+	gvr, err := ParseGVR(spec.GVR)
+	if err != nil {
+		return items, err
+	}
+	joined := make(map[string]map[string]interface{})
+	fieldsOf := func(namespace, name string) map[string]interface{} {
+		key := namespace + "/" + name
+		if joined[key] == nil {
+			joined[key] = make(map[string]interface{})
+		}
+		return joined[key]
+	}
+	var errs []error
+
+	if spec.Metrics {
+		readings, err := c.runtime.resourceMetrics(metricsGroupVersion.WithResource(gvr.Resource), namespace)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, reading := range readings {
+			enrichUsage(reading.Object, fieldsOf(reading.GetNamespace(), reading.GetName()))
+		}
+	}
+
+	if len(spec.CustomMetrics) > 0 {
+		namespaces := make(map[string]bool)
+		for _, item := range items {
+			namespaces[item.Namespace] = true
+		}
+		for ns := range namespaces {
+			for _, metric := range spec.CustomMetrics {
+				values, err := c.runtime.customMetric(gvr.Resource, ns, metric)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				for _, value := range values {
+					described, _ := nestedMap(value.Object, "describedObject")
+					fields := fieldsOf(stringOf(described, "namespace"), stringOf(described, "name"))
+					custom, _ := fields["metrics"].(map[string]interface{})
+					if custom == nil {
+						custom = make(map[string]interface{})
+						fields["metrics"] = custom
+					}
+					custom[metric] = stringOf(value.Object, "value")
+				}
+			}
+		}
+	}
+
+	result := make([]*CachedObject, len(items))
+	for i, item := range items {
+		fields, ok := joined[item.Namespace+"/"+item.Name]
+		if !ok {
+			result[i] = item
+			continue
+		}
+		if gvr.Resource == "nodes" {
+			usagePercent(item.Object, fields)
+		}
+		result[i] = withComputed(item, fields)
+	}
+	return result, errors.Join(errs...)
+}
+
+// enrichUsage computes the usage of a NodeMetrics or PodMetrics object, a
+// pod's being the sum of its containers', in the units `kubectl top`
+// shows, and as millicores and bytes.
+func enrichUsage(obj map[string]interface{}, out map[string]interface{}) {
+	var usages []map[string]interface{}
+	if usage, ok := nestedMap(obj, "usage"); ok {
+		usages = append(usages, usage)
+	} else if containers, ok := nestedSlice(obj, "containers"); ok {
+		for _, container := range mapsOf(containers) {
+			if usage, ok := nestedMap(container, "usage"); ok {
+				usages = append(usages, usage)
+			}
+		}
+	}
+	if len(usages) == 0 {
+		return
+	}
+	var cpu, memory int64
+	for _, usage := range usages {
+		cpu += quantityOf(usage, "cpu").MilliValue()
+		memory += quantityOf(usage, "memory").Value()
+	}
+	out["cpuUsage"] = fmt.Sprintf("%dm", cpu)
+	out["memoryUsage"] = fmt.Sprintf("%dMi", memory/(1024*1024))
+	out["cpuUsageMillis"] = cpu
+	out["memoryUsageBytes"] = memory
+	out["usageWindow"] = stringOf(obj, "window")
+}
+
+// usagePercent adds the usage of fields as a percentage of the node's
+// allocatable capacity.
+func usagePercent(node map[string]interface{}, fields map[string]interface{}) {
+	allocatable, ok := nestedMap(node, "status", "allocatable")
+	if !ok {
+		return
+	}
+	if cpu, ok := fields["cpuUsageMillis"].(int64); ok {
+		if capacity := quantityOf(allocatable, "cpu").MilliValue(); capacity > 0 {
+			fields["cpuUsagePercent"] = cpu * 100 / capacity
+		}
+	}
+	if memory, ok := fields["memoryUsageBytes"].(int64); ok {
+		if capacity := quantityOf(allocatable, "memory").Value(); capacity > 0 {
+			fields["memoryUsagePercent"] = memory * 100 / capacity
+		}
+	}
+}
+
+func quantityOf(m map[string]interface{}, key string) *resource.Quantity {
+	quantity, err := resource.ParseQuantity(stringOf(m, key))
+	if err != nil {
+		return &resource.Quantity{}
+	}
+	return &quantity
+}
+
+// withComputed returns a copy of item whose "_k" fields also hold fields.
+func withComputed(item *CachedObject, fields map[string]interface{}) *CachedObject {
+	copied := *item
+	copied.Object = make(map[string]interface{}, len(item.Object)+1)
+	for key, value := range item.Object {
+		copied.Object[key] = value
+	}
+	computed := make(map[string]interface{})
+	if existing, ok := item.Object["_k"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			computed[key] = value
+		}
+	}
+	for key, value := range fields {
+		computed[key] = value
+	}
+	copied.Object["_k"] = computed
+	return &copied
+}
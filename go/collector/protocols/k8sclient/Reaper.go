@@ -2,110 +2,188 @@ package k8sclient
 
 import (
 	"context"
-	"fmt"
-	"strings"
+	"sort"
 	"time"
 
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"github.com/saichler/l8types/go/ifs"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
-const reaperInterval = 60 * time.Second
-const reaperSkipRecentSeconds = 30
+// ReaperInterval is the time between two reconciliation cycles of a
+// cluster's cache against the API server.
+var ReaperInterval = 60 * time.Second
 
-// startReaper begins the background reconciliation goroutine exactly once.
-func (s *sharedRuntimeState) startReaper() {
+// ReaperSkipRecent exempts entries observed within this window from
+// reaping, as they may postdate the LIST they are compared with.
+var ReaperSkipRecent = 30 * time.Second
+
+// ReaperPageSize is the page size of the reaper's paginated LISTs.
+var ReaperPageSize int64 = 500
+
+// ReaperStats describes the last reconciliation cycle of a cluster.
+type ReaperStats struct {
+	Cycle     int64         // Number of completed cycles
+	GVRs      int           // Informer scopes (GVR, namespace and selectors) reconciled
+	Pages     int           // LIST requests issued
+	Checked   int           // Cached entries compared with the API server
+	Skipped   int           // Entries skipped as recently observed
+	Reaped    int           // Stale entries removed from the cache
+	Refreshed int           // Entries replaced by a recreated object with a new UID
+	Errors    int           // Scopes whose LIST failed and were left untouched
+	Duration  time.Duration // Duration of the cycle
+}
+
+// startReaper begins the cluster's background reconciliation goroutine
+// exactly once.
+func (s *clusterRuntime) startReaper(logger ifs.ILogger) {
 	s.mu.Lock()
 	if s.reaperStarted {
 		s.mu.Unlock()
 		return
 	}
 	s.reaperStarted = true
+	stopCh := s.stopCh
 	s.mu.Unlock()
 
 	go func() {
 		for {
 			select {
-			case <-time.After(reaperInterval):
-				reapStaleEntries()
-			case <-s.stopCh:
+			case <-time.After(ReaperInterval):
+				s.stopIdleInformers(logger)
+				s.reapStaleEntries(logger)
+			case <-stopCh:
 				return
 			}
 		}
 	}()
 }
 
-func reapStaleEntries() {
-	if shared.dynamicClient == nil {
-		return
-	}
+// reaperStatsSnapshot returns the statistics of the last cycle.
+func (s *clusterRuntime) reaperStatsSnapshot() ReaperStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.reaperStats
+}
 
-	entries := shared.cache.List("", "", "")
-	now := time.Now().Unix()
-	checked := 0
-	reaped := 0
+// reapStaleEntries reconciles the cache with the API server using one
+// paginated LIST per running informer instead of a GET per object. Each
+// LIST is scoped to the informer's namespace and selectors, so that
+// namespace-scoped RBAC suffices, and only the cached entries the informer
+// covers are compared with it. Entries absent from the LIST are deleted
+// through handleResourceDeletion, so they cascade and reach the delete
+// handlers like any other deletion; entries whose object was recreated
+// under a new UID are replaced.
+func (s *clusterRuntime) reapStaleEntries(logger ifs.ILogger) ReaperStats {
+	start := time.Now()
+	stats := ReaperStats{}
+	if s.client() == nil {
+		return stats
+	}
 
-	for _, entry := range entries {
-		if entry.GVR == "" || entry.Name == "" {
-			continue
-		}
-		if now-entry.ObservedAt < reaperSkipRecentSeconds {
+	skipBefore := time.Now().Add(-ReaperSkipRecent).Unix()
+	checked := make(map[string]bool)
+	for _, w := range s.reaperScopes() {
+		live, pages, err := s.listLive(w)
+		stats.Pages += pages
+		if err != nil {
+			stats.Errors++
+			if logger != nil {
+				logger.Warning("k8sclient reaper ", s.key, ": list ", w.key, " failed: ", err.Error())
+			}
 			continue
 		}
-
-		gvr := parseGVR(entry.GVR)
-		if gvr.Resource == "" {
-			continue
+		stats.GVRs++
+		entries, _ := s.cache.Select(w.gvrText, w.namespace, w.labelSelector, w.fieldSelector)
+		for _, entry := range entries {
+			key := cacheKey(entry.GVR, entry.Namespace, entry.Name)
+			if entry.Name == "" || checked[key] {
+				continue
+			}
+			checked[key] = true
+			if entry.ObservedAt > skipBefore {
+				stats.Skipped++
+				continue
+			}
+			stats.Checked++
+			item, ok := live[key]
+			if !ok {
+				s.handleResourceDeletion(entry.GVR, entry.Namespace, entry.Name)
+				stats.Reaped++
+				continue
+			}
+			if entry.UID != "" && string(item.GetUID()) != entry.UID {
+				s.cache.Upsert(cacheObject(w.gvrText, item, "UPDATE"))
+				stats.Refreshed++
+			}
 		}
+	}
+	stats.Duration = time.Since(start)
 
-		var err error
-		if entry.Namespace == "" {
-			_, err = shared.dynamicClient.Resource(gvr).Get(
-				context.TODO(), entry.Name, metav1.GetOptions{})
-		} else {
-			_, err = shared.dynamicClient.Resource(gvr).Namespace(entry.Namespace).Get(
-				context.TODO(), entry.Name, metav1.GetOptions{})
-		}
-		checked++
+	s.mu.Lock()
+	stats.Cycle = s.reaperStats.Cycle + 1
+	s.reaperStats = stats
+	s.mu.Unlock()
 
-		if err != nil && k8serrors.IsNotFound(err) {
-			fmt.Printf("[REAPER] stale entry: gvr=%s ns=%s name=%s — removing\n",
-				entry.GVR, entry.Namespace, entry.Name)
-			shared.cache.Delete(entry.GVR, entry.Namespace, entry.Name)
-			if shared.onDelete != nil {
-				shared.onDelete(entry.GVR, entry.Namespace, entry.Name)
-			}
-			reaped++
-		}
+	if logger != nil && (stats.Reaped > 0 || stats.Refreshed > 0 || stats.Errors > 0) {
+		logger.Info("k8sclient reaper ", s.key, ": cycle=", stats.Cycle, " gvrs=", stats.GVRs,
+			" pages=", stats.Pages, " checked=", stats.Checked, " skipped=", stats.Skipped,
+			" reaped=", stats.Reaped, " refreshed=", stats.Refreshed, " errors=", stats.Errors,
+			" duration=", stats.Duration.String())
 	}
+	return stats
+}
 
-	if reaped > 0 {
-		fmt.Printf("[REAPER] cycle complete: checked=%d reaped=%d\n", checked, reaped)
+// reaperScopes returns the informers whose scope the reaper lists, sorted
+// by key. An informer is left out when an unfiltered informer of its GVR
+// covers its namespace: as for deletions, that one reports for both.
+func (s *clusterRuntime) reaperScopes() []*watchedInformer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scopes := make([]*watchedInformer, 0, len(s.informers))
+	for _, w := range s.informers {
+		filtered := w.labelSelector != "" || w.fieldSelector != ""
+		_, all := s.informers[watchKey(w.gvrText, "", "", "")]
+		_, namespace := s.informers[watchKey(w.gvrText, w.namespace, "", "")]
+		if (w.namespace != "" && all) || (filtered && namespace) {
+			continue
+		}
+		scopes = append(scopes, w)
 	}
+	sort.Slice(scopes, func(i, j int) bool { return scopes[i].key < scopes[j].key })
+	return scopes
 }
 
-// parseGVR converts the string format "group/version/resource" or
-// "version/resource" back to a schema.GroupVersionResource.
-func parseGVR(gvrText string) schema.GroupVersionResource {
-	parts := strings.Split(gvrText, "/")
-	switch len(parts) {
-	case 2:
-		return schema.GroupVersionResource{
-			Group: "", Version: parts[0], Resource: parts[1],
+// listLive lists the objects in the scope of the informer w, page by page,
+// keyed like the cache.
+func (s *clusterRuntime) listLive(w *watchedInformer) (map[string]*unstructured.Unstructured, int, error) {
+	gvr, err := ParseGVR(w.gvrText)
+	if err != nil {
+		return nil, 0, err
+	}
+	client := s.client()
+	if client == nil {
+		return nil, 0, errNotConnected
+	}
+	resource := client.Resource(s.servedGVR(gvr)).Namespace(w.namespace)
+	live := make(map[string]*unstructured.Unstructured)
+	pages := 0
+	options := metav1.ListOptions{Limit: ReaperPageSize, LabelSelector: w.labelSelector, FieldSelector: w.fieldSelector}
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+		list, err := resource.List(ctx, options)
+		cancel()
+		pages++
+		if err != nil {
+			return nil, pages, err
 		}
-	case 3:
-		return schema.GroupVersionResource{
-			Group: parts[0], Version: parts[1], Resource: parts[2],
+		for i := range list.Items {
+			item := &list.Items[i]
+			live[cacheKey(w.gvrText, item.GetNamespace(), item.GetName())] = item
 		}
-	default:
-		if len(parts) >= 3 {
-			return schema.GroupVersionResource{
-				Group:    strings.Join(parts[:len(parts)-2], "/"),
-				Version:  parts[len(parts)-2],
-				Resource: parts[len(parts)-1],
-			}
+		options.Continue = list.GetContinue()
+		if options.Continue == "" {
+			return live, pages, nil
 		}
-		return schema.GroupVersionResource{}
 	}
 }
@@ -0,0 +1,250 @@
+package k8sclient
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Relation declares a relationship from the objects of a cache spec to
+// objects of another GVR. Every cached object records the objects it
+// relates to in CachedObject.Related, which is recomputed whenever the
+// object changes; the related objects themselves are looked up when a job
+// reads them, so their changes show immediately. Fields read them as
+// "related.<name>.<path>", e.g. "related.node.status".
+type Relation struct {
+	Name string `json:"name"`
+	GVR  string `json:"gvr"`
+	// NameFrom is the field holding the related object's name, e.g.
+	// "spec.nodeName" for the node of a pod.
+	NameFrom string `json:"nameFrom"`
+	// SameName relates the object of GVR with the same namespace and
+	// name, e.g. the endpoints of a service.
+	SameName bool `json:"sameName"`
+	// ClusterScoped is set when the objects of GVR are not namespaced.
+	ClusterScoped bool `json:"clusterScoped"`
+	// Owner relates the controller of the object, followed up to the
+	// top-level workload, e.g. Pod → ReplicaSet → Deployment. The owners
+	// resolve through the objects other specs cache; GVR is not used.
+	Owner bool `json:"owner"`
+}
+
+// wellKnownRelations are the relations a spec can declare by name alone,
+// by resource.
+var wellKnownRelations = map[string]map[string]Relation{
+	"pods": {
+		"node":     {GVR: "v1/nodes", NameFrom: "spec.nodeName", ClusterScoped: true},
+		"workload": {Owner: true},
+	},
+	"services": {
+		"endpoints": {GVR: "v1/endpoints", SameName: true},
+	},
+	"persistentvolumeclaims": {
+		"pv": {GVR: "v1/persistentvolumes", NameFrom: "spec.volumeName", ClusterScoped: true},
+	},
+}
+
+// maxOwnerDepth bounds the controllers followed by an owner relation.
+const maxOwnerDepth = 5
+
+// applyRelationDefaults completes the relations declared by name alone
+// from wellKnownRelations, and validates them.
+func (s *CacheSpec) applyRelationDefaults() error {
+	for i, relation := range s.Relations {
+		relation.Name = strings.TrimSpace(relation.Name)
+		if relation.Name == "" || strings.Contains(relation.Name, ".") {
+			return errors.New("cache spec relation needs a name without dots")
+		}
+		if relation.GVR == "" && !relation.Owner {
+			known, ok := wellKnownRelations[resourceFromGVR(s.GVR)][relation.Name]
+			if !ok {
+				return errors.New("cache spec relation " + relation.Name + " is not known for " + s.GVR)
+			}
+			known.Name = relation.Name
+			relation = known
+		}
+		if !relation.Owner && (relation.NameFrom == "") == !relation.SameName {
+			return errors.New("cache spec relation " + relation.Name + " needs one of nameFrom, sameName or owner")
+		}
+		s.Relations[i] = relation
+	}
+	return nil
+}
+
+var relations = struct {
+	mu    sync.RWMutex
+	byGVR map[string]map[string]Relation
+}{byGVR: make(map[string]map[string]Relation)}
+
+// registerSpecRelations records the relations of spec for its GVR. It
+// returns true when they are new or changed, meaning the Related of cached
+// objects of the GVR must be recomputed.
+func registerSpecRelations(spec *CacheSpec) bool {
+	if len(spec.Relations) == 0 {
+		return false
+	}
+	relations.mu.RLock()
+	registered := relations.byGVR[spec.GVR]
+	changed := false
+	for _, relation := range spec.Relations {
+		if existing, ok := registered[relation.Name]; !ok || existing != relation {
+			changed = true
+			break
+		}
+	}
+	relations.mu.RUnlock()
+	if !changed {
+		return false
+	}
+
+	relations.mu.Lock()
+	defer relations.mu.Unlock()
+	if relations.byGVR[spec.GVR] == nil {
+		relations.byGVR[spec.GVR] = make(map[string]Relation)
+	}
+	for _, relation := range spec.Relations {
+		relations.byGVR[spec.GVR][relation.Name] = relation
+	}
+	return true
+}
+
+// relatedRefs computes the Related entries of obj: a reference, by
+// relation, to the object it relates to.
+func relatedRefs(obj *CachedObject) []map[string]interface{} {
+	relations.mu.RLock()
+	declared := relations.byGVR[obj.GVR]
+	refs := make([]map[string]interface{}, 0, len(declared))
+	for name, relation := range declared {
+		ref := map[string]interface{}{"relation": name, "gvr": relation.GVR, "namespace": obj.Namespace}
+		switch {
+		case relation.Owner:
+			owner, ok := controllerRef(obj)
+			if !ok {
+				continue
+			}
+			ref["gvr"], ref["name"], ref["owner"] = owner.GVR, owner.Name, true
+		case relation.SameName:
+			ref["name"] = obj.Name
+		default:
+			value, _ := FieldValue(obj, relation.NameFrom)
+			if stringify(value) == "" {
+				continue
+			}
+			ref["name"] = stringify(value)
+		}
+		if relation.ClusterScoped {
+			ref["namespace"] = ""
+		}
+		refs = append(refs, ref)
+	}
+	relations.mu.RUnlock()
+	return refs
+}
+
+// controllerRef returns the GVR and name of the controller of obj.
+func controllerRef(obj *CachedObject) (*CachedObject, bool) {
+	owners, _ := nestedSlice(obj.Object, "metadata", "ownerReferences")
+	for _, owner := range mapsOf(owners) {
+		if controller, _ := owner["controller"].(bool); !controller {
+			continue
+		}
+		kind, name := stringOf(owner, "kind"), stringOf(owner, "name")
+		if kind == "" || name == "" {
+			continue
+		}
+		return &CachedObject{GVR: stringOf(owner, "apiVersion") + "/" + ResourceForKind(kind), Name: name}, true
+	}
+	return nil, false
+}
+
+// resolveRelated looks up the objects item relates to, as currently
+// cached, by relation. Owner relations follow the cached controllers up to
+// the top-level workload.
+func (c *CollectorCache) resolveRelated(item *CachedObject) map[string]*CachedObject {
+	resolved := make(map[string]*CachedObject, len(item.Related))
+	for _, ref := range item.Related {
+		target, ok := c.Get(stringOf(ref, "gvr"), stringOf(ref, "namespace"), stringOf(ref, "name"))
+		if !ok {
+			continue
+		}
+		if owner, _ := ref["owner"].(bool); owner {
+			for depth := 0; depth < maxOwnerDepth; depth++ {
+				next, ok := controllerRef(target)
+				if !ok {
+					break
+				}
+				parent, ok := c.Get(next.GVR, target.Namespace, next.Name)
+				if !ok {
+					break
+				}
+				target = parent
+			}
+		}
+		resolved[stringOf(ref, "relation")] = target
+	}
+	return resolved
+}
+
+// readsRelated reports whether fields read related objects.
+func readsRelated(fields []string) bool {
+	for _, field := range fields {
+		if strings.HasPrefix(field, "related.") {
+			return true
+		}
+	}
+	return false
+}
+
+// withRelated returns copies of items carrying the objects their
+// relations resolve to, when fields read them.
+func withRelated(cache *CollectorCache, fields []string, items []*CachedObject) []*CachedObject {
+	if !readsRelated(fields) {
+		return items
+	}
+	result := make([]*CachedObject, len(items))
+	for i, item := range items {
+		copied := *item
+		copied.relatedObjects = cache.resolveRelated(item)
+		result[i] = &copied
+	}
+	return result
+}
+
+// relatedValue resolves "<relation>.<path>" against a related object. The
+// computed "_k" fields take precedence, as they hold what kubectl shows:
+// "node.status" is the node's Ready status, "node.status.capacity.cpu" a
+// field of its status.
+func relatedValue(obj *CachedObject, field string) (interface{}, bool) {
+	name, path, _ := strings.Cut(field, ".")
+	target, ok := obj.relatedObjects[name]
+	if !ok {
+		return nil, false
+	}
+	if path == "" {
+		return target.Object, true
+	}
+	if value, ok := nestedValue(target.Object["_k"], strings.Split(path, ".")); ok {
+		if _, isMap := value.(map[string]interface{}); !isMap {
+			return value, true
+		}
+	}
+	return FieldValue(target, path)
+}
+
+// ensureRelations watches the GVRs the relations of spec refer to, so that
+// the related objects are cached.
+func (c *ClientGoCollector) ensureRelations(spec *CacheSpec, namespace string) error {
+	for _, relation := range spec.Relations {
+		if relation.Owner || relation.GVR == "" {
+			continue
+		}
+		relatedNamespace := namespace
+		if relation.ClusterScoped {
+			relatedNamespace = ""
+		}
+		if err := c.ensureWatching(relation.GVR, relatedNamespace, "", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
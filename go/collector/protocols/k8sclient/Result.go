@@ -94,6 +94,9 @@ func FieldValue(obj *CachedObject, field string) (interface{}, bool) {
 	case "related":
 		return obj.Related, true
 	default:
+		if rest, ok := strings.CutPrefix(field, "related."); ok {
+			return relatedValue(obj, rest)
+		}
 		return nestedValue(obj.Object, strings.Split(field, "."))
 	}
 }
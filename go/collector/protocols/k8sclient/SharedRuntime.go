@@ -1,71 +1,159 @@
 package k8sclient
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"sync"
 
 	"github.com/saichler/l8types/go/ifs"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
-// sharedRuntimeState holds process-wide singleton state shared by all
-// ClientGoCollector instances (one per host-protocol pair).
-// Access is guarded by its internal mutex.
-type sharedRuntimeState struct {
+// clusterRuntime holds the connection, cache, informers and reaper of one
+// Kubernetes cluster. It is shared, with reference counting, by all
+// ClientGoCollector instances whose credentials resolve to the same cluster
+// identity (see clusterKey). Access is guarded by its internal mutex.
+type clusterRuntime struct {
 	mu            sync.Mutex
+	key           string
+	refs          int
 	cache         *CollectorCache
 	restConfig    *rest.Config
 	dynamicClient dynamic.Interface
-	warmed        map[string]bool
+	kubeClient    kubernetes.Interface
+	discovery     discovery.DiscoveryInterface
+	served        map[string]schema.GroupVersionResource
+	informers     map[string]*watchedInformer
 	warmOnce      map[string]*sync.Once
 	stopCh        chan struct{}
 	connected     bool
-	serverStarted bool
 	reaperStarted bool
-	subscribers   map[chan struct{}]struct{}
-	onDelete      func(gvrText, namespace, name string)
+	reaperStats   ReaperStats
+	metrics       metricsCache
+	restored      map[string]bool
+	// snapshotLoaded and snapshotsStarted track the cache snapshot (see
+	// SnapshotDir).
+	snapshotLoaded   bool
+	snapshotsStarted bool
+	collectors       map[*ClientGoCollector]struct{}
 }
 
-var shared = &sharedRuntimeState{}
+var errNotConnected = errors.New("kubernetes cluster not connected")
 
-func (s *sharedRuntimeState) init() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.cache == nil {
-		s.cache = NewCollectorCache()
+// runtimeRegistry holds the process-wide state: the cluster runtimes by
+// identity, and the admission server, which is a single HTTPS endpoint.
+type runtimeRegistry struct {
+	mu            sync.Mutex
+	runtimes      map[string]*clusterRuntime
+	serverStarted bool
+	admission     *admissionServer
+	subscribers   map[chan struct{}]func(gvrText, namespace string) bool
+}
+
+var shared = &runtimeRegistry{
+	runtimes:    make(map[string]*clusterRuntime),
+	subscribers: make(map[chan struct{}]func(gvrText, namespace string) bool),
+}
+
+// clusterKey identifies a cluster by its API server and the credentials
+// used to reach it, so that two targets with different kubeconfigs never
+// share data while hosts configured with the same kubeconfig do.
+func clusterKey(cfg *rest.Config) string {
+	h := sha256.New()
+	for _, part := range []string{cfg.Username, cfg.Password, cfg.BearerToken, cfg.BearerTokenFile,
+		cfg.CertFile, string(cfg.CertData), cfg.KeyFile, string(cfg.KeyData), cfg.Impersonate.UserName} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
 	}
-	if s.warmed == nil {
-		s.warmed = make(map[string]bool)
+	return cfg.Host + "#" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// acquire returns the runtime of the cluster identified by key, creating
+// it if needed, and attaches collector to it.
+func (r *runtimeRegistry) acquire(key string, collector *ClientGoCollector) *clusterRuntime {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt, ok := r.runtimes[key]
+	if !ok {
+		rt = newClusterRuntime(key)
+		r.runtimes[key] = rt
 	}
-	if s.warmOnce == nil {
-		s.warmOnce = make(map[string]*sync.Once)
+	rt.mu.Lock()
+	if _, attached := rt.collectors[collector]; !attached {
+		rt.collectors[collector] = struct{}{}
+		rt.refs++
 	}
-	if s.stopCh == nil {
-		s.stopCh = make(chan struct{})
+	rt.mu.Unlock()
+	return rt
+}
+
+// release detaches collector from rt. The last collector to leave stops
+// the cluster's informers and reaper and drops its cache, and stops the
+// admission server when it was started for that cluster.
+func (r *runtimeRegistry) release(rt *clusterRuntime, collector *ClientGoCollector, logger ifs.ILogger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rt.mu.Lock()
+	if _, attached := rt.collectors[collector]; attached {
+		delete(rt.collectors, collector)
+		rt.refs--
 	}
-	if s.subscribers == nil {
-		s.subscribers = make(map[chan struct{}]struct{})
+	last := rt.refs <= 0
+	rt.mu.Unlock()
+	if !last {
+		return
+	}
+	if r.runtimes[rt.key] == rt {
+		delete(r.runtimes, rt.key)
+	}
+	if r.admission != nil && r.admission.runtime == rt {
+		r.admission.stop(logger)
+		r.admission = nil
+		r.serverStarted = false
+	}
+	rt.disconnect(logger)
+}
+
+func newClusterRuntime(key string) *clusterRuntime {
+	return &clusterRuntime{
+		key:        key,
+		cache:      NewCollectorCache(),
+		served:     make(map[string]schema.GroupVersionResource),
+		informers:  make(map[string]*watchedInformer),
+		restored:   make(map[string]bool),
+		warmOnce:   make(map[string]*sync.Once),
+		stopCh:     make(chan struct{}),
+		collectors: make(map[*ClientGoCollector]struct{}),
 	}
 }
 
 // connect establishes the dynamic client once. Subsequent calls reuse the
-// existing connection. Returns the rest config and dynamic client.
-func (s *sharedRuntimeState) connect(configFn func() (*rest.Config, error)) (*rest.Config, dynamic.Interface, error) {
+// existing connection. Returns the dynamic client.
+func (s *clusterRuntime) connect(cfg *rest.Config) (dynamic.Interface, error) {
 	s.mu.Lock()
 	if s.connected && s.dynamicClient != nil {
-		cfg, client := s.restConfig, s.dynamicClient
+		client := s.dynamicClient
 		s.mu.Unlock()
-		return cfg, client, nil
+		return client, nil
 	}
 	s.mu.Unlock()
 
-	cfg, err := configFn()
+	client, err := dynamic.NewForConfig(cfg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	client, err := dynamic.NewForConfig(cfg)
+	disc, err := discovery.NewDiscoveryClientForConfig(cfg)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
 	}
 
 	s.mu.Lock()
@@ -73,42 +161,71 @@ func (s *sharedRuntimeState) connect(configFn func() (*rest.Config, error)) (*re
 	// Double-check: another goroutine may have connected while we were
 	// building the client.
 	if s.connected && s.dynamicClient != nil {
-		return s.restConfig, s.dynamicClient, nil
+		return s.dynamicClient, nil
 	}
 	s.restConfig = cfg
 	s.dynamicClient = client
+	s.kubeClient = kubeClient
+	s.discovery = disc
 	s.connected = true
-	return cfg, client, nil
+	return client, nil
 }
 
-// ensureAdmissionServer starts the admission HTTPS server exactly once.
-// Returns true if it was already started (no action needed).
-func (s *sharedRuntimeState) ensureAdmissionServer(startFn func() error) error {
+// isConnected reports whether the runtime has a dynamic client.
+func (s *clusterRuntime) isConnected() bool {
 	s.mu.Lock()
-	if s.serverStarted {
-		s.mu.Unlock()
+	defer s.mu.Unlock()
+	return s.connected && s.dynamicClient != nil
+}
+
+// client returns the dynamic client, nil before connect.
+func (s *clusterRuntime) client() dynamic.Interface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dynamicClient
+}
+
+// kube returns the typed client, used for the subresources the dynamic
+// client cannot read such as pod logs; nil before connect.
+func (s *clusterRuntime) kube() kubernetes.Interface {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.kubeClient
+}
+
+// ensureAdmissionServer starts the admission HTTPS server exactly once
+// per process.
+func (r *runtimeRegistry) ensureAdmissionServer(startFn func() error) error {
+	r.mu.Lock()
+	if r.serverStarted {
+		r.mu.Unlock()
 		return nil
 	}
-	s.mu.Unlock()
+	r.mu.Unlock()
 
 	err := startFn()
 	if err != nil {
 		return err
 	}
 
-	s.mu.Lock()
-	s.serverStarted = true
-	s.mu.Unlock()
+	r.mu.Lock()
+	r.serverStarted = true
+	r.mu.Unlock()
 	return nil
 }
 
+// setAdmissionServer records the running admission server so that it is
+// stopped with its cluster.
+func (r *runtimeRegistry) setAdmissionServer(admission *admissionServer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.admission = admission
+}
+
 // onceForKey returns a sync.Once for the given warm key, creating it if needed.
-func (s *sharedRuntimeState) onceForKey(key string) *sync.Once {
+func (s *clusterRuntime) onceForKey(key string) *sync.Once {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.warmOnce == nil {
-		s.warmOnce = make(map[string]*sync.Once)
-	}
 	once, ok := s.warmOnce[key]
 	if !ok {
 		once = &sync.Once{}
@@ -117,47 +234,78 @@ func (s *sharedRuntimeState) onceForKey(key string) *sync.Once {
 	return once
 }
 
-// markWarmed records that the informer for key is running.
-func (s *sharedRuntimeState) markWarmed(key string) {
+// markWarmed records that the informer w is running.
+func (s *clusterRuntime) markWarmed(w *watchedInformer) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.warmed[key] = true
+	s.informers[w.key] = w
 }
 
 // isWarmed checks whether an informer is already running for key.
-func (s *sharedRuntimeState) isWarmed(key string) bool {
+func (s *clusterRuntime) isWarmed(key string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return s.warmed[key]
+	return s.informers[key] != nil
 }
 
-func (s *sharedRuntimeState) subscribe() chan struct{} {
+// notifyDelete hands a deletion to the delete handler of every collector
+// attached to the cluster.
+func (s *clusterRuntime) notifyDelete(gvrText, namespace, name string) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	ch := make(chan struct{}, 1)
-	if s.subscribers == nil {
-		s.subscribers = make(map[chan struct{}]struct{})
+	handlers := make([]func(gvrText, namespace, name string), 0, len(s.collectors))
+	for collector := range s.collectors {
+		if handler := collector.deleteHandler(); handler != nil {
+			handlers = append(handlers, handler)
+		}
+	}
+	s.mu.Unlock()
+	for _, handler := range handlers {
+		handler(gvrText, namespace, name)
 	}
-	s.subscribers[ch] = struct{}{}
+}
+
+func (r *runtimeRegistry) subscribe(covers func(gvrText, namespace string) bool) chan struct{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	r.subscribers[ch] = covers
 	return ch
 }
 
-func (s *sharedRuntimeState) unsubscribe(ch chan struct{}) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if s.subscribers == nil {
-		return
-	}
-	if _, ok := s.subscribers[ch]; ok {
-		delete(s.subscribers, ch)
+func (r *runtimeRegistry) unsubscribe(ch chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.subscribers[ch]; ok {
+		delete(r.subscribers, ch)
 		close(ch)
 	}
 }
 
-func (s *sharedRuntimeState) notifySubscribers() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for ch := range s.subscribers {
+// notifySubscribers signals the subscribers covering a change of an object
+// of gvrText in namespace. The covers functions run without the registry
+// lock, as they may take locks of their own; the signals are sent under it,
+// to subscribers that did not unsubscribe meanwhile.
+func (r *runtimeRegistry) notifySubscribers(gvrText, namespace string) {
+	r.mu.Lock()
+	subscribers := make(map[chan struct{}]func(gvrText, namespace string) bool, len(r.subscribers))
+	for ch, covers := range r.subscribers {
+		subscribers[ch] = covers
+	}
+	r.mu.Unlock()
+
+	notify := make([]chan struct{}, 0, len(subscribers))
+	for ch, covers := range subscribers {
+		if covers == nil || covers(gvrText, namespace) {
+			notify = append(notify, ch)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, ch := range notify {
+		if _, ok := r.subscribers[ch]; !ok {
+			continue
+		}
 		select {
 		case ch <- struct{}{}:
 		default:
@@ -168,7 +316,14 @@ func (s *sharedRuntimeState) notifySubscribers() {
 // SubscribeAdmissionEvents returns a channel that receives a signal
 // whenever an admission webhook event updates the cache.
 func SubscribeAdmissionEvents() chan struct{} {
-	return shared.subscribe()
+	return shared.subscribe(nil)
+}
+
+// SubscribeAdmissionEventsFor returns a channel that receives a signal
+// whenever an admission webhook event updates the cache with an object
+// covered by the subscriber, as reported by covers.
+func SubscribeAdmissionEventsFor(covers func(gvrText, namespace string) bool) chan struct{} {
+	return shared.subscribe(covers)
 }
 
 // UnsubscribeAdmissionEvents removes the subscription and closes the channel.
@@ -176,43 +331,33 @@ func UnsubscribeAdmissionEvents(ch chan struct{}) {
 	shared.unsubscribe(ch)
 }
 
-// RegisterDeleteCallback sets a function that will be called whenever a K8s
-// resource is deleted (via informer or admission webhook). The CollectorService
-// registers this at activation time to forward deletes to the parser.
-func RegisterDeleteCallback(fn func(gvrText, namespace, name string)) {
-	shared.mu.Lock()
-	defer shared.mu.Unlock()
-	shared.onDelete = fn
-}
-
-// disconnect tears down the shared connection. All informers are stopped.
-func (s *sharedRuntimeState) disconnect(logger ifs.ILogger) {
+// disconnect tears down the cluster connection. All its informers and its
+// reaper are stopped, after a last snapshot of the cache.
+func (s *clusterRuntime) disconnect(logger ifs.ILogger) {
+	s.saveSnapshot(logger)
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.stopCh != nil {
-		select {
-		case <-s.stopCh:
-			// already closed
-		default:
-			close(s.stopCh)
-			if logger != nil {
-				logger.Info("shared runtime: stopped all informers")
-			}
+	select {
+	case <-s.stopCh:
+		// already closed
+	default:
+		close(s.stopCh)
+		if logger != nil {
+			logger.Info("cluster runtime ", s.key, ": stopped all informers")
 		}
 	}
-	for ch := range s.subscribers {
-		close(ch)
-	}
-	s.subscribers = nil
 	s.connected = false
 	s.dynamicClient = nil
+	s.kubeClient = nil
+	s.discovery = nil
+	s.served = make(map[string]schema.GroupVersionResource)
+	s.metrics.reset()
 	s.restConfig = nil
-	s.warmed = nil
-	s.warmOnce = nil
-	s.stopCh = nil
-	s.serverStarted = false
+	s.informers = make(map[string]*watchedInformer)
+	s.warmOnce = make(map[string]*sync.Once)
 	s.reaperStarted = false
+	s.snapshotsStarted = false
 	if logger != nil {
-		logger.Info("shared runtime: disconnected")
+		logger.Info("cluster runtime ", s.key, ": disconnected")
 	}
 }
@@ -0,0 +1,275 @@
+package k8sclient
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saichler/l8types/go/ifs"
+)
+
+// SnapshotDir is the directory where each cluster runtime persists its
+// cache, so that a restarted collector serves polls from the snapshot while
+// its informers sync. Empty, the default unless K8SCLIENT_SNAPSHOT_DIR is
+// set, disables snapshots.
+var SnapshotDir = os.Getenv("K8SCLIENT_SNAPSHOT_DIR")
+
+// SnapshotInterval is the time between two snapshots of a connected
+// cluster runtime. A snapshot is also taken when it disconnects.
+var SnapshotInterval = 5 * time.Minute
+
+const snapshotVersion = 2
+
+type cacheSnapshot struct {
+	Version int             `json:"version"`
+	SavedAt time.Time       `json:"savedAt"`
+	Watches []string        `json:"watches"`
+	Objects []*CachedObject `json:"objects"`
+}
+
+// SaveSnapshot writes the cached objects to path as gzipped JSON, along
+// with watches, the keys of the informers that filled the cache (see
+// watchKey). The file is replaced atomically, so a crash never leaves a
+// truncated snapshot.
+func (c *CollectorCache) SaveSnapshot(path string, watches []string) error {
+	snapshot := cacheSnapshot{Version: snapshotVersion, SavedAt: time.Now(), Watches: watches, Objects: c.List("", "", "")}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	zw := gzip.NewWriter(file)
+	err = json.NewEncoder(zw).Encode(&snapshot)
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// LoadSnapshot restores the objects of the snapshot at path, normalizing
+// them again so that computed fields such as "_k.age" are current (see
+// recacheObject). Objects already cached at a newer resourceVersion are
+// kept. It returns the watches saved with the snapshot.
+func (c *CollectorCache) LoadSnapshot(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	defer zr.Close()
+	decoder := json.NewDecoder(zr)
+	decoder.UseNumber()
+	snapshot := cacheSnapshot{}
+	if err = decoder.Decode(&snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", path, err)
+	}
+	if snapshot.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s: unsupported version %d", path, snapshot.Version)
+	}
+
+	for _, saved := range snapshot.Objects {
+		if saved == nil || saved.GVR == "" || saved.Object == nil {
+			continue
+		}
+		saved.Object, _ = fromJSONNumbers(saved.Object).(map[string]interface{})
+		related := saved.Related
+		saved.Related = nil
+		for _, ref := range related {
+			if value, ok := fromJSONNumbers(ref).(map[string]interface{}); ok {
+				saved.Related = append(saved.Related, value)
+			}
+		}
+		restored := recacheObject(saved)
+		restored.ObservedAt = saved.ObservedAt
+		c.UpsertIfNewer(restored)
+	}
+	return snapshot.Watches, nil
+}
+
+// fromJSONNumbers converts the numbers of a decoded JSON value to int64 or
+// float64, the types of unstructured objects.
+func fromJSONNumbers(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, item := range typed {
+			typed[key] = fromJSONNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = fromJSONNumbers(item)
+		}
+	case json.Number:
+		if number, err := typed.Int64(); err == nil {
+			return number
+		}
+		number, _ := typed.Float64()
+		return number
+	}
+	return value
+}
+
+// snapshotPath returns the snapshot file of the cluster, empty when
+// snapshots are disabled.
+func (s *clusterRuntime) snapshotPath() string {
+	if SnapshotDir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(s.key))
+	return filepath.Join(SnapshotDir, hex.EncodeToString(sum[:8])+".snapshot.gz")
+}
+
+// restoreSnapshot loads the cluster's snapshot the first time the runtime
+// connects. The informers the snapshot was saved with do not block the
+// first poll while they sync, as the snapshot covers what they watch.
+func (s *clusterRuntime) restoreSnapshot(logger ifs.ILogger) {
+	path := s.snapshotPath()
+	s.mu.Lock()
+	if path == "" || s.snapshotLoaded {
+		s.mu.Unlock()
+		return
+	}
+	s.snapshotLoaded = true
+	s.mu.Unlock()
+
+	watches, err := s.cache.LoadSnapshot(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) && logger != nil {
+			logger.Warning("cluster runtime ", s.key, ": failed to load snapshot: ", err.Error())
+		}
+		return
+	}
+	s.mu.Lock()
+	for _, key := range watches {
+		s.restored[key] = true
+	}
+	s.mu.Unlock()
+	if logger != nil {
+		logger.Info("cluster runtime ", s.key, ": restored ", s.cache.Len(), " objects from ", path)
+	}
+}
+
+// takeRestored reports whether the snapshot covers the informer of key,
+// which is then served from the snapshot while it syncs. It does so only
+// for the first informer of key: once an informer was stopped, its objects
+// are no longer cached.
+func (s *clusterRuntime) takeRestored(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	restored := s.restored[key]
+	delete(s.restored, key)
+	return restored
+}
+
+// clearRestored forgets the snapshot's informers of gvrText, once one of
+// them reconciled: any other informer of the GVR starts without the
+// snapshot, so that its sync failures are reported to the poll.
+func (s *clusterRuntime) clearRestored(gvrText string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.restored {
+		if strings.HasPrefix(key, gvrText+"::") {
+			delete(s.restored, key)
+		}
+	}
+}
+
+// saveSnapshot persists the cache when snapshots are enabled.
+func (s *clusterRuntime) saveSnapshot(logger ifs.ILogger) {
+	path := s.snapshotPath()
+	if path == "" {
+		return
+	}
+	s.mu.Lock()
+	watches := make([]string, 0, len(s.informers))
+	for key := range s.informers {
+		watches = append(watches, key)
+	}
+	s.mu.Unlock()
+	sort.Strings(watches)
+	if err := s.cache.SaveSnapshot(path, watches); err != nil && logger != nil {
+		logger.Warning("cluster runtime ", s.key, ": failed to save snapshot: ", err.Error())
+	}
+}
+
+// startSnapshots saves the cache every SnapshotInterval until the runtime
+// stops, exactly once.
+func (s *clusterRuntime) startSnapshots(logger ifs.ILogger) {
+	s.mu.Lock()
+	if s.snapshotsStarted || s.snapshotPath() == "" {
+		s.mu.Unlock()
+		return
+	}
+	s.snapshotsStarted = true
+	stopCh := s.stopCh
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(SnapshotInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.saveSnapshot(logger)
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+// reconcileRestored emits the deletions missed while the informer w was
+// not running, e.g. while the collector was down, once w synced. A cached
+// object covered by the informer, absent from its store and not newer than
+// the informer's LIST, was deleted.
+func (s *clusterRuntime) reconcileRestored(w *watchedInformer) int {
+	filtered := w.labelSelector != "" || w.fieldSelector != ""
+	listed := w.informer.LastSyncResourceVersion()
+	store := w.informer.GetStore()
+	candidates, _ := s.cache.Select(w.gvrText, w.namespace, w.labelSelector, w.fieldSelector)
+	deleted := 0
+	for _, obj := range candidates {
+		if _, ok, _ := store.GetByKey(storeKey(obj.Namespace, obj.Name)); ok {
+			continue
+		}
+		if order, comparable := compareResourceVersions(obj.ResourceVersion, listed); comparable && order > 0 {
+			continue
+		}
+		// As for the informer's deletions, an unfiltered informer of the
+		// namespace reports them instead of a filtered one.
+		if filtered && (s.isWarmed(watchKey(w.gvrText, "", "", "")) || s.isWarmed(watchKey(w.gvrText, obj.Namespace, "", ""))) {
+			continue
+		}
+		s.handleResourceDeletion(obj.GVR, obj.Namespace, obj.Name)
+		deleted++
+	}
+	return deleted
+}
+
+// storeKey is the key of an object in an informer store.
+func storeKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
@@ -3,7 +3,9 @@ package k8sclient
 import (
 	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 )
@@ -11,25 +13,82 @@ import (
 const (
 	ResultMap   = "map"
 	ResultTable = "table"
+	// ResultGraph is the topology of the cached objects (see BuildGraphCMap).
+	ResultGraph = "graph"
 	ModeGet     = "get"
 	ModeList    = "list"
+	// ModeLogs reads the container logs of the selected pods.
+	ModeLogs = "logs"
+	// ModeEventsStream streams the cluster's events to the stream handler.
+	ModeEventsStream = "events-stream"
+)
+
+// Default fields of the logs and events-stream modes. A log row's
+// timestamp and an event's resourceVersion are the positions to resume from.
+var (
+	logFields         = []string{"namespace", "pod", "container", "timestamp", "message"}
+	eventStreamFields = []string{"metadata.namespace", "metadata.name", "metadata.resourceVersion", "type", "reason",
+		"involvedObject.kind", "involvedObject.name", "message", "count", "lastTimestamp"}
 )
 
 // CacheSpec describes how a job should read from the collector cache.
 type CacheSpec struct {
-	Result           string   `json:"result"`
-	Mode             string   `json:"mode"`
-	GVR              string   `json:"gvr"`
-	Operations       []string `json:"operations"`
-	Namespace        string   `json:"namespace"`
-	NamespaceFromArg string   `json:"namespaceFromArg"`
-	Name             string   `json:"name"`
-	NameFromArg      string   `json:"nameFromArg"`
-	Selector         string   `json:"selector"`
-	SelectorFromArg  string   `json:"selectorFromArg"`
-	Fields           []string `json:"fields"`
-	Columns          []string `json:"columns"`
-	ColumnNames      []string `json:"columnNames"`
+	Result               string   `json:"result"`
+	Mode                 string   `json:"mode"`
+	GVR                  string   `json:"gvr"`
+	Operations           []string `json:"operations"`
+	Namespace            string   `json:"namespace"`
+	NamespaceFromArg     string   `json:"namespaceFromArg"`
+	Name                 string   `json:"name"`
+	NameFromArg          string   `json:"nameFromArg"`
+	Selector             string   `json:"selector"`
+	SelectorFromArg      string   `json:"selectorFromArg"`
+	FieldSelector        string   `json:"fieldSelector"`
+	FieldSelectorFromArg string   `json:"fieldSelectorFromArg"`
+	Fields               []string `json:"fields"`
+	Columns              []string `json:"columns"`
+	ColumnNames          []string `json:"columnNames"`
+	// Enrich declares computed "_k" fields as kubectl-style JSONPath
+	// expressions, e.g. {"restarts": "{.status.containerStatuses[*].restartCount}"}.
+	Enrich map[string]string `json:"enrich"`
+	// Container limits the logs mode to one container, all when empty.
+	Container        string `json:"container"`
+	ContainerFromArg string `json:"containerFromArg"`
+	// TailLines and SinceSeconds bound the first read of a container's
+	// logs; later reads resume after the last line read.
+	TailLines    int64 `json:"tailLines"`
+	SinceSeconds int64 `json:"sinceSeconds"`
+	// ResumeFromArg names the job argument holding the position to resume
+	// from: a log timestamp (RFC 3339) or an event resourceVersion.
+	ResumeFromArg string `json:"resumeFromArg"`
+	// Metrics joins the CPU and memory usage of metrics.k8s.io onto the
+	// rows of a pods or nodes spec, and CustomMetrics the named metrics of
+	// custom.metrics.k8s.io onto the rows of any spec (see joinMetrics).
+	Metrics       bool     `json:"metrics"`
+	CustomMetrics []string `json:"customMetrics"`
+	// Project lists the field paths the cache keeps of the spec's objects,
+	// besides their identity, labels, owners and computed "_k" fields, to
+	// cut memory use. It must include the fields the spec's field selector
+	// reads. Objects are kept whole when a spec of the GVR has no projection.
+	// The projection only applies to the collector cache: the informer
+	// stores keep whole objects, pruned of PrunePaths, so that widening a
+	// projection or adding enrichers and relations can recompute cached
+	// objects without listing them again. It thus does not bound the
+	// memory of the informers.
+	Project []string `json:"project"`
+	// Relations declare the objects of other GVRs the spec's objects
+	// relate to, readable as "related.<name>.<path>" fields. The
+	// well-known relations (pods: node, workload; services: endpoints;
+	// persistentvolumeclaims: pv) can be declared by name alone.
+	Relations []Relation `json:"relations"`
+	// Graph lists the GVRs whose objects a graph spec joins into a
+	// topology, TopologyGVRs by default. The spec's GVR defaults to the
+	// first of them.
+	Graph []string `json:"graph"`
+
+	// optional is set on the specs of a graph's GVRs, skipped when the
+	// cluster does not serve them.
+	optional bool
 }
 
 func ParseCacheSpec(raw string, poll *l8tpollaris.L8Poll) (*CacheSpec, error) {
@@ -43,18 +102,115 @@ func ParseCacheSpec(raw string, poll *l8tpollaris.L8Poll) (*CacheSpec, error) {
 		return nil, err
 	}
 	spec.applyDefaults(poll)
+	if spec.Result == ResultGraph {
+		if len(spec.Graph) == 0 {
+			spec.Graph = append([]string{}, TopologyGVRs...)
+		}
+		for _, gvrText := range spec.Graph {
+			if _, err = ParseGVR(gvrText); err != nil {
+				return nil, err
+			}
+		}
+		if spec.GVR == "" {
+			spec.GVR = spec.Graph[0]
+		}
+	}
 	if spec.GVR == "" {
 		return nil, errors.New("cache spec gvr is empty")
 	}
 	if spec.Mode == ModeGet && spec.Name == "" && spec.NameFromArg == "" {
 		return nil, errors.New("cache spec get requires name or nameFromArg")
 	}
+	if err = spec.applyRelationDefaults(); err != nil {
+		return nil, err
+	}
+	if spec.Metrics && spec.GVR != "v1/pods" && spec.GVR != "v1/nodes" {
+		return nil, errors.New("cache spec metrics requires gvr v1/pods or v1/nodes")
+	}
+	for _, path := range spec.Project {
+		if strings.TrimSpace(path) == "" || strings.Contains("."+path+".", "..") {
+			return nil, errors.New("cache spec has an invalid project path " + strconv.Quote(path))
+		}
+	}
+	if _, _, err = parseSelectors(spec.Selector, spec.FieldSelector); err != nil {
+		return nil, err
+	}
+	for field, expression := range spec.Enrich {
+		if _, err = JSONPathEnricher(field, expression); err != nil {
+			return nil, err
+		}
+	}
 	return spec, nil
 }
 
+// watchSelectors returns the selectors that can be pushed down to the
+// informer of the spec. Only literal selectors qualify: selectors taken from
+// job arguments change per job, so their GVR is watched unfiltered and the
+// selectors are applied to the cache instead.
+func (s *CacheSpec) watchSelectors() (string, string) {
+	labelSelector, fieldSelector := "", ""
+	if s.SelectorFromArg == "" {
+		labelSelector = strings.TrimSpace(s.Selector)
+	}
+	if s.FieldSelectorFromArg == "" {
+		fieldSelector = strings.TrimSpace(s.FieldSelector)
+	}
+	return labelSelector, fieldSelector
+}
+
+// watched reports whether the spec reads the cache, filled by an informer
+// of its GVR. Events streams watch on their own and the metrics APIs cannot
+// be watched.
+func (s *CacheSpec) watched() bool {
+	return s.Mode != ModeEventsStream && !isMetricsGVR(s.GVR)
+}
+
+// watchedSpecs returns the specs whose informers fill the cache the spec
+// reads: the spec itself, or for a graph a list spec of every graph GVR.
+func (s *CacheSpec) watchedSpecs() []*CacheSpec {
+	if s.Result != ResultGraph {
+		return []*CacheSpec{s}
+	}
+	specs := make([]*CacheSpec, 0, len(s.Graph))
+	for _, gvrText := range s.Graph {
+		specs = append(specs, &CacheSpec{
+			Result:           ResultTable,
+			Mode:             ModeList,
+			GVR:              gvrText,
+			Operations:       s.Operations,
+			Namespace:        s.Namespace,
+			NamespaceFromArg: s.NamespaceFromArg,
+			optional:         true,
+		})
+	}
+	return specs
+}
+
 func (s *CacheSpec) applyDefaults(poll *l8tpollaris.L8Poll) {
 	s.Result = strings.ToLower(strings.TrimSpace(s.Result))
 	s.Mode = strings.ToLower(strings.TrimSpace(s.Mode))
+	switch s.Mode {
+	case ModeLogs:
+		if s.GVR == "" {
+			s.GVR = "v1/pods"
+		}
+		if s.Result == "" {
+			s.Result = ResultTable
+		}
+		if len(s.Fields) == 0 && len(s.Columns) == 0 {
+			s.Fields = append([]string{}, logFields...)
+		}
+	case ModeEventsStream:
+		if s.GVR == "" {
+			s.GVR = "v1/events"
+		}
+		if s.Result == "" {
+			s.Result = ResultMap
+		}
+		if len(s.Fields) == 0 && len(s.Columns) == 0 {
+			s.Fields = append([]string{}, eventStreamFields...)
+		}
+	}
 	if s.Mode == "" {
 		if s.Name != "" || s.NameFromArg != "" {
 			s.Mode = ModeGet
@@ -103,6 +259,44 @@ func (s *CacheSpec) applyDefaults(poll *l8tpollaris.L8Poll) {
 	}
 }
 
+// parsedSpecs caches the specs parsed by PollCovers by poll.What, as it
+// is evaluated for every poll of every host on each admission event.
+var parsedSpecs sync.Map
+
+// PollCovers reports whether the Kubernetes API poll, run with arguments,
+// reads objects of gvrText in namespace, so that a change to such an
+// object may change its result. Any served version of the poll's group and
+// resource covers; an empty namespace, cluster-scoped objects or polls of
+// all namespaces, covers every namespace.
+func PollCovers(poll *l8tpollaris.L8Poll, arguments map[string]string, gvrText, namespace string) bool {
+	if poll == nil || poll.Protocol != l8tpollaris.L8PProtocol_L8PKubernetesAPI {
+		return false
+	}
+	var spec *CacheSpec
+	if cached, ok := parsedSpecs.Load(poll.What); ok {
+		spec = cached.(*CacheSpec)
+	} else {
+		parsed, err := ParseCacheSpec(poll.What, poll)
+		if err != nil {
+			return false
+		}
+		parsedSpecs.Store(poll.What, parsed)
+		spec = parsed
+	}
+	covered := false
+	for _, watched := range spec.watchedSpecs() {
+		if watched.GVR == gvrText || groupResource(watched.GVR) == groupResource(gvrText) {
+			covered = true
+			break
+		}
+	}
+	if !covered {
+		return false
+	}
+	polled := resolveSpecValue(spec.Namespace, spec.NamespaceFromArg, arguments)
+	return polled == "" || namespace == "" || polled == namespace
+}
+
 func resolveSpecValue(literal, argName string, args map[string]string) string {
 	if argName != "" && args != nil {
 		if value, ok := args[argName]; ok {
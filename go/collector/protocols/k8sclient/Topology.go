@@ -0,0 +1,287 @@
+package k8sclient
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// TopologyGVRs are the GVRs a graph spec reads unless it lists its own.
+// GVRs the cluster does not serve, e.g. Istio's without Istio, are skipped.
+var TopologyGVRs = []string{
+	"v1/pods",
+	"v1/services",
+	"v1/endpoints",
+	"networking.k8s.io/v1/ingresses",
+	"apps/v1/deployments",
+	"apps/v1/replicasets",
+	"apps/v1/statefulsets",
+	"apps/v1/daemonsets",
+	"batch/v1/jobs",
+	"batch/v1/cronjobs",
+	"networking.istio.io/v1beta1/virtualservices",
+}
+
+// Edge types of a topology.
+const (
+	EdgeOwns      = "owns"      // owner → owned, from ownerReferences
+	EdgeSelects   = "selects"   // service → pod, from the service selector
+	EdgeEndpoints = "endpoints" // service → its endpoints
+	EdgeTargets   = "targets"   // endpoints → pod, from the address targetRefs
+	EdgeRoutes    = "routes"    // ingress or virtual service → service
+)
+
+var (
+	topologyNodeFields = []string{"id", "gvr", "kind", "namespace", "name", "status"}
+	topologyEdgeFields = []string{"from", "to", "type"}
+)
+
+// Topology is the graph of the cached objects of a namespace: a node per
+// object, identified by its cache key, and the edges between them.
+type Topology struct {
+	Nodes []*CachedObject
+	Edges []*CachedObject
+}
+
+// BuildTopology builds the topology of objects. Edges only join objects
+// of the list, so an ingress routing to a service that is not listed has
+// no edge.
+func BuildTopology(objects []*CachedObject) *Topology {
+	topology := &Topology{}
+	byUID := make(map[string]string)
+	byName := make(map[string]string)
+	var pods []*CachedObject
+	for _, obj := range objects {
+		id := cacheKey(obj.GVR, obj.Namespace, obj.Name)
+		kind := stringOf(obj.Object, "kind")
+		status, _ := FieldValue(obj, "_k.status")
+		topology.Nodes = append(topology.Nodes, &CachedObject{
+			GVR: obj.GVR, Namespace: obj.Namespace, Name: obj.Name,
+			Object: map[string]interface{}{"id": id, "kind": kind, "status": stringify(status)},
+		})
+		if obj.UID != "" {
+			byUID[obj.UID] = id
+		}
+		byName[topologyName(resourceFromGVR(obj.GVR), obj.Namespace, obj.Name)] = id
+		if resourceFromGVR(obj.GVR) == "pods" {
+			pods = append(pods, obj)
+		}
+	}
+
+	edges := make(map[string]bool)
+	addEdge := func(from, to, edgeType string) {
+		if from == "" || to == "" || from == to || edges[from+"|"+to+"|"+edgeType] {
+			return
+		}
+		edges[from+"|"+to+"|"+edgeType] = true
+		topology.Edges = append(topology.Edges, &CachedObject{
+			Object: map[string]interface{}{"from": from, "to": to, "type": edgeType},
+		})
+	}
+	service := func(namespace, name string) string {
+		return byName[topologyName("services", namespace, name)]
+	}
+
+	for _, obj := range objects {
+		id := cacheKey(obj.GVR, obj.Namespace, obj.Name)
+		owners, _ := nestedSlice(obj.Object, "metadata", "ownerReferences")
+		for _, owner := range mapsOf(owners) {
+			addEdge(byUID[stringOf(owner, "uid")], id, EdgeOwns)
+		}
+
+		switch resourceFromGVR(obj.GVR) {
+		case "services":
+			selector, _ := nestedMap(obj.Object, "spec", "selector")
+			if len(selector) > 0 {
+				matcher := labels.SelectorFromSet(stringMap(selector))
+				for _, pod := range pods {
+					podLabels, _ := nestedMap(pod.Object, "metadata", "labels")
+					if pod.Namespace == obj.Namespace && matcher.Matches(labels.Set(stringMap(podLabels))) {
+						addEdge(id, cacheKey(pod.GVR, pod.Namespace, pod.Name), EdgeSelects)
+					}
+				}
+			}
+		case "endpoints":
+			addEdge(service(obj.Namespace, obj.Name), id, EdgeEndpoints)
+			subsets, _ := nestedSlice(obj.Object, "subsets")
+			for _, subset := range mapsOf(subsets) {
+				for _, key := range []string{"addresses", "notReadyAddresses"} {
+					addresses, _ := nestedSlice(subset, key)
+					for _, address := range mapsOf(addresses) {
+						target, _ := nestedMap(address, "targetRef")
+						if stringOf(target, "kind") != "Pod" {
+							continue
+						}
+						pod := byUID[stringOf(target, "uid")]
+						if pod == "" {
+							pod = byName[topologyName("pods", stringOr(target, obj.Namespace, "namespace"), stringOf(target, "name"))]
+						}
+						addEdge(id, pod, EdgeTargets)
+					}
+				}
+			}
+		case "ingresses":
+			for _, name := range ingressBackends(obj.Object) {
+				addEdge(id, service(obj.Namespace, name), EdgeRoutes)
+			}
+		case "virtualservices":
+			for _, host := range virtualServiceDestinations(obj.Object) {
+				name, namespace := serviceHost(host, obj.Namespace)
+				addEdge(id, service(namespace, name), EdgeRoutes)
+			}
+		}
+	}
+
+	sort.Slice(topology.Nodes, func(i, j int) bool {
+		return stringOf(topology.Nodes[i].Object, "id") < stringOf(topology.Nodes[j].Object, "id")
+	})
+	sort.Slice(topology.Edges, func(i, j int) bool {
+		a, b := topology.Edges[i].Object, topology.Edges[j].Object
+		if stringOf(a, "from") != stringOf(b, "from") {
+			return stringOf(a, "from") < stringOf(b, "from")
+		}
+		if stringOf(a, "to") != stringOf(b, "to") {
+			return stringOf(a, "to") < stringOf(b, "to")
+		}
+		return stringOf(a, "type") < stringOf(b, "type")
+	})
+	return topology
+}
+
+// BuildGraphCMap returns the topology as a CMap holding two CTables:
+// "nodes", with the columns id, gvr, kind, namespace, name and status, and
+// "edges", with the columns from, to and type, from and to being node ids.
+func BuildGraphCMap(topology *Topology) (*l8tpollaris.CMap, error) {
+	cmap := &l8tpollaris.CMap{Data: make(map[string][]byte)}
+	for _, part := range []struct {
+		name   string
+		items  []*CachedObject
+		fields []string
+	}{
+		{"nodes", topology.Nodes, topologyNodeFields},
+		{"edges", topology.Edges, topologyEdgeFields},
+	} {
+		tbl, err := BuildCTable(part.items, part.fields, nil)
+		if err != nil {
+			return nil, err
+		}
+		enc := object.NewEncode()
+		if err = enc.Add(tbl); err != nil {
+			return nil, err
+		}
+		cmap.Data[part.name] = enc.Data()
+	}
+	return cmap, nil
+}
+
+// execGraph serves a graph spec: the topology of the objects of the graph
+// GVRs in namespace, all namespaces when empty.
+func (c *ClientGoCollector) execGraph(job *l8tpollaris.CJob, spec *CacheSpec, namespace string) {
+	var objects []*CachedObject
+	for _, watched := range spec.watchedSpecs() {
+		if !c.runtime.serves(watched.GVR) {
+			continue
+		}
+		if err := c.applySpec(watched); err != nil {
+			job.Error = err.Error()
+			job.ErrorCount++
+			return
+		}
+		if err := c.ensureWatching(watched.GVR, namespace, "", ""); err != nil {
+			job.Error = err.Error()
+			job.ErrorCount++
+			return
+		}
+		objects = append(objects, c.runtime.cache.List(watched.GVR, namespace, "")...)
+	}
+	cmap, err := BuildGraphCMap(BuildTopology(objects))
+	if err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(cmap); err != nil {
+		job.Error = err.Error()
+		job.ErrorCount++
+		return
+	}
+	job.Result = enc.Data()
+}
+
+// topologyName identifies an object by resource, namespace and name,
+// whatever the version of its GVR.
+func topologyName(resource, namespace, name string) string {
+	return resource + "::" + namespace + "::" + name
+}
+
+// ingressBackends returns the names of the services an Ingress routes to.
+func ingressBackends(obj map[string]interface{}) []string {
+	var names []string
+	backend := func(b map[string]interface{}) {
+		if name := stringOr(b, "", "service", "name"); name != "" {
+			names = append(names, name)
+		} else if name = stringOf(b, "serviceName"); name != "" {
+			names = append(names, name)
+		}
+	}
+	if b, ok := nestedMap(obj, "spec", "defaultBackend"); ok {
+		backend(b)
+	}
+	if b, ok := nestedMap(obj, "spec", "backend"); ok {
+		backend(b)
+	}
+	rules, _ := nestedSlice(obj, "spec", "rules")
+	for _, rule := range mapsOf(rules) {
+		paths, _ := nestedSlice(rule, "http", "paths")
+		for _, path := range mapsOf(paths) {
+			if b, ok := nestedMap(path, "backend"); ok {
+				backend(b)
+			}
+		}
+	}
+	return names
+}
+
+// virtualServiceDestinations returns the destination hosts of the http,
+// tcp and tls routes of an Istio VirtualService.
+func virtualServiceDestinations(obj map[string]interface{}) []string {
+	var hosts []string
+	for _, protocol := range []string{"http", "tcp", "tls"} {
+		routes, _ := nestedSlice(obj, "spec", protocol)
+		for _, route := range mapsOf(routes) {
+			destinations, _ := nestedSlice(route, "route")
+			for _, destination := range mapsOf(destinations) {
+				if host := stringOr(destination, "", "destination", "host"); host != "" {
+					hosts = append(hosts, host)
+				}
+			}
+		}
+	}
+	return hosts
+}
+
+// serviceHost resolves an Istio host, "reviews", "reviews.prod" or
+// "reviews.prod.svc.cluster.local", to the name and namespace of a
+// service. Short names are relative to namespace.
+func serviceHost(host, namespace string) (string, string) {
+	parts := strings.Split(strings.TrimSpace(host), ".")
+	if len(parts) > 1 {
+		return parts[0], parts[1]
+	}
+	return parts[0], namespace
+}
+
+// stringMap returns the string values of m.
+func stringMap(m map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(m))
+	for key, value := range m {
+		if s, ok := value.(string); ok {
+			result[key] = s
+		}
+	}
+	return result
+}
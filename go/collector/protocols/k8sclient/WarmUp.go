@@ -9,7 +9,7 @@ import (
 )
 
 func (c *ClientGoCollector) WarmUpFromBootModels() error {
-	if !shared.connected {
+	if !c.Online() {
 		if err := c.Connect(); err != nil {
 			return err
 		}
@@ -19,10 +19,17 @@ func (c *ClientGoCollector) WarmUpFromBootModels() error {
 		return err
 	}
 	for _, spec := range specs {
-		if spec == nil {
+		if spec == nil || (spec.optional && !c.runtime.serves(spec.GVR)) {
 			continue
 		}
-		if err = c.ensureWatching(spec.GVR, spec.Namespace); err != nil {
+		if err = c.applySpec(spec); err != nil {
+			return err
+		}
+		labelSelector, fieldSelector := spec.watchSelectors()
+		if err = c.ensureWatching(spec.GVR, spec.Namespace, labelSelector, fieldSelector); err != nil {
+			return err
+		}
+		if err = c.ensureRelations(spec, spec.Namespace); err != nil {
 			return err
 		}
 	}
@@ -43,13 +50,32 @@ func CacheSpecsFromPollarisModels(models []*l8tpollaris.L8Pollaris) ([]*CacheSpe
 			if poll == nil || poll.Protocol != l8tpollaris.L8PProtocol_L8PKubernetesAPI {
 				continue
 			}
-			spec, err := ParseCacheSpec(poll.What, poll)
+			parsed, err := ParseCacheSpec(poll.What, poll)
 			if err != nil {
 				return nil, fmt.Errorf("%s/%s: %w", model.Name, poll.Name, err)
 			}
-			key := spec.GVR + "::" + spec.Namespace
-			if _, ok := unique[key]; !ok {
-				unique[key] = spec
+			if !parsed.watched() {
+				continue
+			}
+			for _, spec := range parsed.watchedSpecs() {
+				labelSelector, fieldSelector := spec.watchSelectors()
+				key := watchKey(spec.GVR, spec.Namespace, labelSelector, fieldSelector)
+				existing, ok := unique[key]
+				if !ok {
+					unique[key] = spec
+					continue
+				}
+				// A GVR a poll reads itself must be watched even when a
+				// graph reads it too.
+				existing.optional = existing.optional && spec.optional
+				if len(existing.Project) > 0 {
+					// The informer serves both specs: project the union.
+					if len(spec.Project) == 0 {
+						existing.Project = nil
+					} else {
+						existing.Project = append(existing.Project, spec.Project...)
+					}
+				}
 			}
 		}
 	}
@@ -10,16 +10,22 @@ import (
 	admissionv1 "k8s.io/api/admission/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 
 	"github.com/saichler/l8parser/go/parser/boot"
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 )
 
+// WebhookRule selects the admission requests the collector observes.
+// Namespaces limits the rule to objects of these namespaces, all when empty,
+// and ObjectSelector to objects whose labels match the label selector.
 type WebhookRule struct {
-	APIGroups   []string
-	APIVersions []string
-	Resources   []string
-	Operations  []string
+	APIGroups      []string
+	APIVersions    []string
+	Resources      []string
+	Operations     []string
+	Namespaces     []string
+	ObjectSelector string
 }
 
 type AdmissionEvent struct {
@@ -41,8 +47,15 @@ func WebhookRulesFromBootModels() ([]WebhookRule, error) {
 	return WebhookRulesFromPollarisModels(boot.GetAllPolarisModels())
 }
 
+// WebhookRulesFromPollarisModels aggregates the Kubernetes polls of the
+// models into one rule per GVR. A rule is limited to the namespaces of its
+// polls unless one of them watches all namespaces or takes its namespace
+// from the job arguments, and to the label selector of its polls when they
+// all use the same literal selector.
 func WebhookRulesFromPollarisModels(models []*l8tpollaris.L8Pollaris) ([]WebhookRule, error) {
 	agg := make(map[string]*WebhookRule)
+	allNamespaces := make(map[string]bool)
+	mixedSelectors := make(map[string]bool)
 	for _, model := range models {
 		if model == nil {
 			continue
@@ -51,27 +64,46 @@ func WebhookRulesFromPollarisModels(models []*l8tpollaris.L8Pollaris) ([]Webhook
 			if poll == nil || poll.Protocol != l8tpollaris.L8PProtocol_L8PKubernetesAPI {
 				continue
 			}
-			spec, err := ParseCacheSpec(poll.What, poll)
+			parsed, err := ParseCacheSpec(poll.What, poll)
 			if err != nil {
 				return nil, fmt.Errorf("%s/%s: %w", model.Name, poll.Name, err)
 			}
-			gvr, err := ParseGVR(spec.GVR)
-			if err != nil {
-				return nil, fmt.Errorf("%s/%s: %w", model.Name, poll.Name, err)
+			if !parsed.watched() {
+				continue
 			}
-			key := gvr.Group + "|" + gvr.Version + "|" + gvr.Resource
-			rule, ok := agg[key]
-			if !ok {
-				rule = &WebhookRule{
-					APIGroups:   []string{gvr.Group},
-					APIVersions: []string{gvr.Version},
-					Resources:   []string{gvr.Resource},
-					Operations:  []string{},
+			for _, spec := range parsed.watchedSpecs() {
+				gvr, err := ParseGVR(spec.GVR)
+				if err != nil {
+					return nil, fmt.Errorf("%s/%s: %w", model.Name, poll.Name, err)
+				}
+				namespace := spec.Namespace
+				if spec.NamespaceFromArg != "" {
+					namespace = ""
+				}
+				objectSelector, _ := spec.watchSelectors()
+
+				key := gvr.Group + "|" + gvr.Version + "|" + gvr.Resource
+				rule, ok := agg[key]
+				if !ok {
+					rule = &WebhookRule{
+						APIGroups:      []string{gvr.Group},
+						APIVersions:    []string{gvr.Version},
+						Resources:      []string{gvr.Resource},
+						Operations:     []string{},
+						ObjectSelector: objectSelector,
+					}
+					agg[key] = rule
+				} else if rule.ObjectSelector != objectSelector {
+					mixedSelectors[key] = true
+				}
+				for _, op := range spec.Operations {
+					addUniqueString(&rule.Operations, op)
+				}
+				if namespace == "" {
+					allNamespaces[key] = true
+				} else {
+					addUniqueString(&rule.Namespaces, namespace)
 				}
-				agg[key] = rule
-			}
-			for _, op := range spec.Operations {
-				addUniqueString(&rule.Operations, op)
 			}
 		}
 	}
@@ -85,6 +117,13 @@ func WebhookRulesFromPollarisModels(models []*l8tpollaris.L8Pollaris) ([]Webhook
 	for _, key := range keys {
 		rule := agg[key]
 		sort.Strings(rule.Operations)
+		sort.Strings(rule.Namespaces)
+		if allNamespaces[key] {
+			rule.Namespaces = nil
+		}
+		if mixedSelectors[key] {
+			rule.ObjectSelector = ""
+		}
 		result = append(result, *rule)
 	}
 	return result, nil
@@ -109,8 +148,7 @@ func NewAdmissionHandler(rules []WebhookRule, callback AdmissionCallback) http.H
 		response := &admissionv1.AdmissionResponse{Allowed: true}
 		if review.Request != nil {
 			response.UID = review.Request.UID
-			if matchesWebhookRule(rules, review.Request) && callback != nil {
-				event := buildAdmissionEvent(review.Request)
+			if event := buildAdmissionEvent(review.Request); callback != nil && matchesWebhookRule(rules, event) {
 				if err = callback(event); err != nil {
 					response.Warnings = []string{err.Error()}
 					response.Result = &metav1.Status{
@@ -135,22 +173,27 @@ func NewAdmissionHandler(rules []WebhookRule, callback AdmissionCallback) http.H
 	})
 }
 
-func matchesWebhookRule(rules []WebhookRule, request *admissionv1.AdmissionRequest) bool {
-	if request == nil {
-		return false
-	}
-	op := string(request.Operation)
+// matchesWebhookRule reports whether a rule selects the event. Besides
+// the group, version, resource and operation, the event's namespace and
+// the labels of its object, the old object for a DELETE, must match.
+func matchesWebhookRule(rules []WebhookRule, event AdmissionEvent) bool {
 	for _, rule := range rules {
-		if !containsString(rule.APIGroups, request.Resource.Group) {
+		if !containsString(rule.APIGroups, event.Group) {
+			continue
+		}
+		if !containsString(rule.APIVersions, event.Version) {
 			continue
 		}
-		if !containsString(rule.APIVersions, request.Resource.Version) {
+		if !containsString(rule.Resources, event.Resource) {
 			continue
 		}
-		if !containsString(rule.Resources, request.Resource.Resource) {
+		if !containsString(rule.Operations, event.Operation) {
 			continue
 		}
-		if !containsString(rule.Operations, op) {
+		if len(rule.Namespaces) > 0 && event.Namespace != "" && !containsString(rule.Namespaces, event.Namespace) {
+			continue
+		}
+		if rule.ObjectSelector != "" && !matchesObjectSelector(rule.ObjectSelector, event) {
 			continue
 		}
 		return true
@@ -158,6 +201,21 @@ func matchesWebhookRule(rules []WebhookRule, request *admissionv1.AdmissionReque
 	return false
 }
 
+func matchesObjectSelector(objectSelector string, event AdmissionEvent) bool {
+	selector, err := labels.Parse(objectSelector)
+	if err != nil {
+		return true
+	}
+	obj := event.Object
+	if obj == nil {
+		obj = event.OldObject
+	}
+	if obj == nil {
+		return true
+	}
+	return selector.Matches(labels.Set(obj.GetLabels()))
+}
+
 func buildAdmissionEvent(request *admissionv1.AdmissionRequest) AdmissionEvent {
 	event := AdmissionEvent{
 		UID:         string(request.UID),
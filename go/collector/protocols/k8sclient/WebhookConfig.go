@@ -3,8 +3,11 @@ package k8sclient
 import (
 	"net/http"
 	"sort"
+	"strconv"
+	"strings"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 )
@@ -58,33 +61,93 @@ func ValidatingWebhookYAMLFromRules(options WebhookConfigOptions, rules []Webhoo
 		options.FailureMode = admissionregistrationv1.Ignore
 	}
 	config := admissionregistrationFromRules(options.Name, options.ServiceName, options.Namespace, options.Path, rules)
-	config.Webhooks[0].FailurePolicy = failurePolicyPtr(options.FailureMode)
+	for i := range config.Webhooks {
+		config.Webhooks[i].FailurePolicy = failurePolicyPtr(options.FailureMode)
+	}
 	return yaml.Marshal(config)
 }
 
+// admissionregistrationFromRules builds one webhook per distinct pair of
+// namespaces and object selector of the rules, so that the API server only
+// calls the collector for the objects its polls cover. The webhook of the
+// unrestricted rules keeps the service's name.
 func admissionregistrationFromRules(name, serviceName, namespace, path string, rules []WebhookRule) *admissionregistrationv1.ValidatingWebhookConfiguration {
-	webhookName := serviceName + "." + namespace + ".svc"
+	groups := make(map[string][]WebhookRule)
+	for _, rule := range rules {
+		key := strings.Join(rule.Namespaces, ",") + "|" + rule.ObjectSelector
+		groups[key] = append(groups[key], rule)
+	}
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "|") != (keys[j] == "|") {
+			return keys[i] == "|"
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) == 0 {
+		keys = append(keys, "|")
+	}
+
+	webhooks := make([]admissionregistrationv1.ValidatingWebhook, 0, len(keys))
+	for i, key := range keys {
+		webhookName := serviceName + "." + namespace + ".svc"
+		if i > 0 {
+			webhookName = serviceName + "-" + strconv.Itoa(i) + "." + namespace + ".svc"
+		}
+		webhook := admissionregistrationv1.ValidatingWebhook{
+			Name:                    webhookName,
+			AdmissionReviewVersions: []string{"v1"},
+			SideEffects:             sideEffectsPtr(admissionregistrationv1.SideEffectClassNone),
+			ClientConfig: admissionregistrationv1.WebhookClientConfig{
+				Service: &admissionregistrationv1.ServiceReference{
+					Namespace: namespace,
+					Name:      serviceName,
+					Path:      stringPtr(path),
+				},
+			},
+			Rules: rulesToOperations(groups[key]),
+		}
+		if group := groups[key]; len(group) > 0 {
+			webhook.NamespaceSelector = namespaceSelector(group[0].Namespaces)
+			webhook.ObjectSelector = objectSelector(group[0].ObjectSelector)
+		}
+		webhooks = append(webhooks, webhook)
+	}
 	return &admissionregistrationv1.ValidatingWebhookConfiguration{
 		TypeMeta:   typeMeta("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration"),
 		ObjectMeta: objectMeta(name),
-		Webhooks: []admissionregistrationv1.ValidatingWebhook{
-			{
-				Name:                    webhookName,
-				AdmissionReviewVersions: []string{"v1"},
-				SideEffects:             sideEffectsPtr(admissionregistrationv1.SideEffectClassNone),
-				ClientConfig: admissionregistrationv1.WebhookClientConfig{
-					Service: &admissionregistrationv1.ServiceReference{
-						Namespace: namespace,
-						Name:      serviceName,
-						Path:      stringPtr(path),
-					},
-				},
-				Rules: rulesToOperations(rules),
-			},
-		},
+		Webhooks:   webhooks,
 	}
 }
 
+// namespaceSelector selects namespaces by their immutable name label.
+func namespaceSelector(namespaces []string) *metav1.LabelSelector {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	return &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{
+		Key:      corev1.LabelMetadataName,
+		Operator: metav1.LabelSelectorOpIn,
+		Values:   append([]string{}, namespaces...),
+	}}}
+}
+
+// objectSelector converts a label selector string. A selector that cannot
+// be expressed is dropped, the handler still applies it.
+func objectSelector(selector string) *metav1.LabelSelector {
+	if selector == "" {
+		return nil
+	}
+	result, err := metav1.ParseToLabelSelector(selector)
+	if err != nil {
+		return nil
+	}
+	return result
+}
+
 func rulesToOperations(rules []WebhookRule) []admissionregistrationv1.RuleWithOperations {
 	result := make([]admissionregistrationv1.RuleWithOperations, 0, len(rules))
 	for _, rule := range rules {
@@ -0,0 +1,150 @@
+package k8sclient
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/saichler/l8types/go/ifs"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// CertCheckInterval is how often the admission server checks whether its
+// certificate must be rotated or was replaced on disk.
+var CertCheckInterval = time.Minute
+
+var validatingWebhookGVR = schema.GroupVersionResource{
+	Group:    "admissionregistration.k8s.io",
+	Version:  "v1",
+	Resource: "validatingwebhookconfigurations",
+}
+
+// webhookManager lets the collector manage its own webhook: it keeps a
+// self-signed CA and serving certificate in the certificate directory,
+// rotates them before they expire and keeps the
+// ValidatingWebhookConfiguration, with the CA as its caBundle, in sync.
+type webhookManager struct {
+	options    WebhookConfigOptions
+	rules      []WebhookRule
+	certDir    string
+	client     dynamic.Interface
+	store      *certStore
+	previousCA []byte
+}
+
+func newWebhookManager(options WebhookConfigOptions, rules []WebhookRule, certDir string, client dynamic.Interface, store *certStore) *webhookManager {
+	if options.Path == "" {
+		options.Path = DefaultAdmissionPath
+	}
+	if options.FailureMode == "" {
+		options.FailureMode = admissionregistrationv1.Ignore
+	}
+	return &webhookManager{options: options, rules: rules, certDir: certDir, client: client, store: store}
+}
+
+// start serves the certificate found in the certificate directory when it
+// is valid for the service and not due for renewal, generating a new one
+// otherwise, and applies the webhook configuration.
+func (m *webhookManager) start(logger ifs.ILogger, now time.Time) error {
+	bundle, err := loadCertBundle(m.certDir)
+	if err != nil || bundle.dueForRenewal(now) || !bundle.servesNames(webhookDNSNames(m.options.ServiceName, m.options.Namespace)) {
+		if bundle, err = m.generate(logger, now); err != nil {
+			return err
+		}
+	}
+	m.store.set(bundle)
+	return m.apply(bundle.caPEM)
+}
+
+// rotateIfDue replaces the certificate when it is about to expire. The
+// webhook configuration first trusts both the old and the new CA, so the
+// API server keeps accepting the old certificate until it is replaced.
+func (m *webhookManager) rotateIfDue(logger ifs.ILogger, now time.Time) (bool, error) {
+	current := m.store.current()
+	if !current.dueForRenewal(now) {
+		return false, nil
+	}
+	bundle, err := m.generate(logger, now)
+	if err != nil {
+		return false, err
+	}
+	if current != nil {
+		m.previousCA = current.caPEM
+	}
+	if err = m.apply(bundle.caPEM); err != nil {
+		return false, err
+	}
+	m.store.set(bundle)
+	if logger != nil {
+		logger.Info("admission webhook ", m.options.Name, ": rotated certificate, valid until ", bundle.notAfter.String())
+	}
+	return true, nil
+}
+
+func (m *webhookManager) generate(logger ifs.ILogger, now time.Time) (*certBundle, error) {
+	bundle, err := generateCertBundle(m.options.ServiceName, m.options.Namespace, now)
+	if err != nil {
+		return nil, err
+	}
+	if err = writeCertBundle(m.certDir, bundle); err != nil && logger != nil {
+		// The bundle is still served from memory; it is regenerated on
+		// the next start.
+		logger.Warning("admission webhook: failed to store certificates in ", m.certDir, ": ", err.Error())
+	}
+	return bundle, nil
+}
+
+// caBundle returns the PEM bundle the API server should trust.
+func (m *webhookManager) caBundle(caPEM []byte) []byte {
+	if len(m.previousCA) == 0 || bytes.Equal(m.previousCA, caPEM) {
+		return caPEM
+	}
+	return append(append([]byte{}, caPEM...), m.previousCA...)
+}
+
+// apply creates or updates the ValidatingWebhookConfiguration.
+func (m *webhookManager) apply(caPEM []byte) error {
+	config := admissionregistrationFromRules(m.options.Name, m.options.ServiceName, m.options.Namespace, m.options.Path, m.rules)
+	for i := range config.Webhooks {
+		config.Webhooks[i].FailurePolicy = failurePolicyPtr(m.options.FailureMode)
+		config.Webhooks[i].ClientConfig.CABundle = m.caBundle(caPEM)
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(config)
+	if err != nil {
+		return err
+	}
+	desired := &unstructured.Unstructured{Object: content}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resource := m.client.Resource(validatingWebhookGVR)
+	existing, err := resource.Get(ctx, m.options.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = resource.Create(ctx, desired, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	desired.SetResourceVersion(existing.GetResourceVersion())
+	_, err = resource.Update(ctx, desired, metav1.UpdateOptions{})
+	return err
+}
+
+// remove deletes the ValidatingWebhookConfiguration, so that the API server
+// stops calling a webhook that is no longer served.
+func (m *webhookManager) remove() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := m.client.Resource(validatingWebhookGVR).Delete(ctx, m.options.Name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+)
+
+// conditionalState remembers the cache validators and the last encoded
+// result of a GET job, so later polls can be sent as conditional requests.
+type conditionalState struct {
+	etag         string
+	lastModified string
+	result       []byte
+}
+
+// conditionalCache holds the conditional state of every GET job executed
+// by a collector, keyed by job and request URL.
+type conditionalCache struct {
+	mtx    sync.Mutex
+	states map[string]*conditionalState
+}
+
+func newConditionalCache() *conditionalCache {
+	return &conditionalCache{states: make(map[string]*conditionalState)}
+}
+
+func conditionalKey(job *l8tpollaris.CJob, url string) string {
+	return job.PollarisName + "::" + job.JobName + "::" + url
+}
+
+func (this *conditionalCache) get(key string) (*conditionalState, bool) {
+	if this == nil {
+		return nil, false
+	}
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	state, ok := this.states[key]
+	return state, ok
+}
+
+// store records the validators of a successful response together with the
+// result that was produced from it. Responses without validators are
+// forgotten, since the server cannot answer them with 304.
+func (this *conditionalCache) store(key string, header http.Header, result []byte) {
+	if this == nil {
+		return
+	}
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	etag := header.Get("ETag")
+	lastModified := header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		delete(this.states, key)
+		return
+	}
+	this.states[key] = &conditionalState{etag: etag, lastModified: lastModified, result: result}
+}
+
+// apply adds If-None-Match / If-Modified-Since headers to req if validators
+// are known for key.
+func (this *conditionalCache) apply(key string, req *http.Request) {
+	state, ok := this.get(key)
+	if !ok {
+		return
+	}
+	if state.etag != "" {
+		req.Header.Set("If-None-Match", state.etag)
+	}
+	if state.lastModified != "" {
+		req.Header.Set("If-Modified-Since", state.lastModified)
+	}
+}
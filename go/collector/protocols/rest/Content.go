@@ -0,0 +1,169 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+)
+
+// Response formats, also used as the CMap result key.
+const (
+	FormatJson = "json"
+	FormatXml  = "xml"
+	FormatCsv  = "csv"
+	FormatText = "text"
+)
+
+// xpathOption prefixes the options that extract XML fields. For example
+// "xpath.hostname=/system/hostname" adds a "hostname" entry to the result.
+const xpathOption = "xpath."
+
+// responseFormat determines the format of a response body. An explicit
+// "format" option wins; otherwise the Content-Type header is used and, when
+// it is missing, the body is sniffed. Unknown types, and text bodies (e.g.
+// text/plain or text/html) that are valid JSON, are treated as JSON, which
+// was the only format before content-type handling was added.
+func responseFormat(contentType string, body []byte, options map[string]string) string {
+	if format := strings.ToLower(options["format"]); format != "" {
+		return format
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" {
+		trimmed := bytes.TrimSpace(body)
+		if len(trimmed) > 0 && trimmed[0] == '<' {
+			return FormatXml
+		}
+		return FormatJson
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return FormatJson
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return FormatXml
+	case mediaType == "text/csv" || mediaType == "application/csv":
+		return FormatCsv
+	case strings.HasPrefix(mediaType, "text/"):
+		if json.Valid(body) {
+			return FormatJson
+		}
+		return FormatText
+	}
+	return FormatJson
+}
+
+// decodeResponse converts a response body into the job result:
+//   - JSON and text are kept as a string under the "json" or "text" key.
+//   - XML is kept under the "xml" key, and every "xpath.<name>=<expr>"
+//     option adds the extracted value under "<name>".
+//   - CSV becomes a CTable whose columns are taken from the header row.
+func decodeResponse(format string, body []byte, options map[string]string) (interface{}, error) {
+	switch format {
+	case FormatJson, FormatText:
+		return stringCMap(map[string]string{format: string(body)}), nil
+	case FormatXml:
+		values := map[string]string{FormatXml: string(body)}
+		fields := xpathFields(options)
+		if len(fields) == 0 {
+			return stringCMap(values), nil
+		}
+		doc, err := DecodeXML(body)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range fields {
+			value, ok, err := XPath(doc, options[xpathOption+name])
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				values[name] = value
+			}
+		}
+		return stringCMap(values), nil
+	case FormatCsv:
+		return DecodeCSV(body)
+	}
+	return nil, errors.New("unsupported response format: " + format)
+}
+
+func xpathFields(options map[string]string) []string {
+	fields := make([]string, 0)
+	for key := range options {
+		if strings.HasPrefix(key, xpathOption) && len(key) > len(xpathOption) {
+			fields = append(fields, key[len(xpathOption):])
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func stringCMap(values map[string]string) *l8tpollaris.CMap {
+	cmap := &l8tpollaris.CMap{Data: make(map[string][]byte)}
+	for key, value := range values {
+		enc := object.NewEncode()
+		enc.Add(value)
+		cmap.Data[key] = enc.Data()
+	}
+	return cmap
+}
+
+// DecodeCSV converts a CSV document into a CTable. The first record is the
+// header and names the columns; blank header cells are named "column<n>".
+func DecodeCSV(data []byte) (*l8tpollaris.CTable, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("csv document has no header")
+	}
+	header := records[0]
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			name = "column" + strconv.Itoa(i)
+		}
+		columns[i] = name
+	}
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(columns))
+		for i, value := range record {
+			if i < len(columns) {
+				row[columns[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return buildTable(columns, rows)
+}
@@ -0,0 +1,129 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimit configures the per-host token bucket that bounds the request
+// rate sent to a REST endpoint. A zero RequestsPerSecond disables limiting.
+type RateLimit struct {
+	RequestsPerSecond float64 // Sustained request rate allowed per host
+	Burst             int     // Maximum number of requests sent back-to-back
+}
+
+// DefaultRateLimit is used by every RestCollector unless overridden via
+// SetRateLimit. The default is unlimited.
+var DefaultRateLimit = RateLimit{}
+
+// rateLimiter is a token bucket shared by all collectors talking to the
+// same host, so that several targets behind one controller cannot exceed
+// its quota together. It also supports pausing the host entirely when the
+// server responds with Retry-After.
+type rateLimiter struct {
+	mtx      sync.Mutex
+	limit    RateLimit
+	tokens   float64
+	last     time.Time
+	pausedTo time.Time
+}
+
+var limiters = struct {
+	sync.Mutex
+	byHost map[string]*rateLimiter
+}{byHost: make(map[string]*rateLimiter)}
+
+// limiterFor returns the shared limiter for host, creating it on first use.
+// A non-zero limit replaces the limiter's current configuration.
+func limiterFor(host string, limit RateLimit) *rateLimiter {
+	limiters.Lock()
+	defer limiters.Unlock()
+	l, ok := limiters.byHost[host]
+	if !ok {
+		l = &rateLimiter{limit: limit, tokens: float64(limit.Burst), last: time.Now()}
+		limiters.byHost[host] = l
+	} else if limit.RequestsPerSecond > 0 {
+		l.setLimit(limit)
+	}
+	return l
+}
+
+func (this *rateLimiter) setLimit(limit RateLimit) {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	this.limit = limit
+	if this.tokens > float64(limit.Burst) {
+		this.tokens = float64(limit.Burst)
+	}
+}
+
+// reserve takes one token and returns how long the caller must wait before
+// sending. Tokens may go negative so that concurrent callers queue up in
+// arrival order instead of all waking at the same instant.
+func (this *rateLimiter) reserve() time.Duration {
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	now := time.Now()
+	var wait time.Duration
+	if now.Before(this.pausedTo) {
+		wait = this.pausedTo.Sub(now)
+	}
+	rps := this.limit.RequestsPerSecond
+	if rps <= 0 {
+		return wait
+	}
+	burst := float64(this.limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	this.tokens += now.Sub(this.last).Seconds() * rps
+	if this.tokens > burst {
+		this.tokens = burst
+	}
+	this.last = now
+	this.tokens--
+	if this.tokens < 0 {
+		deficit := time.Duration(-this.tokens / rps * float64(time.Second))
+		if deficit > wait {
+			wait = deficit
+		}
+	}
+	return wait
+}
+
+// wait blocks until the caller is allowed to send one request.
+func (this *rateLimiter) wait() {
+	if this == nil {
+		return
+	}
+	if d := this.reserve(); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// pause blocks all requests to the host until the given time.
+func (this *rateLimiter) pause(until time.Time) {
+	if this == nil {
+		return
+	}
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if until.After(this.pausedTo) {
+		this.pausedTo = until
+	}
+}
@@ -0,0 +1,387 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+)
+
+// RedfishPrefix marks a poll as a Redfish poll. The poll.What format is
+// "REDFISH::<resource>", where resource is one of Systems, Chassis, Managers,
+// Thermal or Power. The collector walks the @odata.id links from the service
+// root, expands the collections and returns one normalized CTable per poll.
+const RedfishPrefix = "REDFISH"
+
+// RedfishRoot is the Redfish service root path.
+const RedfishRoot = "/redfish/v1/"
+
+// redfishColumn maps a normalized column name to a "." separated path in
+// the Redfish resource.
+type redfishColumn struct {
+	name string
+	path string
+}
+
+var redfishSystemColumns = []redfishColumn{
+	{"Id", "Id"}, {"Name", "Name"}, {"Manufacturer", "Manufacturer"}, {"Model", "Model"},
+	{"SerialNumber", "SerialNumber"}, {"SKU", "SKU"}, {"PartNumber", "PartNumber"},
+	{"UUID", "UUID"}, {"HostName", "HostName"}, {"BiosVersion", "BiosVersion"},
+	{"PowerState", "PowerState"}, {"ProcessorCount", "ProcessorSummary.Count"},
+	{"ProcessorModel", "ProcessorSummary.Model"}, {"MemoryGiB", "MemorySummary.TotalSystemMemoryGiB"},
+	{"State", "Status.State"}, {"Health", "Status.Health"}, {"HealthRollup", "Status.HealthRollup"},
+}
+
+var redfishChassisColumns = []redfishColumn{
+	{"Id", "Id"}, {"Name", "Name"}, {"ChassisType", "ChassisType"}, {"Manufacturer", "Manufacturer"},
+	{"Model", "Model"}, {"SerialNumber", "SerialNumber"}, {"PartNumber", "PartNumber"},
+	{"AssetTag", "AssetTag"}, {"PowerState", "PowerState"}, {"IndicatorLED", "IndicatorLED"},
+	{"State", "Status.State"}, {"Health", "Status.Health"}, {"HealthRollup", "Status.HealthRollup"},
+}
+
+var redfishManagerColumns = []redfishColumn{
+	{"Id", "Id"}, {"Name", "Name"}, {"ManagerType", "ManagerType"}, {"Model", "Model"},
+	{"FirmwareVersion", "FirmwareVersion"}, {"UUID", "UUID"}, {"PowerState", "PowerState"},
+	{"State", "Status.State"}, {"Health", "Status.Health"},
+}
+
+// Thermal and Power rows share one layout; "Chassis" and "Kind" are set by
+// the collector and "Reading" is taken from the first non-empty reading path.
+var redfishSensorColumns = []string{
+	"Chassis", "Kind", "MemberId", "Name", "PhysicalContext", "Reading", "Units",
+	"UpperThresholdCritical", "LowerThresholdCritical", "Capacity", "Model",
+	"SerialNumber", "FirmwareVersion", "State", "Health",
+}
+
+type redfishSensorKind struct {
+	kind     string   // Value of the Kind column
+	array    string   // Array of the Thermal / Power resource holding the sensors
+	readings []string // Candidate reading paths, first match wins
+	units    string   // Fixed units, or "" to take ReadingUnits
+}
+
+var redfishThermalKinds = []redfishSensorKind{
+	{"Temperature", "Temperatures", []string{"ReadingCelsius"}, "Cel"},
+	{"Fan", "Fans", []string{"Reading"}, ""},
+}
+
+var redfishPowerKinds = []redfishSensorKind{
+	{"PowerControl", "PowerControl", []string{"PowerConsumedWatts"}, "W"},
+	{"PowerSupply", "PowerSupplies", []string{"LastPowerOutputWatts", "PowerOutputWatts"}, "W"},
+}
+
+// redfishSession is the session-service login of a collector.
+type redfishSession struct {
+	token    string
+	location string
+}
+
+// execRedfish executes a Redfish poll.
+func (this *RestCollector) execRedfish(job *l8tpollaris.CJob, poll *l8tpollaris.L8Poll) {
+	tokens := strings.Split(poll.What, "::")
+	if len(tokens) < 2 {
+		job.ErrorCount++
+		job.Error = "invalid Redfish What format"
+		return
+	}
+	deadline := jobDeadline(job)
+	var tbl *l8tpollaris.CTable
+	var err error
+	switch resource := strings.TrimSpace(tokens[1]); resource {
+	case "Systems":
+		tbl, err = this.redfishInventory("Systems", redfishSystemColumns, deadline)
+	case "Chassis":
+		tbl, err = this.redfishInventory("Chassis", redfishChassisColumns, deadline)
+	case "Managers":
+		tbl, err = this.redfishInventory("Managers", redfishManagerColumns, deadline)
+	case "Thermal":
+		tbl, err = this.redfishSensors("Thermal", redfishThermalKinds, deadline)
+	case "Power":
+		tbl, err = this.redfishSensors("Power", redfishPowerKinds, deadline)
+	default:
+		err = errors.New("unsupported Redfish resource: " + resource)
+	}
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	enc := object.NewEncode()
+	if err = enc.Add(tbl); err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	job.ErrorCount = 0
+	job.Result = enc.Data()
+}
+
+// redfishInventory expands the collection linked from the service root and
+// returns one row per member.
+func (this *RestCollector) redfishInventory(collection string, columns []redfishColumn, deadline time.Time) (*l8tpollaris.CTable, error) {
+	members, err := this.redfishMembers(collection, deadline)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	rows := make([]map[string]interface{}, 0, len(members))
+	for _, member := range members {
+		row := make(map[string]interface{})
+		for _, column := range columns {
+			if value := redfishValue(member, column.path); value != nil {
+				row[column.name] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return buildTable(names, rows)
+}
+
+// redfishSensors follows the Thermal or Power link of every chassis and
+// returns one row per sensor, fan, power supply or power control.
+func (this *RestCollector) redfishSensors(link string, kinds []redfishSensorKind, deadline time.Time) (*l8tpollaris.CTable, error) {
+	chassis, err := this.redfishMembers("Chassis", deadline)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]map[string]interface{}, 0)
+	for _, ch := range chassis {
+		path := redfishLink(ch, link)
+		if path == "" {
+			continue
+		}
+		resource, err := this.redfishGet(path, deadline)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range kinds {
+			items, _ := resource[kind.array].([]interface{})
+			for _, item := range items {
+				sensor, ok := item.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				row := map[string]interface{}{"Chassis": ch["Id"], "Kind": kind.kind}
+				for _, column := range []string{"MemberId", "Name", "PhysicalContext", "UpperThresholdCritical",
+					"LowerThresholdCritical", "Model", "SerialNumber", "FirmwareVersion"} {
+					row[column] = sensor[column]
+				}
+				row["State"] = redfishValue(sensor, "Status.State")
+				row["Health"] = redfishValue(sensor, "Status.Health")
+				row["Capacity"] = redfishValue(sensor, "PowerCapacityWatts")
+				for _, reading := range kind.readings {
+					if value := redfishValue(sensor, reading); value != nil {
+						row["Reading"] = value
+						break
+					}
+				}
+				if kind.units != "" {
+					row["Units"] = kind.units
+				} else {
+					row["Units"] = sensor["ReadingUnits"]
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	return buildTable(redfishSensorColumns, rows)
+}
+
+// redfishMembers returns the expanded members of a collection linked from
+// the service root, across all its pages, ordered by their @odata.id.
+func (this *RestCollector) redfishMembers(collection string, deadline time.Time) ([]map[string]interface{}, error) {
+	root, err := this.redfishGet(RedfishRoot, deadline)
+	if err != nil {
+		return nil, err
+	}
+	path := redfishLink(root, collection)
+	if path == "" {
+		return nil, errors.New("Redfish service root has no " + collection + " link")
+	}
+	// Large collections are paged: each page links the next one through
+	// Members@odata.nextLink until the last page omits it.
+	links := make([]string, 0)
+	visited := make(map[string]bool)
+	for path != "" && !visited[path] {
+		visited[path] = true
+		coll, err := this.redfishGet(path, deadline)
+		if err != nil {
+			return nil, err
+		}
+		refs, _ := coll["Members"].([]interface{})
+		for _, ref := range refs {
+			if m, ok := ref.(map[string]interface{}); ok {
+				if id, ok := m["@odata.id"].(string); ok {
+					links = append(links, id)
+				}
+			}
+		}
+		path, _ = coll["Members@odata.nextLink"].(string)
+	}
+	sort.Strings(links)
+	members := make([]map[string]interface{}, 0, len(links))
+	for _, link := range links {
+		member, err := this.redfishGet(link, deadline)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// redfishGet fetches a Redfish resource, logging in through the session
+// service when credentials are configured. An expired session is renewed
+// once.
+func (this *RestCollector) redfishGet(path string, deadline time.Time) (map[string]interface{}, error) {
+	for attempt := 0; ; attempt++ {
+		if err := this.redfishLogin(deadline); err != nil {
+			return nil, err
+		}
+		header := http.Header{}
+		header.Set("Accept", "application/json")
+		if this.redfish != nil {
+			header.Set("X-Auth-Token", this.redfish.token)
+		}
+		resp, err := this.request(http.MethodGet, this.hostURL()+path, "", header, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if resp.status == http.StatusUnauthorized && this.redfish != nil && attempt == 0 {
+			this.redfish = nil
+			continue
+		}
+		if resp.status != http.StatusOK {
+			return nil, fmt.Errorf("Redfish GET %s: HTTP %d", path, resp.status)
+		}
+		result := make(map[string]interface{})
+		if err = json.Unmarshal(resp.body, &result); err != nil {
+			return nil, fmt.Errorf("Redfish GET %s: %w", path, err)
+		}
+		return result, nil
+	}
+}
+
+// redfishLogin creates a session through the session service if the host
+// has credentials and no session is open.
+func (this *RestCollector) redfishLogin(deadline time.Time) error {
+	ainfo := this.hostProtocol.Ainfo
+	if this.redfish != nil || ainfo.ApiUser == "" {
+		return nil
+	}
+	sessions, err := this.redfishSessionsURI(deadline)
+	if err != nil {
+		return errors.New("Redfish session login failed: " + err.Error())
+	}
+	body, _ := json.Marshal(map[string]string{"UserName": ainfo.ApiUser, "Password": ainfo.ApiKey})
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	resp, err := this.request(http.MethodPost, this.hostURL()+sessions, string(body), header, deadline)
+	if err != nil {
+		return errors.New("Redfish session login failed: " + err.Error())
+	}
+	if resp.status != http.StatusOK && resp.status != http.StatusCreated {
+		return fmt.Errorf("Redfish session login returned HTTP %d", resp.status)
+	}
+	token := resp.header.Get("X-Auth-Token")
+	if token == "" {
+		return errors.New("Redfish session login returned no X-Auth-Token")
+	}
+	this.redfish = &redfishSession{token: token, location: resp.header.Get("Location")}
+	return nil
+}
+
+// redfishSessionsURI returns the session collection linked from the service
+// root, which Redfish serves without authentication, defaulting to the
+// SessionService's standard path. The service root is fetched once.
+func (this *RestCollector) redfishSessionsURI(deadline time.Time) (string, error) {
+	if this.redfishSessions != "" {
+		return this.redfishSessions, nil
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	resp, err := this.request(http.MethodGet, this.hostURL()+RedfishRoot, "", header, deadline)
+	if err != nil {
+		return "", err
+	}
+	if resp.status != http.StatusOK {
+		return "", fmt.Errorf("Redfish GET %s: HTTP %d", RedfishRoot, resp.status)
+	}
+	root := make(map[string]interface{})
+	if err = json.Unmarshal(resp.body, &root); err != nil {
+		return "", fmt.Errorf("Redfish GET %s: %w", RedfishRoot, err)
+	}
+	links, _ := root["Links"].(map[string]interface{})
+	this.redfishSessions = redfishLink(links, "Sessions")
+	if this.redfishSessions == "" {
+		this.redfishSessions = RedfishRoot + "SessionService/Sessions"
+	}
+	return this.redfishSessions, nil
+}
+
+// redfishLogout deletes the session created by redfishLogin.
+func (this *RestCollector) redfishLogout() {
+	if this.redfish == nil || this.redfish.location == "" {
+		this.redfish = nil
+		return
+	}
+	location := this.redfish.location
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		location = this.hostURL() + location
+	}
+	header := http.Header{}
+	header.Set("X-Auth-Token", this.redfish.token)
+	this.request(http.MethodDelete, location, "", header, noDeadline)
+	this.redfish = nil
+}
+
+// redfishLink returns the @odata.id of a linked resource.
+func redfishLink(resource map[string]interface{}, name string) string {
+	if link, ok := resource[name].(map[string]interface{}); ok {
+		if id, ok := link["@odata.id"].(string); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// redfishValue returns the value at a "." separated path, or nil.
+func redfishValue(resource map[string]interface{}, path string) interface{} {
+	var current interface{} = resource
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	switch current.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil
+	}
+	return current
+}
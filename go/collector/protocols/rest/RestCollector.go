@@ -15,7 +15,7 @@ limitations under the License.
 
 // Package rest provides a REST protocol collector implementation for
 // the L8Collector service. It enables data collection from REST APIs
-// and forwards raw JSON responses to the parser.
+// and forwards the responses to the parser keyed by their format.
 package rest
 
 import (
@@ -30,7 +30,9 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/saichler/l8collector/go/collector/protocols"
 	"github.com/saichler/l8pollaris/go/pollaris"
 	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
 	"github.com/saichler/l8srlz/go/serialize/object"
@@ -38,7 +40,7 @@ import (
 )
 
 // RestCollector implements the ProtocolCollector interface for REST APIs.
-// It executes HTTP requests and stores raw JSON responses in the job result.
+// It executes HTTP requests and stores the responses in the job result.
 type RestCollector struct {
 	httpClient   *http.Client
 	hostProtocol *l8tpollaris.L8PHostProtocol
@@ -47,6 +49,15 @@ type RestCollector struct {
 	baseURL      string
 	csrfToken    string
 	csrfRegex    *regexp.Regexp
+	retryPolicy  RetryPolicy
+	limiter      *rateLimiter
+	conditional  *conditionalCache
+	// restconfAPIRoot is the RESTCONF root discovered from host-meta
+	restconfAPIRoot string
+	// redfish is the open Redfish session, if any
+	redfish *redfishSession
+	// redfishSessions is the session collection linked from the service root
+	redfishSessions string
 }
 
 // Init initializes the REST collector with the provided host configuration.
@@ -54,8 +65,12 @@ func (this *RestCollector) Init(hostConn *l8tpollaris.L8PHostProtocol, r ifs.IRe
 	if hostConn.Ainfo == nil {
 		return errors.New("host rest auth info connection info is nil")
 	}
+	policy, limit := hostSettings(hostConn, r)
 	this.hostProtocol = hostConn
 	this.resources = r
+	this.retryPolicy = policy
+	this.limiter = limiterFor(hostConn.Addr+":"+strconv.Itoa(int(hostConn.Port)), limit)
+	this.conditional = newConditionalCache()
 
 	scheme := "https"
 	this.baseURL = scheme + "://" + hostConn.Addr + ":" + strconv.Itoa(int(hostConn.Port))
@@ -91,23 +106,208 @@ func (this *RestCollector) Init(hostConn *l8tpollaris.L8PHostProtocol, r ifs.IRe
 	return nil
 }
 
+// hostSettings returns the retry policy and rate limit of a host: the
+// defaults, overridden by the "rest.<name>=<value>" entries of the host's
+// terminal commands:
+//
+//	rest.retry.max=5, rest.retry.delay=1s, rest.retry.maxDelay=30s,
+//	rest.retry.afterMax=2m, rest.retry.jitter=0.2,
+//	rest.rate.limit=10 (requests per second), rest.rate.burst=20
+//
+// Other entries are ignored. An unknown or invalid rest setting is logged
+// and ignored, so that it cannot take the host offline.
+func hostSettings(hostConn *l8tpollaris.L8PHostProtocol, r ifs.IResources) (RetryPolicy, RateLimit) {
+	policy, limit := DefaultRetryPolicy, DefaultRateLimit
+	for _, setting := range hostConn.TerminalCommands {
+		name, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !strings.HasPrefix(name, "rest.") {
+			continue
+		}
+		var err error
+		switch name {
+		case "rest.retry.max":
+			err = setInt(&policy.MaxRetries, value)
+		case "rest.retry.delay":
+			err = setDuration(&policy.BaseDelay, value)
+		case "rest.retry.maxDelay":
+			err = setDuration(&policy.MaxDelay, value)
+		case "rest.retry.afterMax":
+			err = setDuration(&policy.MaxRetryAfter, value)
+		case "rest.retry.jitter":
+			err = setFloat(&policy.Jitter, value)
+		case "rest.rate.limit":
+			err = setFloat(&limit.RequestsPerSecond, value)
+		case "rest.rate.burst":
+			err = setInt(&limit.Burst, value)
+		default:
+			err = errors.New("unknown setting")
+		}
+		if err != nil && r != nil {
+			r.Logger().Warning("Ignoring rest host setting ", setting, " of ", hostConn.Addr, ": ", err.Error())
+		}
+	}
+	return policy, limit
+}
+
+// setInt, setDuration and setFloat parse value into target, leaving it
+// unchanged when value is invalid.
+func setInt(target *int, value string) error {
+	parsed, err := strconv.Atoi(value)
+	if err == nil {
+		*target = parsed
+	}
+	return err
+}
+
+func setDuration(target *time.Duration, value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err == nil {
+		*target = parsed
+	}
+	return err
+}
+
+func setFloat(target *float64, value string) error {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		*target = parsed
+	}
+	return err
+}
+
+// SetRetryPolicy overrides the retry policy used for this collector's jobs.
+func (this *RestCollector) SetRetryPolicy(policy RetryPolicy) {
+	this.retryPolicy = policy
+}
+
+// SetRateLimit sets the request rate limit for this collector's host. The
+// limit is shared with every other collector polling the same host.
+func (this *RestCollector) SetRateLimit(limit RateLimit) {
+	if this.limiter == nil {
+		return
+	}
+	this.limiter.setLimit(limit)
+}
+
+// send waits for the host's rate limiter and performs the request. All
+// outgoing requests, including session handshakes, go through send.
+func (this *RestCollector) send(req *http.Request) (*http.Response, error) {
+	this.limiter.wait()
+	return this.httpClient.Do(req)
+}
+
+// get issues a rate-limited GET request.
+func (this *RestCollector) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return this.send(req)
+}
+
+// noDeadline is passed to request when retries are not bound by a job timeout.
+var noDeadline time.Time
+
+// jobDeadline returns the time by which retries of job must give up, or the
+// zero time if the job has no timeout.
+func jobDeadline(job *l8tpollaris.CJob) time.Time {
+	if job.Timeout > 0 {
+		return time.Now().Add(time.Duration(job.Timeout) * time.Second)
+	}
+	return noDeadline
+}
+
+// request performs a rate-limited, retried request with the given headers
+// and returns the fully read response.
+func (this *RestCollector) request(method, url, body string, header http.Header, deadline time.Time) (*response, error) {
+	return this.doWithRetry(method, func() (*http.Request, error) {
+		var reqBody io.Reader
+		if body != "" {
+			reqBody = strings.NewReader(body)
+		}
+		req, err := http.NewRequest(method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		return req, nil
+	}, deadline)
+}
+
+// parseOptions parses an "&" separated list of key=value options. Unlike
+// url.ParseQuery, values are taken verbatim so they may contain ";" (as in
+// RESTCONF fields expressions). A key without "=" maps to an empty value.
+func parseOptions(options string) map[string]string {
+	result := make(map[string]string)
+	for _, option := range strings.Split(options, "&") {
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+		if i := strings.Index(option, "="); i >= 0 {
+			result[strings.TrimSpace(option[:i])] = strings.TrimSpace(option[i+1:])
+		} else {
+			result[option] = ""
+		}
+	}
+	return result
+}
+
+// hostURL returns the scheme, address and port of the host, without the
+// configured HTTP prefix.
+func (this *RestCollector) hostURL() string {
+	return "https://" + this.hostProtocol.Addr + ":" + strconv.Itoa(int(this.hostProtocol.Port))
+}
+
+// buildTable encodes rows into a CTable with the given column order. Row
+// values must be natively encodable scalars; missing values leave the cell
+// empty.
+func buildTable(columns []string, rows []map[string]interface{}) (*l8tpollaris.CTable, error) {
+	tbl := &l8tpollaris.CTable{
+		Columns: make(map[int32]string),
+		Rows:    make(map[int32]*l8tpollaris.CRow),
+	}
+	for i, column := range columns {
+		tbl.Columns[int32(i)] = column
+	}
+	for rowIdx, row := range rows {
+		for colIdx, column := range columns {
+			value, ok := row[column]
+			if !ok || value == nil {
+				continue
+			}
+			enc := object.NewEncode()
+			if err := enc.Add(value); err != nil {
+				return nil, fmt.Errorf("encode %s: %w", column, err)
+			}
+			protocols.SetValue(int32(rowIdx), int32(colIdx), column, enc.Data(), tbl)
+		}
+	}
+	return tbl, nil
+}
+
 // Protocol returns the protocol type identifier for REST.
 func (this *RestCollector) Protocol() l8tpollaris.L8PProtocol {
 	return l8tpollaris.L8PProtocol_L8PRESTAPI
 }
 
-// parseWhat parses the poll.What field to extract HTTP method, endpoint, body, and content type.
-// Format: "METHOD::endpoint::body" or "METHOD::endpoint::body::content-type"
-func (this *RestCollector) parseWhat(poll *l8tpollaris.L8Poll) (string, string, string, string, error) {
+// parseWhat parses the poll.What field to extract HTTP method, endpoint, body, content type and options.
+// Format: "METHOD::endpoint::body", "METHOD::endpoint::body::content-type" or
+// "METHOD::endpoint::body::content-type::options", where options is an "&"
+// separated list such as "accept=application/xml&xpath.name=/device/name".
+func (this *RestCollector) parseWhat(poll *l8tpollaris.L8Poll) (string, string, string, string, map[string]string, error) {
 	tokens := strings.Split(poll.What, "::")
 	if len(tokens) < 3 {
-		return "", "", "", "", fmt.Errorf("invalid What format")
+		return "", "", "", "", nil, fmt.Errorf("invalid What format")
 	}
 
 	switch tokens[0] {
 	case "GET", "POST", "PUT", "PATCH", "DELETE":
 	default:
-		return "", "", "", "", fmt.Errorf("invalid What method: %s", tokens[0])
+		return "", "", "", "", nil, fmt.Errorf("invalid What method: %s", tokens[0])
 	}
 
 	contentType := "application/json"
@@ -115,7 +315,12 @@ func (this *RestCollector) parseWhat(poll *l8tpollaris.L8Poll) (string, string,
 		contentType = tokens[3]
 	}
 
-	return tokens[0], tokens[1], tokens[2], contentType, nil
+	options := map[string]string{}
+	if len(tokens) >= 5 {
+		options = parseOptions(tokens[4])
+	}
+
+	return tokens[0], tokens[1], tokens[2], contentType, options, nil
 }
 
 // Connect performs the authentication handshake.
@@ -155,7 +360,7 @@ func (this *RestCollector) sessionLogin() error {
 	req.Header.Set("Origin", baseScheme)
 	req.Header.Set("Referer", baseScheme+"/")
 
-	resp, err := this.httpClient.Do(req)
+	resp, err := this.send(req)
 	if err != nil {
 		return errors.New("session login request failed: " + err.Error())
 	}
@@ -182,7 +387,7 @@ func (this *RestCollector) sessionLogin() error {
 	// Visit session page to establish full session context
 	if ainfo.SessionPage != "" {
 		sessionURL := baseScheme + ainfo.SessionPage
-		sResp, err := this.httpClient.Get(sessionURL)
+		sResp, err := this.get(sessionURL)
 		if err != nil {
 			return errors.New("session page fetch failed: " + err.Error())
 		}
@@ -218,7 +423,7 @@ func (this *RestCollector) EnsureSession() error {
 		checkURL = baseScheme + "/"
 	}
 
-	resp, err := this.httpClient.Get(checkURL)
+	resp, err := this.get(checkURL)
 	if err != nil {
 		return this.sessionLogin()
 	}
@@ -243,7 +448,7 @@ func (this *RestCollector) refreshCSRF() {
 		return
 	}
 	baseScheme := "https://" + this.hostProtocol.Addr
-	resp, err := this.httpClient.Get(baseScheme + ainfo.CsrfSource)
+	resp, err := this.get(baseScheme + ainfo.CsrfSource)
 	if err != nil {
 		return
 	}
@@ -255,7 +460,7 @@ func (this *RestCollector) refreshCSRF() {
 	}
 }
 
-// Exec executes a REST API job and stores the raw JSON response in job.Result.
+// Exec executes a REST API job and stores the response in job.Result.
 func (this *RestCollector) Exec(job *l8tpollaris.CJob) {
 	ainfo := this.hostProtocol.Ainfo
 
@@ -277,7 +482,21 @@ func (this *RestCollector) Exec(job *l8tpollaris.CJob) {
 		job.Error = err.Error()
 		return
 	}
-	method, endpoint, body, contentType, err := this.parseWhat(poll)
+	this.execPoll(job, poll)
+}
+
+// execPoll executes the HTTP request described by poll for the given job.
+func (this *RestCollector) execPoll(job *l8tpollaris.CJob, poll *l8tpollaris.L8Poll) {
+	if strings.HasPrefix(poll.What, RestconfPrefix+"::") {
+		this.execRestconf(job, poll)
+		return
+	}
+	if strings.HasPrefix(poll.What, RedfishPrefix+"::") {
+		this.execRedfish(job, poll)
+		return
+	}
+	ainfo := this.hostProtocol.Ainfo
+	method, endpoint, body, contentType, options, err := this.parseWhat(poll)
 	if err != nil {
 		job.ErrorCount++
 		job.Error = err.Error()
@@ -290,76 +509,106 @@ func (this *RestCollector) Exec(job *l8tpollaris.CJob) {
 	}
 
 	fullURL := this.baseURL + endpoint
-	var reqBody io.Reader
-	if body != "" {
-		reqBody = strings.NewReader(body)
+	accept := "application/json"
+	if options["accept"] != "" {
+		accept = options["accept"]
+	}
+	// GET polls are sent as conditional requests once the server has
+	// provided an ETag or Last-Modified validator for them.
+	condKey := ""
+	if method == http.MethodGet {
+		condKey = conditionalKey(job, fullURL)
+	}
+	build := func() (*http.Request, error) {
+		var reqBody io.Reader
+		if body != "" {
+			reqBody = strings.NewReader(body)
+		}
+		req, err := http.NewRequest(method, fullURL, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", accept)
+		req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36")
+
+		// Inject CSRF token if present
+		if this.csrfToken != "" {
+			req.Header.Set("X-CSRF-Token", this.csrfToken)
+		}
+
+		// For AJAX-style requests, add standard headers
+		if ainfo.SessionAuth {
+			req.Header.Set("X-Requested-With", "XMLHttpRequest")
+			baseScheme := "https://" + this.hostProtocol.Addr
+			req.Header.Set("Origin", baseScheme)
+		}
+		if condKey != "" {
+			this.conditional.apply(condKey, req)
+		}
+		return req, nil
 	}
 
-	req, err := http.NewRequest(method, fullURL, reqBody)
+	// Retries must not outlive the job's timeout
+	resp, err := this.doWithRetry(method, build, jobDeadline(job))
 	if err != nil {
 		job.ErrorCount++
 		job.Error = err.Error()
 		return
 	}
-	req.Header.Set("Content-Type", contentType)
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36")
 
-	// Inject CSRF token if present
-	if this.csrfToken != "" {
-		req.Header.Set("X-CSRF-Token", this.csrfToken)
-	}
-
-	// For AJAX-style requests, add standard headers
-	if ainfo.SessionAuth {
-		req.Header.Set("X-Requested-With", "XMLHttpRequest")
-		baseScheme := "https://" + this.hostProtocol.Addr
-		req.Header.Set("Origin", baseScheme)
-	}
-
-	resp, err := this.httpClient.Do(req)
-	if err != nil {
+	// Not modified, reuse the previous result so the job's result hash is
+	// unchanged and nothing is forwarded to the parser.
+	if resp.status == http.StatusNotModified {
+		if state, ok := this.conditional.get(condKey); ok {
+			job.ErrorCount = 0
+			job.Result = state.result
+			return
+		}
 		job.ErrorCount++
-		job.Error = err.Error()
+		job.Error = "HTTP 304 without a cached result for " + fullURL
 		return
 	}
-	defer resp.Body.Close()
 
-	jsonBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
+	if resp.status < 200 || resp.status >= 300 {
 		job.ErrorCount++
-		job.Error = err.Error()
+		job.Error = fmt.Sprintf("HTTP %d: %s", resp.status, string(resp.body))
 		return
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+	// Keep the body in a CMap (or a CTable for CSV) keyed by its actual
+	// format so the parser can deserialize it
+	format := responseFormat(resp.header.Get("Content-Type"), resp.body, options)
+	result, err := decodeResponse(format, resp.body, options)
+	if err != nil {
 		job.ErrorCount++
-		job.Error = fmt.Sprintf("HTTP %d: %s", resp.StatusCode, string(jsonBytes))
+		job.Error = err.Error()
 		return
 	}
 
 	job.ErrorCount = 0
-
-	// Wrap JSON in a CMap so the parser can deserialize it
-	cmap := &l8tpollaris.CMap{}
-	cmap.Data = make(map[string][]byte)
-	enc := object.NewEncode()
-	enc.Add(string(jsonBytes))
-	cmap.Data["json"] = enc.Data()
-
-	encMap := object.NewEncode()
-	encMap.Add(cmap)
-	job.Result = encMap.Data()
+	encResult := object.NewEncode()
+	encResult.Add(result)
+	job.Result = encResult.Data()
+	if condKey != "" {
+		this.conditional.store(condKey, resp.header, job.Result)
+	}
 }
 
 // Disconnect releases all resources.
 func (this *RestCollector) Disconnect() error {
+	if this.redfish != nil && this.httpClient != nil {
+		this.redfishLogout()
+	}
 	this.httpClient = nil
 	this.hostProtocol = nil
 	this.resources = nil
 	this.connected = false
 	this.csrfToken = ""
 	this.csrfRegex = nil
+	this.conditional = nil
+	this.restconfAPIRoot = ""
+	this.redfishSessions = ""
 	return nil
 }
 
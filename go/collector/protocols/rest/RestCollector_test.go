@@ -0,0 +1,463 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+	"github.com/saichler/l8utils/go/utils/registry"
+)
+
+// newTestCollector returns a RestCollector pointed at the given TLS test server.
+func newTestCollector(t *testing.T, server *httptest.Server) *RestCollector {
+	t.Helper()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("parse server url: %v", err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	collector := &RestCollector{}
+	err = collector.Init(&l8tpollaris.L8PHostProtocol{
+		Protocol: l8tpollaris.L8PProtocol_L8PRESTAPI,
+		Addr:     u.Hostname(),
+		Port:     int32(port),
+		Ainfo:    &l8tpollaris.AuthInfo{},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	collector.SetRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond, MaxRetryAfter: time.Second})
+	return collector
+}
+
+// decodeResult decodes an encoded CMap or CTable job result.
+func decodeResult(t *testing.T, job *l8tpollaris.CJob) interface{} {
+	t.Helper()
+	r := registry.NewRegistry()
+	r.Register(&l8tpollaris.CMap{})
+	r.Register(&l8tpollaris.CTable{})
+	value, err := object.NewDecode(job.Result, 0, r).Get()
+	if err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	return value
+}
+
+// decodeCMapValue decodes a single CMap entry.
+func decodeCMapValue(t *testing.T, job *l8tpollaris.CJob, key string) interface{} {
+	t.Helper()
+	cmap := decodeResult(t, job).(*l8tpollaris.CMap)
+	data, ok := cmap.Data[key]
+	if !ok {
+		t.Fatalf("result has no %q key", key)
+	}
+	value, err := object.NewDecode(data, 0, nil).Get()
+	if err != nil {
+		t.Fatalf("decode %s key: %v", key, err)
+	}
+	return value
+}
+
+func decodeJsonResult(t *testing.T, job *l8tpollaris.CJob) string {
+	t.Helper()
+	return decodeCMapValue(t, job, "json").(string)
+}
+
+func TestExecRetriesTransientFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	job := &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/status::"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 calls, got %d", calls)
+	}
+	if decodeJsonResult(t, job) != `{"ok":true}` {
+		t.Fatalf("unexpected result")
+	}
+}
+
+func TestExecDoesNotRetryNonIdempotent(t *testing.T) {
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	job := &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "POST::/status::{}"})
+	if job.ErrorCount != 1 {
+		t.Fatalf("expected error count 1, got %d", job.ErrorCount)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestExecHonorsRetryAfter(t *testing.T) {
+	var calls int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	job := &l8tpollaris.CJob{}
+	start := time.Now()
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "POST::/query::{}"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Fatalf("expected Retry-After wait, elapsed %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Now()
+	if d, ok := parseRetryAfter("5", now); !ok || d != 5*time.Second {
+		t.Fatalf("unexpected seconds delay: %v %v", d, ok)
+	}
+	date := now.Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(date, now); !ok || d < 8*time.Second || d > 10*time.Second {
+		t.Fatalf("unexpected date delay: %v %v", d, ok)
+	}
+	if _, ok := parseRetryAfter("soon", now); ok {
+		t.Fatal("expected invalid Retry-After")
+	}
+}
+
+func TestRateLimiterBoundsRequestRate(t *testing.T) {
+	limiter := &rateLimiter{limit: RateLimit{RequestsPerSecond: 20, Burst: 1}, tokens: 1, last: time.Now()}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		limiter.wait()
+	}
+	// One request from the burst, four more at 50ms each
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Fatalf("rate limit not enforced, elapsed %v", elapsed)
+	}
+}
+
+func TestExecConditionalRequests(t *testing.T) {
+	var full, notModified int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`{"inventory":[1,2,3]}`))
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	job := &l8tpollaris.CJob{PollarisName: "inv", JobName: "devices"}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/inventory::"})
+	first := job.Result
+
+	job.Result = nil
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/inventory::"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	if full != 1 || notModified != 1 {
+		t.Fatalf("expected 1 full and 1 conditional response, got %d and %d", full, notModified)
+	}
+	if string(job.Result) != string(first) {
+		t.Fatal("expected the cached result to be reused on 304")
+	}
+}
+
+func TestExecRestconfDiscoversRootAndFlattensList(t *testing.T) {
+	var query string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/host-meta":
+			w.Write([]byte(`<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0"><Link rel="restconf" href="/top/restconf"/></XRD>`))
+		case "/top/restconf/data/ietf-interfaces:interfaces":
+			query = r.URL.RawQuery
+			if r.Header.Get("Accept") != RestconfJson {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			w.Write([]byte(`{"ietf-interfaces:interfaces":{"interface":[
+				{"name":"eth1","enabled":false,"statistics":{"in-octets":"20"}},
+				{"name":"eth0","enabled":true,"statistics":{"in-octets":"10"},"ietf-ip:ipv4":{"mtu":1500}}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	job := &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{
+		What:      "RESTCONF::data/ietf-interfaces:interfaces::depth=3&fields=interface(name;enabled)&content=nonconfig",
+		Operation: l8tpollaris.L8C_Operation_L8C_Table,
+	})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	if query != "depth=3&fields=interface%28name%3Benabled%29&content=nonconfig" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	tbl := decodeResult(t, job).(*l8tpollaris.CTable)
+	expected := []string{"name", "enabled", "ipv4/mtu", "statistics/in-octets"}
+	for i, column := range expected {
+		if tbl.Columns[int32(i)] != column {
+			t.Fatalf("column %d: expected %s, got %s", i, column, tbl.Columns[int32(i)])
+		}
+	}
+	first, err := object.NewDecode(tbl.Rows[0].Data[0], 0, nil).Get()
+	if err != nil || first != "eth0" {
+		t.Fatalf("expected rows sorted by key, got %v %v", first, err)
+	}
+	if _, ok := tbl.Rows[1].Data[2]; ok {
+		t.Fatal("expected no ipv4/mtu cell for eth1")
+	}
+}
+
+func TestRestconfRootIsRediscoveredAfterTransientFailure(t *testing.T) {
+	var unavailable int32 = 1
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&unavailable) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0"><Link rel="restconf" href="/top/restconf"/></XRD>`))
+	}))
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	collector.SetRetryPolicy(RetryPolicy{})
+	if root := collector.restconfRoot(); !strings.HasSuffix(root, "/restconf") || collector.restconfAPIRoot != "" {
+		t.Fatalf("expected the fallback root, uncached, got %s", root)
+	}
+	atomic.StoreInt32(&unavailable, 0)
+	if root := collector.restconfRoot(); !strings.HasSuffix(root, "/top/restconf") || collector.restconfAPIRoot != root {
+		t.Fatalf("expected the discovered root to be cached, got %s", root)
+	}
+}
+
+func TestRestconfRejectsInvalidDepth(t *testing.T) {
+	rp, err := parseRestconfWhat("RESTCONF::data/x::depth=0")
+	if err != nil {
+		t.Fatalf("parse error: %v", err)
+	}
+	if _, err = rp.query(); err == nil {
+		t.Fatal("expected invalid depth error")
+	}
+}
+
+// newMockRedfish serves a minimal Redfish tree with one system and one
+// chassis, links its session collection from the service root and requires
+// a session token on every other resource.
+func newMockRedfish(t *testing.T, logouts *int32) *httptest.Server {
+	t.Helper()
+	resources := map[string]string{
+		"/redfish/v1/": `{"Systems":{"@odata.id":"/redfish/v1/Systems"},"Chassis":{"@odata.id":"/redfish/v1/Chassis"},
+			"Managers":{"@odata.id":"/redfish/v1/Managers"},"Links":{"Sessions":{"@odata.id":"/redfish/v1/Sessions"}}}`,
+		"/redfish/v1/Systems": `{"Members":[{"@odata.id":"/redfish/v1/Systems/1"}],
+			"Members@odata.nextLink":"/redfish/v1/Systems?$skip=1"}`,
+		"/redfish/v1/Systems?$skip=1": `{"Members":[{"@odata.id":"/redfish/v1/Systems/2"}]}`,
+		"/redfish/v1/Systems/1":       `{"Id":"1","Model":"R650","SerialNumber":"SN1","PowerState":"On","ProcessorSummary":{"Count":2},"Status":{"Health":"OK"}}`,
+		"/redfish/v1/Systems/2":       `{"Id":"2","Model":"R650","SerialNumber":"SN2","PowerState":"Off","ProcessorSummary":{"Count":2},"Status":{"Health":"OK"}}`,
+		"/redfish/v1/Chassis":         `{"Members":[{"@odata.id":"/redfish/v1/Chassis/1"}]}`,
+		"/redfish/v1/Chassis/1":       `{"Id":"1","ChassisType":"RackMount","Thermal":{"@odata.id":"/redfish/v1/Chassis/1/Thermal"}}`,
+		"/redfish/v1/Chassis/1/Thermal": `{"Temperatures":[{"MemberId":"0","Name":"Inlet","ReadingCelsius":24,"Status":{"Health":"OK"}}],
+			"Fans":[{"MemberId":"0","Name":"Fan1","Reading":5400,"ReadingUnits":"RPM"}]}`,
+	}
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/redfish/v1/Sessions":
+			w.Header().Set("X-Auth-Token", "token1")
+			w.Header().Set("Location", "/redfish/v1/Sessions/1")
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodDelete && r.URL.Path == "/redfish/v1/Sessions/1":
+			atomic.AddInt32(logouts, 1)
+		case r.Method == http.MethodGet && r.URL.Path == "/redfish/v1/":
+			w.Write([]byte(resources[r.URL.Path]))
+		case r.Header.Get("X-Auth-Token") != "token1":
+			w.WriteHeader(http.StatusUnauthorized)
+		case resources[r.URL.RequestURI()] != "":
+			w.Write([]byte(resources[r.URL.RequestURI()]))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestExecRedfishInventoryAndSensors(t *testing.T) {
+	var logouts int32
+	server := newMockRedfish(t, &logouts)
+	defer server.Close()
+
+	collector := newTestCollector(t, server)
+	collector.hostProtocol.Ainfo.ApiUser = "admin"
+	collector.hostProtocol.Ainfo.ApiKey = "secret"
+
+	job := &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "REDFISH::Systems"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	systems := decodeResult(t, job).(*l8tpollaris.CTable)
+	if len(systems.Rows) != 2 {
+		t.Fatalf("expected a system from each page, got %d", len(systems.Rows))
+	}
+	for idx, name := range systems.Columns {
+		if name == "ProcessorCount" {
+			count, _ := object.NewDecode(systems.Rows[0].Data[idx], 0, nil).Get()
+			if count != float64(2) {
+				t.Fatalf("unexpected processor count %v", count)
+			}
+		}
+	}
+
+	job = &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "REDFISH::Thermal"})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	thermal := decodeResult(t, job).(*l8tpollaris.CTable)
+	if len(thermal.Rows) != 2 {
+		t.Fatalf("expected a temperature and a fan row, got %d", len(thermal.Rows))
+	}
+
+	collector.Disconnect()
+	if logouts != 1 {
+		t.Fatalf("expected session logout, got %d", logouts)
+	}
+}
+
+func TestExecDecodesByContentType(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/device.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<device serial="S1"><name>edge-1</name><port id="1"><speed>1G</speed></port><port id="2"><speed>10G</speed></port></device>`))
+		case "/ports.csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("port,speed\n1,1G\n2,10G\n"))
+		case "/motd":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("welcome"))
+		case "/status":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`{"status":"up"}`))
+		}
+	}))
+	defer server.Close()
+	collector := newTestCollector(t, server)
+
+	job := &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{
+		What: "GET::/device.xml::::::accept=application/xml&xpath.name=/device/name&xpath.serial=/device/@serial&xpath.speed=//port[@id='2']/speed",
+	})
+	if job.Error != "" {
+		t.Fatalf("unexpected error: %s", job.Error)
+	}
+	expected := map[string]string{"name": "edge-1", "serial": "S1", "speed": "10G"}
+	for key, value := range expected {
+		if got := decodeCMapValue(t, job, key); got != value {
+			t.Fatalf("%s: expected %s, got %v", key, value, got)
+		}
+	}
+	decodeCMapValue(t, job, "xml")
+
+	job = &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/ports.csv::"})
+	tbl := decodeResult(t, job).(*l8tpollaris.CTable)
+	if tbl.Columns[0] != "port" || tbl.Columns[1] != "speed" || len(tbl.Rows) != 2 {
+		t.Fatalf("unexpected csv table: %v with %d rows", tbl.Columns, len(tbl.Rows))
+	}
+
+	job = &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/motd::"})
+	if decodeCMapValue(t, job, "text") != "welcome" {
+		t.Fatal("expected text result")
+	}
+
+	job = &l8tpollaris.CJob{}
+	collector.execPoll(job, &l8tpollaris.L8Poll{What: "GET::/status::"})
+	if decodeCMapValue(t, job, "json") != `{"status":"up"}` {
+		t.Fatal("expected a JSON body served as text/html under json")
+	}
+}
+
+func TestFlattenYangListFromXML(t *testing.T) {
+	doc, err := DecodeXML([]byte(`<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces">
+		<interface><name>eth1</name><enabled>false</enabled></interface>
+		<interface><name>eth0</name><enabled>true</enabled></interface></interfaces>`))
+	if err != nil {
+		t.Fatalf("decode xml: %v", err)
+	}
+	tbl, err := FlattenYangList(doc, "", nil)
+	if err != nil {
+		t.Fatalf("flatten: %v", err)
+	}
+	if len(tbl.Rows) != 2 || tbl.Columns[0] != "name" || tbl.Columns[1] != "enabled" {
+		t.Fatalf("unexpected table %v", tbl.Columns)
+	}
+}
+
+func TestFlattenYangEmptyLeaf(t *testing.T) {
+	row := make(map[string]interface{})
+	flattenYangNode("", map[string]interface{}{"x": []interface{}{nil}, "y": []interface{}{"a", nil, "b"}}, row)
+	if x, ok := row["x"]; !ok || x != "" {
+		t.Fatalf("expected [null] to flatten to an empty leaf, got %v", row["x"])
+	}
+	if row["y"] != "a,b" {
+		t.Fatalf("expected null items to be skipped, got %v", row["y"])
+	}
+}
+
+func TestHostSettingsOverrideDefaults(t *testing.T) {
+	host := &l8tpollaris.L8PHostProtocol{
+		Addr: "10.0.0.1", Port: 8443, Ainfo: &l8tpollaris.AuthInfo{},
+		TerminalCommands: []string{"terminal length 0", "rest.retry.max=5", "rest.retry.delay=2s",
+			"rest.retry.jitter=lots", "rest.unknown=1", "rest.rate.limit=10", "rest.rate.burst=20"},
+	}
+	collector := &RestCollector{}
+	if err := collector.Init(host, nil); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	if collector.retryPolicy.MaxRetries != 5 || collector.retryPolicy.BaseDelay != 2*time.Second ||
+		collector.retryPolicy.MaxDelay != DefaultRetryPolicy.MaxDelay || collector.retryPolicy.Jitter != DefaultRetryPolicy.Jitter {
+		t.Fatalf("unexpected retry policy %+v", collector.retryPolicy)
+	}
+	if collector.limiter.limit != (RateLimit{RequestsPerSecond: 10, Burst: 20}) {
+		t.Fatalf("unexpected rate limit %+v", collector.limiter.limit)
+	}
+	if other := limiterFor("10.0.0.1:9443", RateLimit{}); other == collector.limiter {
+		t.Fatal("expected a limiter per address and port")
+	}
+}
@@ -0,0 +1,400 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/saichler/l8pollaris/go/types/l8tpollaris"
+	"github.com/saichler/l8srlz/go/serialize/object"
+)
+
+// RESTCONF media types (RFC 8040).
+const (
+	RestconfJson = "application/yang-data+json"
+	RestconfXml  = "application/yang-data+xml"
+)
+
+// RestconfPrefix marks a poll as a RESTCONF poll. The poll.What format is
+// "RESTCONF::<resource path>::<options>", where the resource path is relative
+// to the discovered API root (e.g. "data/ietf-interfaces:interfaces") and
+// options is an "&" separated list of:
+//   - depth=<1..65535|unbounded>
+//   - fields=<RESTCONF fields expression>
+//   - content=<config|nonconfig|all>
+//   - format=<json|xml>
+//   - list=<path to the YANG list to flatten, e.g. ietf-interfaces:interfaces/interface>
+//   - keys=<comma separated list keys, defaults to "name" when present>
+const RestconfPrefix = "RESTCONF"
+
+// hostMeta is the XRD document served at /.well-known/host-meta.
+type hostMeta struct {
+	Links []struct {
+		Rel  string `xml:"rel,attr" json:"rel"`
+		Href string `xml:"href,attr" json:"href"`
+	} `xml:"Link" json:"links"`
+}
+
+// restconfPoll is a parsed RESTCONF poll.What.
+type restconfPoll struct {
+	path    string
+	options map[string]string
+}
+
+func parseRestconfWhat(what string) (*restconfPoll, error) {
+	tokens := strings.Split(what, "::")
+	if len(tokens) < 2 || tokens[0] != RestconfPrefix {
+		return nil, errors.New("invalid RESTCONF What format")
+	}
+	rp := &restconfPoll{path: strings.TrimSpace(tokens[1])}
+	if len(tokens) >= 3 {
+		rp.options = parseOptions(tokens[2])
+	} else {
+		rp.options = map[string]string{}
+	}
+	return rp, nil
+}
+
+// query builds the RESTCONF query string from the poll options.
+func (this *restconfPoll) query() (string, error) {
+	values := make([]string, 0, 3)
+	if depth, ok := this.options["depth"]; ok {
+		if depth != "unbounded" {
+			d, err := strconv.Atoi(depth)
+			if err != nil || d < 1 || d > 65535 {
+				return "", errors.New("invalid RESTCONF depth: " + depth)
+			}
+		}
+		values = append(values, "depth="+depth)
+	}
+	if fields, ok := this.options["fields"]; ok && fields != "" {
+		values = append(values, "fields="+url.QueryEscape(fields))
+	}
+	if content, ok := this.options["content"]; ok {
+		switch content {
+		case "config", "nonconfig", "all":
+		default:
+			return "", errors.New("invalid RESTCONF content: " + content)
+		}
+		values = append(values, "content="+content)
+	}
+	return strings.Join(values, "&"), nil
+}
+
+func (this *restconfPoll) mediaType() string {
+	if strings.EqualFold(this.options["format"], "xml") {
+		return RestconfXml
+	}
+	return RestconfJson
+}
+
+// restconfRoot discovers the RESTCONF API root from the host-meta resource.
+// Falls back to "/restconf" when discovery fails. The root is cached when
+// discovery succeeded or the host answered with a status that will not
+// change on retry, e.g. 404 when it has no host-meta; after a transient
+// failure, the next poll discovers it again.
+func (this *RestCollector) restconfRoot() string {
+	if this.restconfAPIRoot != "" {
+		return this.restconfAPIRoot
+	}
+	hostURL := this.hostURL()
+	root := hostURL + "/restconf"
+	header := http.Header{}
+	header.Set("Accept", "application/xrd+xml")
+	resp, err := this.request(http.MethodGet, hostURL+"/.well-known/host-meta", "", header, noDeadline)
+	if err != nil || isRetryableStatus(resp.status) || resp.status == http.StatusTooManyRequests {
+		return root
+	}
+	if resp.status == http.StatusOK {
+		if href := restconfLink(resp.body); href != "" {
+			if strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") {
+				root = href
+			} else {
+				root = hostURL + "/" + strings.TrimPrefix(href, "/")
+			}
+		}
+	}
+	this.restconfAPIRoot = strings.TrimSuffix(root, "/")
+	return this.restconfAPIRoot
+}
+
+// restconfLink extracts the "restconf" link from an XRD document in either
+// XML or JSON form.
+func restconfLink(body []byte) string {
+	meta := &hostMeta{}
+	if err := xml.Unmarshal(body, meta); err != nil {
+		if err = json.Unmarshal(body, meta); err != nil {
+			return ""
+		}
+	}
+	for _, link := range meta.Links {
+		if link.Rel == "restconf" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// execRestconf executes a RESTCONF poll. Table polls flatten the selected
+// YANG list into a CTable; other polls forward the document as-is in a CMap
+// under the "json" or "xml" key.
+func (this *RestCollector) execRestconf(job *l8tpollaris.CJob, poll *l8tpollaris.L8Poll) {
+	rp, err := parseRestconfWhat(poll.What)
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	query, err := rp.query()
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	path := rp.path
+	if job.TargetId != "" {
+		path = strings.ReplaceAll(path, "$symbol", job.TargetId)
+	}
+	fullURL := this.restconfRoot() + "/" + strings.TrimPrefix(path, "/")
+	if query != "" {
+		fullURL += "?" + query
+	}
+
+	header := http.Header{}
+	header.Set("Accept", rp.mediaType())
+	ainfo := this.hostProtocol.Ainfo
+	if !ainfo.SessionAuth && ainfo.ApiUser != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(ainfo.ApiUser + ":" + ainfo.ApiKey))
+		header.Set("Authorization", "Basic "+credentials)
+	}
+
+	resp, err := this.request(http.MethodGet, fullURL, "", header, jobDeadline(job))
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	if resp.status < 200 || resp.status >= 300 {
+		job.ErrorCount++
+		job.Error = fmt.Sprintf("HTTP %d: %s", resp.status, string(resp.body))
+		return
+	}
+
+	var result interface{}
+	format := FormatJson
+	if rp.mediaType() == RestconfXml {
+		format = FormatXml
+	}
+	if poll.Operation == l8tpollaris.L8C_Operation_L8C_Table || rp.options["list"] != "" {
+		var doc interface{}
+		if format == FormatXml {
+			doc, err = DecodeXML(resp.body)
+		} else {
+			err = json.Unmarshal(resp.body, &doc)
+		}
+		if err != nil {
+			job.ErrorCount++
+			job.Error = err.Error()
+			return
+		}
+		var keys []string
+		if rp.options["keys"] != "" {
+			keys = strings.Split(rp.options["keys"], ",")
+		}
+		result, err = FlattenYangList(doc, rp.options["list"], keys)
+	} else {
+		result, err = decodeResponse(format, resp.body, rp.options)
+	}
+	if err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+
+	enc := object.NewEncode()
+	if err = enc.Add(result); err != nil {
+		job.ErrorCount++
+		job.Error = err.Error()
+		return
+	}
+	job.ErrorCount = 0
+	job.Result = enc.Data()
+}
+
+// FlattenYangList converts the YANG list found at listPath inside a
+// RESTCONF JSON document into a CTable. listPath is a "/" separated path of
+// node names, with or without module prefixes; when empty, single-child
+// containers are descended until a list is reached.
+//
+// Each list entry becomes a row. Nested containers are flattened into
+// "/" separated column names, leaf-lists are joined with "," and nested
+// lists are kept as JSON text. Key columns come first and rows are ordered
+// by their key values so the table is stable between polls. When keys is
+// empty, "name" is used if every entry has it.
+func FlattenYangList(doc interface{}, listPath string, keys []string) (*l8tpollaris.CTable, error) {
+	entries, err := yangListEntries(doc, listPath)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]map[string]interface{}, 0, len(entries))
+	columnSet := make(map[string]bool)
+	for _, entry := range entries {
+		row := make(map[string]interface{})
+		flattenYangNode("", entry, row)
+		for column := range row {
+			columnSet[column] = true
+		}
+		rows = append(rows, row)
+	}
+
+	if len(keys) == 0 && columnSet["name"] {
+		keys = []string{"name"}
+		for _, row := range rows {
+			if _, ok := row["name"]; !ok {
+				keys = nil
+				break
+			}
+		}
+	}
+
+	columns := make([]string, 0, len(columnSet))
+	for _, key := range keys {
+		key = strings.TrimSpace(key)
+		columns = append(columns, key)
+		delete(columnSet, key)
+	}
+	rest := make([]string, 0, len(columnSet))
+	for column := range columnSet {
+		rest = append(rest, column)
+	}
+	sort.Strings(rest)
+	columns = append(columns, rest...)
+
+	if len(keys) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			return yangRowKey(rows[i], keys) < yangRowKey(rows[j], keys)
+		})
+	}
+
+	return buildTable(columns, rows)
+}
+
+func yangListEntries(doc interface{}, listPath string) ([]interface{}, error) {
+	current := doc
+	listPath = strings.Trim(listPath, "/")
+	if listPath != "" {
+		for _, part := range strings.Split(listPath, "/") {
+			m, ok := current.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("YANG path " + listPath + " not found at " + part)
+			}
+			next, ok := yangChild(m, part)
+			if !ok {
+				return nil, errors.New("YANG path " + listPath + " not found at " + part)
+			}
+			current = next
+		}
+	} else {
+		for {
+			m, ok := current.(map[string]interface{})
+			if !ok || len(m) != 1 {
+				break
+			}
+			for _, child := range m {
+				current = child
+			}
+		}
+	}
+	switch typed := current.(type) {
+	case []interface{}:
+		return typed, nil
+	case map[string]interface{}:
+		return []interface{}{typed}, nil
+	}
+	return nil, errors.New("YANG path " + listPath + " is not a list")
+}
+
+// yangChild returns the child node by exact name, or by name without its
+// module prefix ("ietf-interfaces:interfaces" matches "interfaces").
+func yangChild(m map[string]interface{}, name string) (interface{}, bool) {
+	if child, ok := m[name]; ok {
+		return child, true
+	}
+	for key, child := range m {
+		if stripYangModule(key) == stripYangModule(name) {
+			return child, true
+		}
+	}
+	return nil, false
+}
+
+func stripYangModule(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return name[i+1:]
+	}
+	return name
+}
+
+func flattenYangNode(prefix string, value interface{}, out map[string]interface{}) {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		for key, child := range typed {
+			name := stripYangModule(key)
+			if prefix != "" {
+				name = prefix + "/" + name
+			}
+			flattenYangNode(name, child, out)
+		}
+	case []interface{}:
+		// YANG "empty" leaves are encoded as [null]: null items are skipped,
+		// so [null] is a present, empty leaf.
+		leaves := make([]string, 0, len(typed))
+		for _, item := range typed {
+			switch item.(type) {
+			case nil:
+				continue
+			case map[string]interface{}, []interface{}:
+				data, _ := json.Marshal(typed)
+				out[prefix] = string(data)
+				return
+			}
+			leaves = append(leaves, fmt.Sprint(item))
+		}
+		out[prefix] = strings.Join(leaves, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = typed
+	}
+}
+
+func yangRowKey(row map[string]interface{}, keys []string) string {
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprint(row[strings.TrimSpace(key)])
+	}
+	return strings.Join(parts, "\x00")
+}
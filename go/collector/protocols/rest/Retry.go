@@ -0,0 +1,184 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy controls how transient REST failures are retried before the
+// job is marked as failed. Connection errors and 5xx responses are retried
+// only for idempotent methods, while 429 (Too Many Requests) is retried for
+// every method since the server did not process the request.
+type RetryPolicy struct {
+	MaxRetries    int           // Additional attempts after the first request
+	BaseDelay     time.Duration // Backoff before the first retry, doubled on each attempt
+	MaxDelay      time.Duration // Upper bound for a computed backoff delay
+	MaxRetryAfter time.Duration // Longest server-requested Retry-After that is honored
+	Jitter        float64       // Fraction (0..1) of each delay that is randomized
+}
+
+// DefaultRetryPolicy is used by every RestCollector unless overridden via
+// SetRetryPolicy. Set MaxRetries to 0 to disable retries.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:    3,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      10 * time.Second,
+	MaxRetryAfter: time.Minute,
+	Jitter:        0.2,
+}
+
+// isIdempotent reports whether a request with the given method can be
+// safely repeated after a failure whose outcome is unknown.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isRetryableStatus reports whether an HTTP status is considered transient.
+func isRetryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns the exponential delay for the given retry attempt
+// (0-based), capped at MaxDelay and spread by the configured jitter.
+func (this RetryPolicy) backoff(attempt int) time.Duration {
+	delay := this.BaseDelay
+	for i := 0; i < attempt && delay < this.MaxDelay; i++ {
+		delay *= 2
+	}
+	if this.MaxDelay > 0 && delay > this.MaxDelay {
+		delay = this.MaxDelay
+	}
+	if this.Jitter > 0 && delay > 0 {
+		spread := float64(delay) * this.Jitter
+		delay = time.Duration(float64(delay) - spread + rand.Float64()*2*spread)
+	}
+	return delay
+}
+
+// parseRetryAfter decodes a Retry-After header, which is either a number
+// of seconds or an HTTP date. Returns false if the header is absent or invalid.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		delay := at.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// response holds a fully read HTTP response so that the connection can be
+// released before the caller inspects it.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// doWithRetry executes the request produced by build, retrying transient
+// failures according to the collector's RetryPolicy. A new request is built
+// for every attempt so the body can be replayed. Retries stop early when
+// the next delay would pass the deadline (zero deadline means unbounded).
+func (this *RestCollector) doWithRetry(method string, build func() (*http.Request, error), deadline time.Time) (*response, error) {
+	policy := this.retryPolicy
+	for attempt := 0; ; attempt++ {
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := this.send(req)
+		var result *response
+		if err == nil {
+			body, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr != nil {
+				err = readErr
+			} else {
+				result = &response{status: resp.StatusCode, header: resp.Header, body: body}
+			}
+		}
+
+		if attempt >= policy.MaxRetries {
+			return result, err
+		}
+
+		var delay time.Duration
+		paused := false
+		switch {
+		case err != nil:
+			if !isIdempotent(method) {
+				return nil, err
+			}
+			delay = policy.backoff(attempt)
+		case result.status == http.StatusTooManyRequests ||
+			(result.status == http.StatusServiceUnavailable && result.header.Get("Retry-After") != ""):
+			retryAfter, ok := parseRetryAfter(result.header.Get("Retry-After"), time.Now())
+			if !ok {
+				retryAfter = policy.backoff(attempt)
+			} else if retryAfter > policy.MaxRetryAfter {
+				this.limiter.pause(time.Now().Add(retryAfter))
+				return result, nil
+			}
+			if result.status == http.StatusServiceUnavailable && !isIdempotent(method) {
+				return result, nil
+			}
+			delay = retryAfter
+			paused = true
+		case isRetryableStatus(result.status) && isIdempotent(method):
+			delay = policy.backoff(attempt)
+		default:
+			return result, nil
+		}
+
+		if paused {
+			// Hold every request to this host, not only this job's retry;
+			// send() waits for the pause to expire.
+			this.limiter.pause(time.Now().Add(delay))
+		}
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			return result, err
+		}
+		if !paused {
+			time.Sleep(delay)
+		}
+	}
+}
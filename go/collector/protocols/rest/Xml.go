@@ -0,0 +1,330 @@
+/*
+© 2025 Sharon Aicler (saichler@gmail.com)
+
+Layer 8 Ecosystem is licensed under the Apache License, Version 2.0.
+You may obtain a copy of the License at:
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DecodeXML converts an XML document into a nested map. The returned map has
+// a single entry keyed by the root element name. Elements with neither
+// attributes nor child elements become their trimmed text; other elements
+// become maps holding "@attr" attributes, child elements and, when not
+// blank, "#text". Repeated child elements become a []interface{}.
+// Namespace prefixes are dropped from element and attribute names.
+func DecodeXML(data []byte) (map[string]interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("xml document has no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			node, err := decodeXMLElement(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: node}, nil
+		}
+	}
+}
+
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	node := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		node["@"+attr.Name.Local] = attr.Value
+	}
+	text := &strings.Builder{}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch typed := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, typed)
+			if err != nil {
+				return nil, err
+			}
+			name := typed.Name.Local
+			switch existing := node[name].(type) {
+			case nil:
+				node[name] = child
+			case []interface{}:
+				node[name] = append(existing, child)
+			default:
+				node[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(typed)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			if len(node) == 0 {
+				return value, nil
+			}
+			if value != "" {
+				node["#text"] = value
+			}
+			return node, nil
+		}
+	}
+}
+
+// XPath evaluates a location path against a document returned by DecodeXML
+// and returns the string value of the first matching node. The supported
+// subset is absolute and relative paths, "//" descendant steps, "*",
+// positional predicates ("[2]"), attribute and child equality predicates
+// ("[@type='eth']", "[name='eth0']") and a final "@attr" or "text()" step.
+func XPath(doc map[string]interface{}, expr string) (string, bool, error) {
+	steps, err := parseXPath(expr)
+	if err != nil {
+		return "", false, err
+	}
+	nodes := []interface{}{doc}
+	for _, step := range steps {
+		nodes = step.apply(nodes)
+		if len(nodes) == 0 {
+			return "", false, nil
+		}
+	}
+	return xmlString(nodes[0]), true, nil
+}
+
+type xpathPredicate struct {
+	position int    // 1-based position, or 0
+	name     string // "@attr" or child element name
+	value    string
+}
+
+type xpathStep struct {
+	descendant bool
+	name       string // element name, "*", "@attr" or "text()"
+	predicates []xpathPredicate
+}
+
+func parseXPath(expr string) ([]xpathStep, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return nil, errors.New("empty xpath")
+	}
+	expr = strings.TrimPrefix(expr, "/")
+	if strings.HasPrefix(expr, "/") {
+		expr = "//" + strings.TrimPrefix(expr, "/")
+	} else {
+		expr = "/" + expr
+	}
+	steps := make([]xpathStep, 0)
+	for expr != "" {
+		step := xpathStep{}
+		if strings.HasPrefix(expr, "//") {
+			step.descendant = true
+			expr = expr[2:]
+		} else {
+			expr = strings.TrimPrefix(expr, "/")
+		}
+		end := xpathStepEnd(expr)
+		raw := expr[:end]
+		expr = expr[end:]
+		name := raw
+		if i := strings.Index(raw, "["); i >= 0 {
+			name = raw[:i]
+			for _, p := range strings.Split(strings.TrimSuffix(raw[i+1:], "]"), "][") {
+				predicate, err := parseXPathPredicate(p)
+				if err != nil {
+					return nil, fmt.Errorf("xpath %s: %w", raw, err)
+				}
+				step.predicates = append(step.predicates, predicate)
+			}
+		}
+		if name == "" {
+			return nil, errors.New("xpath has an empty step")
+		}
+		if i := strings.Index(name, ":"); i >= 0 && !strings.HasPrefix(name, "@") {
+			name = name[i+1:]
+		}
+		step.name = name
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// xpathStepEnd returns the index of the "/" ending the current step,
+// ignoring slashes inside predicates.
+func xpathStepEnd(expr string) int {
+	depth := 0
+	for i, c := range expr {
+		switch c {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(expr)
+}
+
+func parseXPathPredicate(p string) (xpathPredicate, error) {
+	if position, err := strconv.Atoi(strings.TrimSpace(p)); err == nil {
+		if position < 1 {
+			return xpathPredicate{}, errors.New("invalid position " + p)
+		}
+		return xpathPredicate{position: position}, nil
+	}
+	i := strings.Index(p, "=")
+	if i < 0 {
+		return xpathPredicate{}, errors.New("unsupported predicate " + p)
+	}
+	value := strings.TrimSpace(p[i+1:])
+	value = strings.Trim(value, `'"`)
+	return xpathPredicate{name: strings.TrimSpace(p[:i]), value: value}, nil
+}
+
+func (this xpathStep) apply(nodes []interface{}) []interface{} {
+	if this.descendant {
+		expanded := make([]interface{}, 0)
+		for _, node := range nodes {
+			expanded = appendDescendants(expanded, node)
+		}
+		nodes = expanded
+	}
+	result := make([]interface{}, 0)
+	for _, node := range nodes {
+		m, isMap := node.(map[string]interface{})
+		switch {
+		case this.name == "text()":
+			if isMap {
+				if text, ok := m["#text"]; ok {
+					result = append(result, text)
+				}
+			} else {
+				result = append(result, node)
+			}
+			continue
+		case !isMap:
+			continue
+		case strings.HasPrefix(this.name, "@"):
+			if value, ok := m[this.name]; ok {
+				result = append(result, value)
+			}
+			continue
+		}
+		matched := make([]interface{}, 0)
+		for _, key := range xmlChildNames(m) {
+			if this.name != "*" && key != this.name {
+				continue
+			}
+			child := m[key]
+			if list, ok := child.([]interface{}); ok {
+				matched = append(matched, list...)
+			} else {
+				matched = append(matched, child)
+			}
+		}
+		result = append(result, this.filter(matched)...)
+	}
+	return result
+}
+
+func (this xpathStep) filter(nodes []interface{}) []interface{} {
+	for _, predicate := range this.predicates {
+		if predicate.position > 0 {
+			if predicate.position > len(nodes) {
+				return nil
+			}
+			nodes = nodes[predicate.position-1 : predicate.position]
+			continue
+		}
+		kept := make([]interface{}, 0, len(nodes))
+		for _, node := range nodes {
+			m, ok := node.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			value, ok := m[predicate.name]
+			if ok && xmlString(value) == predicate.value {
+				kept = append(kept, node)
+			}
+		}
+		nodes = kept
+	}
+	return nodes
+}
+
+// appendDescendants appends node and all of its element descendants, so
+// that the following step selects among their children.
+func appendDescendants(result []interface{}, node interface{}) []interface{} {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		result = append(result, typed)
+		for _, key := range xmlChildNames(typed) {
+			result = appendDescendants(result, typed[key])
+		}
+	case []interface{}:
+		for _, item := range typed {
+			result = appendDescendants(result, item)
+		}
+	}
+	return result
+}
+
+// xmlChildNames returns the sorted child element names of an element, so
+// that multi-name selections are evaluated in a stable order.
+func xmlChildNames(m map[string]interface{}) []string {
+	names := make([]string, 0, len(m))
+	for key := range m {
+		if strings.HasPrefix(key, "@") || key == "#text" {
+			continue
+		}
+		names = append(names, key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func xmlString(node interface{}) string {
+	switch typed := node.(type) {
+	case string:
+		return typed
+	case map[string]interface{}:
+		if text, ok := typed["#text"].(string); ok {
+			return text
+		}
+		return ""
+	case []interface{}:
+		if len(typed) > 0 {
+			return xmlString(typed[0])
+		}
+		return ""
+	}
+	return fmt.Sprint(node)
+}
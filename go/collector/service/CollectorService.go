@@ -21,7 +21,6 @@ package service
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/saichler/l8collector/go/collector/protocols/k8sclient"
 	"github.com/saichler/l8pollaris/go/pollaris/targets"
@@ -87,10 +86,6 @@ func (this *CollectorService) Activate(sla *ifs.ServiceLevelAgreement, vnic ifs.
 	vnic.Resources().Registry().Register(&l8tpollaris.CTable{})
 	vnic.Resources().Registry().Register(&l8tpollaris.CJob{})
 
-	k8sclient.RegisterDeleteCallback(func(gvrText, namespace, name string) {
-		this.handleK8sDelete(gvrText, namespace, name)
-	})
-
 	slaExec := ifs.NewServiceLevelAgreement(&ExecuteService{}, "exec", sla.ServiceArea(), false, nil)
 	slaExec.SetArgs(this)
 	vnic.Resources().Services().Activate(slaExec, vnic)
@@ -98,7 +93,9 @@ func (this *CollectorService) Activate(sla *ifs.ServiceLevelAgreement, vnic ifs.
 	return nil
 }
 
-func (this *CollectorService) handleK8sDelete(gvrText, namespace, name string) {
+// handleK8sDelete forwards the deletion of a Kubernetes object, observed by
+// the collector of the given target and host, to the parser as a DELETE.
+func (this *CollectorService) handleK8sDelete(targetId, hostId, gvrText, namespace, name string) {
 	linksId := k8sclient.GVRToLinksId(gvrText)
 	if linksId == "" {
 		return
@@ -115,9 +112,10 @@ func (this *CollectorService) handleK8sDelete(gvrText, namespace, name string) {
 	}
 
 	job := &l8tpollaris.CJob{
-		LinksId: linksId,
-		HostId:  os.Getenv("ClusterName"),
-		Result:  result,
+		TargetId: targetId,
+		HostId:   hostId,
+		LinksId:  linksId,
+		Result:   result,
 	}
 
 	pService, pArea := targets.Links.Parser(linksId)
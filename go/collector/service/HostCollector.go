@@ -55,7 +55,7 @@ type HostCollector struct {
 	currentBootStage int                    // Current boot stage index (0-4)
 	bootStages       []*BootState           // Boot state tracking for each stage
 	pollarisName     string                 // Identified device pollaris profile name
-	admissionCh      chan struct{}           // Receives signals on K8s admission events
+	admissionCh      chan struct{}          // Receives signals on K8s admission events
 }
 
 // newHostCollector creates a new HostCollector instance for the specified host.
@@ -91,7 +91,7 @@ func (this *HostCollector) update() error {
 				return this.service.vnic.Resources().Logger().Error(err)
 			}
 			if col != nil {
-				this.collectors.Put(config.Protocol, col)
+				this.addCollector(config.Protocol, col)
 			}
 		}
 	}
@@ -150,7 +150,7 @@ func (this *HostCollector) start() error {
 			this.service.vnic.Resources().Logger().Error(err)
 		}
 		if col != nil {
-			this.collectors.Put(config.Protocol, col)
+			this.addCollector(config.Protocol, col)
 		}
 	}
 
@@ -158,7 +158,7 @@ func (this *HostCollector) start() error {
 
 	for _, config := range host.Configs {
 		if config.Protocol == l8tpollaris.L8PProtocol_L8PKubernetesAPI {
-			this.admissionCh = k8sclient.SubscribeAdmissionEvents()
+			this.admissionCh = k8sclient.SubscribeAdmissionEventsFor(this.coversAdmission)
 			break
 		}
 	}
@@ -168,6 +168,59 @@ func (this *HostCollector) start() error {
 	return nil
 }
 
+// addCollector registers a protocol collector and, for collectors that
+// stream pushed data or observe deletions, routes them to streamComplete
+// and deleteObserved.
+func (this *HostCollector) addCollector(protocol l8tpollaris.L8PProtocol, col common.ProtocolCollector) {
+	if sc, ok := col.(common.StreamCollector); ok {
+		sc.SetStreamHandler(this.streamComplete)
+	}
+	if dc, ok := col.(common.DeleteCollector); ok {
+		dc.SetDeleteHandler(this.deleteObserved)
+	}
+	this.collectors.Put(protocol, col)
+}
+
+// streamComplete forwards a streamed result to the parser. Every pushed
+// event is forwarded, so no change detection is applied.
+func (this *HostCollector) streamComplete(job *l8tpollaris.CJob) {
+	service := this.service
+	if !this.running || service == nil {
+		return
+	}
+	if job.Error != "" {
+		service.vnic.Resources().Logger().Warning("Stream ", job.TargetId, " - ", job.PollarisName,
+			" - ", job.JobName, " has an error:", job.Error)
+		return
+	}
+	pService, pArea := targets.Links.Parser(job.LinksId)
+	service.agg.AddElement(job, ifs.Proximity, "", pService, pArea, ifs.POST)
+}
+
+// deleteObserved forwards a deletion observed by one of this host's
+// collectors to the parser, attributed to this target and host.
+func (this *HostCollector) deleteObserved(gvrText, namespace, name string) {
+	service, target := this.service, this.target
+	if !this.running || service == nil || target == nil {
+		return
+	}
+	service.handleK8sDelete(target.TargetId, this.hostId, gvrText, namespace, name)
+}
+
+// coversAdmission reports whether one of this host's jobs polls objects
+// of gvrText in namespace, so that an admission event about such an object
+// expedites this host only.
+func (this *HostCollector) coversAdmission(gvrText, namespace string) bool {
+	service, jobsQueue := this.service, this.jobsQueue
+	if !this.running || service == nil || jobsQueue == nil {
+		return false
+	}
+	pc := pollaris.Pollaris(service.vnic.Resources())
+	return jobsQueue.HasJob(func(job *l8tpollaris.CJob) bool {
+		return k8sclient.PollCovers(pc.Poll(job.PollarisName, job.JobName), job.Arguments, gvrText, namespace)
+	})
+}
+
 func (this *HostCollector) collect() {
 	// Capture references before they may be cleared by stop()
 	resources := this.service.vnic.Resources()
@@ -262,8 +315,6 @@ func (this *HostCollector) execJob(job *l8tpollaris.CJob) bool {
 	poll := pc.Poll(job.PollarisName, job.JobName)
 	if poll == nil {
 		panic(this.target.TargetId + ": cannot find poll " + job.PollarisName + "/" + job.JobName)
-		this.service.vnic.Resources().Logger().Error("cannot find poll for device id ", this.target.TargetId)
-		return false
 	}
 	MarkStart(job)
 	c, ok := this.collectors.Get(poll.Protocol)
@@ -199,6 +199,24 @@ func (this *JobsQueue) Expedite() {
 	}
 }
 
+// HasJob reports whether an enabled job of the queue satisfies match.
+func (this *JobsQueue) HasJob(match func(*l8tpollaris.CJob) bool) bool {
+	if this == nil {
+		return false
+	}
+	this.mtx.Lock()
+	defer this.mtx.Unlock()
+	if this.shutdown {
+		return false
+	}
+	for _, job := range this.jobs {
+		if job.Cadence.Enabled && match(job) {
+			return true
+		}
+	}
+	return false
+}
+
 // Pop returns the next job that is ready for execution based on its cadence.
 // If no job is ready, it returns the time until the next job should execute.
 //